@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/awbraunstein/setlist-search/index"
+)
+
+var usageMessage = `usage: indexcheck [file ...]
+
+indexcheck lints the index files used by the setlist-search app. If no files are
+given, it checks the file named by $SETSEARCHERINDEX, or else
+$HOME/.setsearcherindex.
+
+Every malformed record is reported as file:line. indexcheck exits with a non-zero
+status if any problems were found.
+`
+
+func usage() {
+	fmt.Fprintf(os.Stderr, usageMessage)
+	os.Exit(2)
+}
+
+func getIndexLocation() string {
+	if indexLocation := os.Getenv("SETSEARCHERINDEX"); indexLocation != "" {
+		return indexLocation
+	}
+	return filepath.Clean(os.Getenv("HOME") + "/.setsearcherindex")
+}
+
+// check lints a single index file and reports whether it is free of problems.
+func check(name string) bool {
+	i, warnings, err := index.ReadFile(name, index.ReadOptions{Lenient: true})
+	for _, w := range warnings {
+		fmt.Fprintln(os.Stderr, w)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+	fmt.Printf("%s: %d shows, %d songs, %d problems\n", name, i.NumShows(), len(i.Songs()), len(warnings))
+	return len(warnings) == 0
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	files := flag.Args()
+	if len(files) == 0 {
+		files = []string{getIndexLocation()}
+	}
+	ok := true
+	for _, name := range files {
+		if !check(name) {
+			ok = false
+		}
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
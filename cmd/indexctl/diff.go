@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/awbraunstein/setlist-search/index"
+)
+
+func diff(args []string) error {
+	fs := flags("diff")
+	asJSON := fs.Bool("json", false, "Write the changes as JSON")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+	}
+	a, _, err := index.ReadFile(fs.Arg(0), index.ReadOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to read index: %v", err)
+	}
+	b, _, err := index.ReadFile(fs.Arg(1), index.ReadOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to read index: %v", err)
+	}
+	changes := index.Diff(a, b)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		err = enc.Encode(changes)
+	} else {
+		err = printChanges(os.Stdout, a, b, changes)
+	}
+	if err != nil {
+		return err
+	}
+	if !changes.Empty() {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// printChanges writes the changes in a line oriented format: "+" marks what was
+// added, "-" what was removed and "~" what was modified.
+func printChanges(w io.Writer, a, b *index.Index, c *index.Changes) error {
+	fmt.Fprintln(w, c.Summary())
+	for _, id := range c.AddedShows {
+		fmt.Fprintf(w, "+ show %d %s\n", id, b.ShowDate(id))
+	}
+	for _, id := range c.RemovedShows {
+		fmt.Fprintf(w, "- show %d %s\n", id, a.ShowDate(id))
+	}
+	for _, show := range c.ModifiedShows {
+		fmt.Fprintf(w, "~ show %d %s\n", show.ID, show.Date)
+		for _, f := range show.Fields {
+			fmt.Fprintf(w, "    %s: %q => %q\n", f.Field, f.Old, f.New)
+		}
+		for _, set := range show.Sets {
+			switch {
+			case set.Old == "":
+				fmt.Fprintf(w, "    set %s: + %s\n", set.Set, set.New)
+			case set.New == "":
+				fmt.Fprintf(w, "    set %s: - %s\n", set.Set, set.Old)
+			default:
+				fmt.Fprintf(w, "    set %s: %s => %s\n", set.Set, set.Old, set.New)
+			}
+		}
+	}
+	for _, id := range c.AddedSongs {
+		fmt.Fprintf(w, "+ song %s\n", id)
+	}
+	for _, id := range c.RemovedSongs {
+		fmt.Fprintf(w, "- song %s\n", id)
+	}
+	for _, song := range c.ModifiedSongs {
+		var parts []string
+		for _, l := range []struct {
+			prefix string
+			values []string
+		}{
+			{"+name ", song.AddedNames},
+			{"-name ", song.RemovedNames},
+			{"+alias ", song.AddedAliases},
+			{"-alias ", song.RemovedAliases},
+		} {
+			for _, v := range l.values {
+				parts = append(parts, l.prefix+v)
+			}
+		}
+		fmt.Fprintf(w, "~ song %s: %s\n", song.ID, strings.Join(parts, ", "))
+	}
+	return nil
+}
+
+func merge(args []string) error {
+	fs := flags("merge")
+	policyName := fs.String("policy", index.MergeLast.String(), "Which version to keep on conflicts: last, first, newest or strict")
+	out := fs.String("o", "", "File to write the merged index to")
+	fs.Parse(args)
+	if fs.NArg() < 2 || *out == "" {
+		fs.Usage()
+	}
+	policy, err := index.ParseMergePolicy(*policyName)
+	if err != nil {
+		return err
+	}
+	var indexes []*index.Index
+	for _, name := range fs.Args() {
+		i, _, err := index.ReadFile(name, index.ReadOptions{})
+		if err != nil {
+			return fmt.Errorf("unable to read index: %v", err)
+		}
+		indexes = append(indexes, i)
+	}
+	merged, conflicts, err := index.Merge(policy, indexes...)
+	for _, c := range conflicts {
+		if policy == index.MergeStrict {
+			log.Printf("%s %s differs in %s", c.Kind, c.Key, names(fs.Args(), c.Indexes))
+		} else {
+			log.Printf("%s %s differs in %s; kept %s", c.Kind, c.Key, names(fs.Args(), c.Indexes), fs.Arg(c.Winner))
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err := merged.Write(*out); err != nil {
+		return fmt.Errorf("unable to write index: %v", err)
+	}
+	log.Printf("Merged %d indexes into %s with %d shows and %d conflicts", len(indexes), *out, merged.NumShows(), len(conflicts))
+	return nil
+}
+
+// names returns the file names of the indexes at positions.
+func names(files []string, positions []int) string {
+	var s []string
+	for _, p := range positions {
+		s = append(s, files[p])
+	}
+	return strings.Join(s, ", ")
+}
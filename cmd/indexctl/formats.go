@@ -0,0 +1,277 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+)
+
+// Export formats.
+const (
+	formatJSON   = "json"
+	formatCSV    = "csv"
+	formatSQLite = "sqlite"
+)
+
+func writeJSON(w io.Writer, recs *records) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(recs)
+}
+
+func readJSON(r io.Reader) (*records, error) {
+	var recs records
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&recs); err != nil {
+		return nil, errors.Wrap(err, "unable to parse JSON")
+	}
+	return &recs, nil
+}
+
+func writeCSV(w io.Writer, recs *records) error {
+	cw := csv.NewWriter(w)
+	cw.Write(rowColumns)
+	for _, r := range recs.rows() {
+		cw.Write(r.strings())
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func readCSV(r io.Reader) (*records, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(rowColumns)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read CSV header")
+	}
+	for n, column := range rowColumns {
+		if header[n] != column {
+			return nil, fmt.Errorf("CSV column %d is %q, but expected %q", n+1, header[n], column)
+		}
+	}
+	var rows []*songRow
+	for n := 1; ; n++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read CSV")
+		}
+		row := &songRow{
+			Date:      record[1],
+			URL:       record[2],
+			Venue:     record[3],
+			Location:  record[4],
+			Tour:      record[5],
+			Origin:    record[6],
+			Set:       record[7],
+			Song:      record[9],
+			SongName:  record[10],
+			Connector: record[11],
+		}
+		if row.ShowID, err = strconv.Atoi(record[0]); err != nil {
+			return nil, fmt.Errorf("CSV row %d: bad show_id %q", n, record[0])
+		}
+		if record[8] != "" {
+			if row.Position, err = strconv.Atoi(record[8]); err != nil {
+				return nil, fmt.Errorf("CSV row %d: bad position %q", n, record[8])
+			}
+		}
+		rows = append(rows, row)
+	}
+	recs, err := fromRows(rows)
+	return recs, errors.Wrap(err, "CSV")
+}
+
+// sqliteSchema creates the tables of a SQLite export. songs and aliases hold
+// every name and alias, and performances holds a row per song played, like a
+// CSV export.
+const sqliteSchema = `
+CREATE TABLE songs (id TEXT NOT NULL, name TEXT NOT NULL, PRIMARY KEY (id, name));
+CREATE TABLE aliases (id TEXT NOT NULL, alias TEXT NOT NULL, PRIMARY KEY (id, alias));
+CREATE TABLE performances (
+	show_id INTEGER NOT NULL,
+	date TEXT NOT NULL,
+	url TEXT NOT NULL,
+	venue TEXT NOT NULL,
+	location TEXT NOT NULL,
+	tour TEXT NOT NULL,
+	origin TEXT NOT NULL,
+	"set" TEXT NOT NULL,
+	position INTEGER,
+	song TEXT NOT NULL,
+	song_name TEXT NOT NULL,
+	connector TEXT NOT NULL
+);
+CREATE INDEX performances_song ON performances (song);
+CREATE INDEX performances_show ON performances (show_id);
+`
+
+// sqliteDSN returns the URI of the SQLite database at path with the query
+// params. The path is escaped, since characters such as ? and # are special in
+// URIs.
+func sqliteDSN(path, params string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	u := &url.URL{Scheme: "file", Path: filepath.ToSlash(abs), RawQuery: params}
+	return u.String(), nil
+}
+
+// writeSQLite writes the records to a new SQLite database. A database can't be
+// streamed, so unlike the other formats it's written to a file.
+func writeSQLite(path string, recs *records) (err error) {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	dsn, err := sqliteDSN(path, "")
+	if err != nil {
+		return err
+	}
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := db.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(sqliteSchema); err != nil {
+		return errors.Wrap(err, "unable to create tables")
+	}
+	for _, s := range recs.Songs {
+		for _, name := range s.Names {
+			if _, err := tx.Exec("INSERT INTO songs VALUES (?, ?)", s.ID, name); err != nil {
+				return err
+			}
+		}
+		for _, alias := range s.Aliases {
+			if _, err := tx.Exec("INSERT INTO aliases VALUES (?, ?)", s.ID, alias); err != nil {
+				return err
+			}
+		}
+	}
+	insert, err := tx.Prepare(`INSERT INTO performances VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+	for _, r := range recs.rows() {
+		var position interface{}
+		if r.Position > 0 {
+			position = r.Position
+		}
+		if _, err := insert.Exec(r.ShowID, r.Date, r.URL, r.Venue, r.Location, r.Tour, r.Origin, r.Set, position, r.Song, r.SongName, r.Connector); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func readSQLite(path string) (*records, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	dsn, err := sqliteDSN(path, "mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var rows []*songRow
+	// rowid keeps the order of the sets within each show.
+	q, err := db.Query(`SELECT show_id, date, url, venue, location, tour, origin, "set", COALESCE(position, 0), song, song_name, connector FROM performances ORDER BY show_id, rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	for q.Next() {
+		r := &songRow{}
+		if err := q.Scan(&r.ShowID, &r.Date, &r.URL, &r.Venue, &r.Location, &r.Tour, &r.Origin, &r.Set, &r.Position, &r.Song, &r.SongName, &r.Connector); err != nil {
+			return nil, err
+		}
+		rows = append(rows, r)
+	}
+	if err := q.Err(); err != nil {
+		return nil, err
+	}
+	recs, err := fromRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// The songs and aliases tables are complete, unlike the names in the
+	// performances.
+	names, err := queryPairs(db, "SELECT id, name FROM songs ORDER BY id, name")
+	if err != nil {
+		return nil, err
+	}
+	aliases, err := queryPairs(db, "SELECT id, alias FROM aliases ORDER BY id, alias")
+	if err != nil {
+		return nil, err
+	}
+	songs := make(map[string]*songRecord)
+	var ids []string
+	song := func(id string) *songRecord {
+		if songs[id] == nil {
+			songs[id] = &songRecord{ID: id}
+			ids = append(ids, id)
+		}
+		return songs[id]
+	}
+	for _, p := range names {
+		s := song(p[0])
+		s.Names = append(s.Names, p[1])
+	}
+	for _, p := range aliases {
+		s := song(p[0])
+		s.Aliases = append(s.Aliases, p[1])
+	}
+	recs.Songs = nil
+	for _, id := range ids {
+		recs.Songs = append(recs.Songs, *songs[id])
+	}
+	return recs, nil
+}
+
+// queryPairs returns the rows of a query that selects two strings.
+func queryPairs(db *sql.DB, query string) ([][2]string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var pairs [][2]string
+	for rows.Next() {
+		var p [2]string
+		if err := rows.Scan(&p[0], &p[1]); err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, p)
+	}
+	return pairs, rows.Err()
+}
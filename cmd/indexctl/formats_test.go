@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/awbraunstein/setlist-search/index"
+)
+
+const testIndex = `setsearcher index 2
+[SONGS]
+Fee|fee
+Mike's Song|mikes-song
+Reba|reba
+Weekapaug|weekapaug-groove
+Weekapaug Groove|weekapaug-groove
+You Enjoy Myself|you-enjoy-myself
+[END]
+[ALIASES]
+mikes-song|Mike's
+you-enjoy-myself|YEM
+[END]
+[SETLISTS]
+ID{1}DATE{1997-11-22}URL{http://phish.net/1}VENUE{Hampton Coliseum}LOCATION{Hampton, VA, USA}TOUR{Fall Tour 1997}ORIGIN{phish.net}SET1{mikes-song->fee>weekapaug-groove,reba}SET2{you-enjoy-myself}ENCORE{fee}
+ID{2}DATE{1998-04-02}URL{http://phish.net/2}ORIGIN{phish.net+override}SOUNDCHECK{reba}SET1{you-enjoy-myself,fee}SET2{}
+ID{3}DATE{1998-04-03}URL{http://phish.net/3}SET1{}
+[END]`
+
+// tempDir returns a new directory and a func that removes it.
+func tempDir(t *testing.T) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "indexctl")
+	if err != nil {
+		t.Fatalf("unable to create temp dir; %v", err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestRoundTrip(t *testing.T) {
+	orig, err := index.Read(strings.NewReader(testIndex))
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	tests := []struct {
+		format string
+		// lossy is set for formats that keep the shows but not every name
+		// and alias.
+		lossy bool
+	}{
+		{format: formatJSON},
+		{format: formatCSV, lossy: true},
+		{format: formatSQLite},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.format, func(t *testing.T) {
+			recs := fromIndex(orig)
+			var got *records
+			switch tc.format {
+			case formatJSON:
+				var b bytes.Buffer
+				if err := writeJSON(&b, recs); err != nil {
+					t.Fatalf("writeJSON got unexpected error: %v", err)
+				}
+				got, err = readJSON(&b)
+			case formatCSV:
+				var b bytes.Buffer
+				if err := writeCSV(&b, recs); err != nil {
+					t.Fatalf("writeCSV got unexpected error: %v", err)
+				}
+				got, err = readCSV(&b)
+			case formatSQLite:
+				// ? and # are special in SQLite URIs.
+				path := filepath.Join(dir, "export?v=1#x.sqlite")
+				if err := writeSQLite(path, recs); err != nil {
+					t.Fatalf("writeSQLite got unexpected error: %v", err)
+				}
+				if err := writeSQLite(path, recs); err == nil {
+					t.Error("writeSQLite over an existing file expected an error, but got nil")
+				}
+				got, err = readSQLite(path)
+			}
+			if err != nil {
+				t.Fatalf("unable to read the export; %v", err)
+			}
+			path := filepath.Join(dir, tc.format+".index")
+			if err := got.write(path); err != nil {
+				t.Fatalf("unable to write the imported index; %v", err)
+			}
+			imported, _, err := index.ReadFile(path, index.ReadOptions{})
+			if err != nil {
+				t.Fatalf("unable to read the imported index; %v", err)
+			}
+			c := index.Diff(orig, imported)
+			if len(c.AddedShows)+len(c.RemovedShows)+len(c.ModifiedShows) > 0 {
+				t.Errorf("the shows changed in the round trip: %s", c.Summary())
+			}
+			if !tc.lossy && !c.Empty() {
+				t.Errorf("the songs changed in the round trip: %+v", c)
+			}
+			if tc.lossy {
+				if names, aliases := recs.csvLoss(); names != 1 || aliases != 2 {
+					t.Errorf("csvLoss got %d names and %d aliases, but expected 1 and 2", names, aliases)
+				}
+			}
+		})
+	}
+}
+
+func TestRowsRoundTrip(t *testing.T) {
+	recs := &records{
+		Songs: []songRecord{{ID: "fee", Names: []string{"Fee"}}},
+		Shows: []showRecord{
+			{ID: 1, Date: "1990-01-01", URL: "a", Tour: "Winter", Sets: []setRecord{
+				{Name: "1", Songs: []string{"fee", "fee"}, Connectors: []string{"->"}},
+				{Name: "2", Songs: []string{}},
+				{Name: "e", Songs: []string{"fee"}},
+			}},
+			// A show with no songs keeps a row of its own.
+			{ID: 2, Date: "1990-01-02", URL: "b"},
+			// So does each empty set.
+			{ID: 3, Date: "1990-01-03", URL: "c", Sets: []setRecord{
+				{Name: "1", Songs: []string{}},
+				{Name: "e", Songs: []string{}},
+			}},
+		},
+	}
+	rows := recs.rows()
+	if len(rows) != 7 {
+		t.Fatalf("rows got %d rows, but expected 7", len(rows))
+	}
+	got, err := fromRows(rows)
+	if err != nil {
+		t.Fatalf("fromRows got unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, recs) {
+		t.Errorf("fromRows got:\n%+v\nbut expected:\n%+v", got, recs)
+	}
+}
+
+func TestFromRowsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		rows []*songRow
+		err  string
+	}{
+		{
+			name: "rows of a show aren't adjacent",
+			rows: []*songRow{
+				{ShowID: 1, Set: "1", Position: 1, Song: "fee"},
+				{ShowID: 2, Set: "1", Position: 1, Song: "fee"},
+				{ShowID: 1, Set: "1", Position: 2, Song: "reba"},
+			},
+			err: "rows of show 1 aren't adjacent",
+		},
+		{
+			name: "bad position",
+			rows: []*songRow{
+				{ShowID: 1, Set: "1", Position: 1, Song: "fee"},
+				{ShowID: 1, Set: "1", Position: 3, Song: "reba"},
+			},
+			err: "show 1 set 1: expected song 2, but found 3",
+		},
+		{
+			name: "empty set with songs",
+			rows: []*songRow{
+				{ShowID: 1, Set: "1", Position: 1, Song: "fee"},
+				{ShowID: 1, Set: "1"},
+			},
+			err: "show 1 set 1: a row with no song must be the only row of its set",
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := fromRows(tc.rows)
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("fromRows got error %v, but expected %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestReadCSVErrors(t *testing.T) {
+	header := strings.Join(rowColumns, ",") + "\n"
+	tests := []struct {
+		name string
+		csv  string
+		err  string
+	}{
+		{name: "bad header", csv: strings.Replace(header, "origin", "source", 1), err: `CSV column 7 is "source"`},
+		{name: "bad show_id", csv: header + "x,1990-01-01,a,,,,,1,1,fee,Fee,\n", err: `bad show_id "x"`},
+		{name: "bad position", csv: header + "1,1990-01-01,a,,,,,1,first,fee,Fee,\n", err: `bad position "first"`},
+		{name: "missing column", csv: header + "1,1990-01-01,a\n", err: "wrong number of fields"},
+		{name: "position gap", csv: header + "1,1990-01-01,a,,,,,1,2,fee,Fee,\n", err: "expected song 1, but found 2"},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := readCSV(strings.NewReader(tc.csv))
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("readCSV got error %v, but expected one containing %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	show := showRecord{ID: 1, Date: "1990-01-01", URL: "a", Sets: []setRecord{{Name: "1", Songs: []string{"fee"}}}}
+	tests := []struct {
+		name string
+		recs *records
+		err  string
+	}{
+		{
+			name: "name with a separator",
+			recs: &records{Songs: []songRecord{{ID: "fee", Names: []string{"Fee|Fie"}}}, Shows: []showRecord{show}},
+			err:  "song fee name",
+		},
+		{
+			name: "alias with a line break",
+			recs: &records{Songs: []songRecord{{ID: "fee", Aliases: []string{"F\nE"}}}, Shows: []showRecord{show}},
+			err:  "song fee alias",
+		},
+		{
+			name: "empty song ID",
+			recs: &records{Songs: []songRecord{{Names: []string{"Fee"}}}, Shows: []showRecord{show}},
+			err:  "song ID",
+		},
+		{
+			name: "duplicate show",
+			recs: &records{Shows: []showRecord{show, show}},
+			err:  "duplicate show 1",
+		},
+		{
+			name: "show with no songs",
+			recs: &records{Shows: []showRecord{{ID: 2, Date: "1990-01-02", URL: "b"}}},
+			err:  "couldn't find any sets",
+		},
+		{
+			name: "bad connector",
+			recs: &records{Shows: []showRecord{{ID: 1, Date: "1990-01-01", URL: "a", Sets: []setRecord{{Name: "1", Songs: []string{"a", "b"}, Connectors: []string{"~"}}}}}},
+			err:  "show 1 set 1",
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, "index")
+			err := tc.recs.write(path)
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("write got error %v, but expected one containing %q", err, tc.err)
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("write left an index after failing")
+			}
+		})
+	}
+}
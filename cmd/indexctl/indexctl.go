@@ -0,0 +1,219 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/awbraunstein/setlist-search/config"
+	"github.com/awbraunstein/setlist-search/index"
+)
+
+var usageMessage = `usage: indexctl export [-index file] [-format json|csv|sqlite] [-o file]
+       indexctl import [-index file] [-format json|csv|sqlite] file
+       indexctl diff [-json] old new
+       indexctl merge [-policy last|first|newest|strict] -o file index...
+
+indexctl moves the data of the index used by the setlist-search app in and out
+of formats that other tools can read. The index is the file given by -index,
+$SETSEARCHERINDEX, or else $HOME/.setsearcherindex.
+
+export writes the index to a file, or for json and csv to stdout if -o is - or
+isn't given. import builds an index from a file and replaces the index with it;
+the file - is stdin for json and csv. The format defaults to the extension of
+the file: .json, .csv, or .db, .sqlite and .sqlite3.
+
+The formats are:
+
+	json	a document with every song, its names and aliases, and every show
+		with its sets
+	csv	a row per song played, with the show, set, position, song ID,
+		song name and the connector to the next song. An empty set is
+		a row with no position or song.
+	sqlite	the rows of csv in a performances table, and the names and
+		aliases of the songs in songs and aliases tables
+
+csv only keeps the first name of each song that was played, and no aliases,
+so a csv export can't be imported without losing them. export warns when a csv
+export leaves names or aliases out.
+
+diff reports the shows and songs that were added, removed or modified between
+two index files, including the changes to each set of a modified show. Like
+diff(1), it exits with 0 if the indexes are the same, 1 if they differ and 2
+if something went wrong.
+
+merge combines index files into a new one. When indexes have different
+versions of a show, or map a song name to different songs, -policy keeps the
+version of the last index, the first index, or the most recently modified
+index, or with strict fails. Every conflict is logged.
+`
+
+func usage() {
+	fmt.Fprintf(os.Stderr, usageMessage)
+	os.Exit(2)
+}
+
+// formatOf returns the format of a file from its extension.
+func formatOf(name string) string {
+	switch filepath.Ext(name) {
+	case ".json":
+		return formatJSON
+	case ".csv":
+		return formatCSV
+	case ".db", ".sqlite", ".sqlite3":
+		return formatSQLite
+	}
+	return ""
+}
+
+// flags returns the flag set of a subcommand.
+func flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "%s\nFlags of %s:\n", usageMessage, name)
+		fs.PrintDefaults()
+		os.Exit(2)
+	}
+	return fs
+}
+
+// formatFlags returns the flag set of export or import.
+func formatFlags(name string, cfg *config.Config, format *string) *flag.FlagSet {
+	fs := flags(name)
+	fs.StringVar(&cfg.Index.Path, "index", cfg.Index.Path, "Location of the index")
+	fs.StringVar(format, "format", "", "Format of the file: json, csv or sqlite")
+	return fs
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("indexctl: ")
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "export":
+		err = export(args)
+	case "import":
+		err = importIndex(args)
+	case "diff":
+		err = diff(args)
+	case "merge":
+		err = merge(args)
+	default:
+		usage()
+	}
+	// Errors exit with 2, since diff exits with 1 when indexes differ.
+	if err != nil {
+		log.Print(err)
+		os.Exit(2)
+	}
+}
+
+func export(args []string) error {
+	cfg := config.Default()
+	var format string
+	fs := formatFlags("export", cfg, &format)
+	out := fs.String("o", "-", "File to write")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+	}
+	if format == "" {
+		if format = formatOf(*out); format == "" {
+			format = formatJSON
+		}
+	}
+
+	i, _, err := index.ReadFile(cfg.Index.Path, index.ReadOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to read index: %v", err)
+	}
+	recs := fromIndex(i)
+	if format == formatSQLite {
+		if *out == "-" {
+			return fmt.Errorf("sqlite can't be written to stdout; use -o")
+		}
+		return writeSQLite(*out, recs)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	switch format {
+	case formatJSON:
+		err = writeJSON(w, recs)
+	case formatCSV:
+		if names, aliases := recs.csvLoss(); names+aliases > 0 {
+			log.Printf("Warning: csv leaves out %d song names and %d aliases; use json or sqlite to keep them", names, aliases)
+		}
+		err = writeCSV(w, recs)
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write %s: %v", *out, err)
+	}
+	if f, ok := w.(*os.File); ok && f != os.Stdout {
+		return f.Close()
+	}
+	return nil
+}
+
+func importIndex(args []string) error {
+	cfg := config.Default()
+	var format string
+	fs := formatFlags("import", cfg, &format)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+	}
+	in := fs.Arg(0)
+	if format == "" {
+		if format = formatOf(in); format == "" {
+			return fmt.Errorf("unknown format of %s; use -format", in)
+		}
+	}
+
+	var recs *records
+	var err error
+	if format == formatSQLite {
+		recs, err = readSQLite(in)
+	} else {
+		var r io.Reader = os.Stdin
+		if in != "-" {
+			f, err := os.Open(in)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+		switch format {
+		case formatJSON:
+			recs, err = readJSON(r)
+		case formatCSV:
+			recs, err = readCSV(r)
+		default:
+			return fmt.Errorf("unknown format %q", format)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %v", in, err)
+	}
+	if err := recs.write(cfg.Index.Path); err != nil {
+		return fmt.Errorf("unable to write index: %v", err)
+	}
+	log.Printf("Imported %d songs and %d shows into %s", len(recs.Songs), len(recs.Shows), cfg.Index.Path)
+	return nil
+}
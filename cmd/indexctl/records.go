@@ -0,0 +1,309 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/awbraunstein/setlist-search/index"
+	"github.com/awbraunstein/setlist-search/searcher"
+)
+
+// records is the contents of an index in the shape that it is exported and
+// imported in.
+type records struct {
+	Songs []songRecord `json:"songs"`
+	Shows []showRecord `json:"shows"`
+}
+
+// songRecord is a song with its names and aliases.
+type songRecord struct {
+	ID      string   `json:"id"`
+	Names   []string `json:"names,omitempty"`
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+// showRecord is a show with its sets.
+type showRecord struct {
+	ID       int         `json:"id"`
+	Date     string      `json:"date"`
+	URL      string      `json:"url"`
+	Venue    string      `json:"venue,omitempty"`
+	Location string      `json:"location,omitempty"`
+	Tour     string      `json:"tour,omitempty"`
+	Origin   string      `json:"origin,omitempty"`
+	Sets     []setRecord `json:"sets"`
+}
+
+// setRecord is a set of a show.
+type setRecord struct {
+	// Name is the short name of the set: "1", "2", "e", "e2", "s", ...
+	Name  string   `json:"name"`
+	Songs []string `json:"songs"`
+	// Connectors join each song to the next one: ",", ">" or "->".
+	Connectors []string `json:"connectors,omitempty"`
+}
+
+// rowColumns are the columns of the flat per-song rows of CSV and SQLite
+// exports.
+var rowColumns = []string{"show_id", "date", "url", "venue", "location", "tour", "origin", "set", "position", "song", "song_name", "connector"}
+
+// songRow is a performance of a song in the flat export formats. A show with
+// no sets has a single row with an empty set, and an empty set has a single row
+// with no position or song.
+type songRow struct {
+	ShowID    int
+	Date      string
+	URL       string
+	Venue     string
+	Location  string
+	Tour      string
+	Origin    string
+	Set       string
+	Position  int
+	Song      string
+	SongName  string
+	Connector string
+}
+
+func (r *songRow) strings() []string {
+	position := ""
+	if r.Position > 0 {
+		position = strconv.Itoa(r.Position)
+	}
+	return []string{strconv.Itoa(r.ShowID), r.Date, r.URL, r.Venue, r.Location, r.Tour, r.Origin, r.Set, position, r.Song, r.SongName, r.Connector}
+}
+
+// fromIndex returns the records of an index.
+func fromIndex(i *index.Index) *records {
+	recs := &records{Songs: []songRecord{}, Shows: []showRecord{}}
+	for _, s := range i.SongTable().Songs() {
+		recs.Songs = append(recs.Songs, songRecord{ID: s.ID, Names: s.Names, Aliases: s.Aliases})
+	}
+	for _, id := range i.ShowIDs() {
+		sl := i.Show(id)
+		show := showRecord{
+			ID:       sl.ShowId,
+			Date:     sl.Date,
+			URL:      sl.Url,
+			Venue:    sl.Venue,
+			Location: sl.Location,
+			Tour:     sl.Tour,
+			Origin:   sl.Origin,
+			Sets:     []setRecord{},
+		}
+		for _, set := range sl.Sets {
+			sr := setRecord{Name: set.Name(), Songs: set.Songs}
+			for n := 0; n < len(set.Songs)-1; n++ {
+				sr.Connectors = append(sr.Connectors, set.ConnectorAfter(n).String())
+			}
+			show.Sets = append(show.Sets, sr)
+		}
+		recs.Shows = append(recs.Shows, show)
+	}
+	return recs
+}
+
+// rows flattens the shows into a row per song.
+func (recs *records) rows() []*songRow {
+	names := make(map[string]string)
+	for _, s := range recs.Songs {
+		if len(s.Names) > 0 {
+			names[s.ID] = s.Names[0]
+		}
+	}
+	var rows []*songRow
+	for _, show := range recs.Shows {
+		row := songRow{
+			ShowID:   show.ID,
+			Date:     show.Date,
+			URL:      show.URL,
+			Venue:    show.Venue,
+			Location: show.Location,
+			Tour:     show.Tour,
+			Origin:   show.Origin,
+		}
+		first := len(rows)
+		for _, set := range show.Sets {
+			if len(set.Songs) == 0 {
+				r := row
+				r.Set = set.Name
+				rows = append(rows, &r)
+				continue
+			}
+			for n, song := range set.Songs {
+				r := row
+				r.Set = set.Name
+				r.Position = n + 1
+				r.Song = song
+				r.SongName = names[song]
+				if n < len(set.Connectors) {
+					r.Connector = set.Connectors[n]
+				}
+				rows = append(rows, &r)
+			}
+		}
+		if len(rows) == first {
+			rows = append(rows, &row)
+		}
+	}
+	return rows
+}
+
+// csvLoss returns the number of song names and aliases that the rows leave
+// out: every alias, the names of songs that weren't played, and all but the
+// first name of the songs that were.
+func (recs *records) csvLoss() (names, aliases int) {
+	played := make(map[string]bool)
+	for _, show := range recs.Shows {
+		for _, set := range show.Sets {
+			for _, song := range set.Songs {
+				played[song] = true
+			}
+		}
+	}
+	for _, s := range recs.Songs {
+		names += len(s.Names)
+		if played[s.ID] && len(s.Names) > 0 {
+			names--
+		}
+		aliases += len(s.Aliases)
+	}
+	return names, aliases
+}
+
+// fromRows gathers rows into records. Rows of a show must be adjacent, in the
+// order of its sets and songs. The songs are the named songs of the rows, and
+// an empty connector is a break.
+func fromRows(rows []*songRow) (*records, error) {
+	recs := &records{}
+	named := make(map[string]bool)
+	seen := make(map[int]bool)
+	var show *showRecord
+	// connector is the connector of the previous row, which joins its song to
+	// the next one.
+	var connector string
+	for _, r := range rows {
+		if show == nil || show.ID != r.ShowID {
+			if seen[r.ShowID] {
+				return nil, fmt.Errorf("rows of show %d aren't adjacent", r.ShowID)
+			}
+			seen[r.ShowID] = true
+			recs.Shows = append(recs.Shows, showRecord{
+				ID:       r.ShowID,
+				Date:     r.Date,
+				URL:      r.URL,
+				Venue:    r.Venue,
+				Location: r.Location,
+				Tour:     r.Tour,
+				Origin:   r.Origin,
+			})
+			show = &recs.Shows[len(recs.Shows)-1]
+		}
+		if r.Set == "" {
+			continue
+		}
+		newSet := len(show.Sets) == 0 || show.Sets[len(show.Sets)-1].Name != r.Set
+		if r.Song == "" {
+			// An empty set.
+			if !newSet || r.Position != 0 {
+				return nil, fmt.Errorf("show %d set %s: a row with no song must be the only row of its set", r.ShowID, r.Set)
+			}
+			show.Sets = append(show.Sets, setRecord{Name: r.Set, Songs: []string{}})
+			continue
+		}
+		if newSet {
+			show.Sets = append(show.Sets, setRecord{Name: r.Set})
+		}
+		set := &show.Sets[len(show.Sets)-1]
+		if r.Position != len(set.Songs)+1 {
+			return nil, fmt.Errorf("show %d set %s: expected song %d, but found %d", r.ShowID, r.Set, len(set.Songs)+1, r.Position)
+		}
+		if len(set.Songs) > 0 {
+			if connector == "" {
+				connector = searcher.Break.String()
+			}
+			set.Connectors = append(set.Connectors, connector)
+		}
+		set.Songs = append(set.Songs, r.Song)
+		connector = r.Connector
+		if r.SongName != "" && !named[r.Song] {
+			named[r.Song] = true
+			recs.Songs = append(recs.Songs, songRecord{ID: r.Song, Names: []string{r.SongName}})
+		}
+	}
+	return recs, nil
+}
+
+// setlist returns the setlist of a show record.
+func (show *showRecord) setlist() (*searcher.Setlist, error) {
+	sl := &searcher.Setlist{
+		ShowId:   show.ID,
+		Date:     show.Date,
+		Url:      show.URL,
+		Venue:    show.Venue,
+		Location: show.Location,
+		Tour:     show.Tour,
+		Origin:   show.Origin,
+	}
+	for _, sr := range show.Sets {
+		set, err := searcher.ParseSetName(sr.Name)
+		if err != nil {
+			return nil, fmt.Errorf("show %d: %v", show.ID, err)
+		}
+		// A set may be empty, as it may be in an index.
+		if len(sr.Connectors) > 0 && len(sr.Connectors) > len(sr.Songs)-1 {
+			return nil, fmt.Errorf("show %d set %s has more connectors than songs", show.ID, sr.Name)
+		}
+		set.Songs = sr.Songs
+		for _, c := range sr.Connectors {
+			conn, err := searcher.ParseConnector(c)
+			if err != nil {
+				return nil, fmt.Errorf("show %d set %s: %v", show.ID, sr.Name, err)
+			}
+			set.Connectors = append(set.Connectors, conn)
+		}
+		sl.Sets = append(sl.Sets, set)
+	}
+	return sl, nil
+}
+
+// write builds an index from the records and writes it to path.
+func (recs *records) write(path string) error {
+	w := index.NewWriter(path)
+	for _, s := range recs.Songs {
+		if err := index.CheckSongText(s.ID); err != nil {
+			return fmt.Errorf("song ID: %v", err)
+		}
+		for _, name := range s.Names {
+			if err := index.CheckSongText(name); err != nil {
+				return fmt.Errorf("song %s name: %v", s.ID, err)
+			}
+			w.AddSong(name, s.ID)
+		}
+		for _, alias := range s.Aliases {
+			if err := index.CheckSongText(alias); err != nil {
+				return fmt.Errorf("song %s alias: %v", s.ID, err)
+			}
+			w.AddAlias(s.ID, alias)
+		}
+	}
+	seen := make(map[int]bool)
+	for n := range recs.Shows {
+		show := &recs.Shows[n]
+		if seen[show.ID] {
+			return fmt.Errorf("duplicate show %d", show.ID)
+		}
+		seen[show.ID] = true
+		sl, err := show.setlist()
+		if err != nil {
+			return err
+		}
+		// Round trip the setlist through its serialization so that bad
+		// dates, URLs and songs are caught before the index is written.
+		if _, err := searcher.ParseSetlist(sl.String()); err != nil {
+			return err
+		}
+		w.AddSetlist(sl)
+	}
+	return w.Write()
+}
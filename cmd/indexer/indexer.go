@@ -7,10 +7,10 @@ import (
 	"io"
 	"log"
 	"os"
-	"path/filepath"
 
 	"cloud.google.com/go/storage"
 	"github.com/awbraunstein/gophish"
+	"github.com/awbraunstein/setlist-search/config"
 	"github.com/awbraunstein/setlist-search/index"
 	"github.com/awbraunstein/setlist-search/searcher"
 	"github.com/pkg/errors"
@@ -19,26 +19,28 @@ import (
 var usageMessage = `usage: indexer
 
 indexer prepares the index used by the setlist-search app. The index is the file
-named by $SETSEARCHERINDEX, or else $HOME/.setsearcherindex.
+named by -index, $SETSEARCHER_INDEX or $SETSEARCHERINDEX, or else
+$HOME/.setsearcherindex. If -remote_index is true, it's then uploaded to
+Google Cloud Storage. The new index is read back, and the changes from the
+index being replaced are logged, before the upload.
 
 
 The indexer uses the phish.net api to scrape all of the new shows. If [-reset]
 is false, then only new shows will be fetched.
 
-The apikey for requests will be read from $PHISHAPIKEY.`
+Mistakes and gaps in the phish.net data are fixed by the YAML or JSON file of
+overrides named by -overrides or $SETSEARCHER_OVERRIDES. Each override replaces
+a set, fixes a song's name, adds a missing show or hides a show. Overrides that
+no longer apply are logged and skipped.
 
-const (
-	firstShowDate = "1983-10-30"
-	bucketName    = "setlist-searcher-index"
-	objectName    = "index.txt"
-)
+The apikey for requests will be read from $PHISHAPIKEY.`
 
-var (
-	remote = flag.Bool("remote", true, "Whether the index will be stored remotely.")
-)
+const firstShowDate = "1983-10-30"
 
 func usage() {
 	fmt.Fprintf(os.Stderr, usageMessage)
+	fmt.Fprintf(os.Stderr, "\n\nFlags:\n")
+	flag.PrintDefaults()
 	os.Exit(2)
 }
 
@@ -106,19 +108,68 @@ func getSetlistAndSongs(client *gophish.Client, show *gophish.Show) (*searcher.S
 		return nil, nil, fmt.Errorf("received multiple entries for showid=%d. Using the first one.", show.ShowId)
 	}
 	setlist := resp.Response.Data[0]
-	return searcher.ParseSetlistFromPhishNet(setlist)
+	sl, songs, err := searcher.ParseSetlistFromPhishNet(setlist)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The tour is only known from the show.
+	sl.Tour = show.TourName
+	sl.Origin = searcher.OriginPhishNet
+	return sl, songs, nil
+}
+
+// previousIndex reads the index that is about to be replaced: the remote index
+// if -remote_index is set, or else the local one. It returns nil if there isn't
+// one yet.
+func previousIndex(cfg *config.Config) (*index.Index, error) {
+	if !cfg.Index.Remote {
+		i, _, err := index.ReadFile(cfg.Index.Path, index.ReadOptions{Lenient: true})
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return i, err
+	}
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	r, err := client.Bucket(cfg.Index.Bucket).Object(cfg.Index.Object).NewReader(ctx)
+	if err == storage.ErrObjectNotExist {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	i, _, err := index.ReadWithOptions(r, index.ReadOptions{Name: cfg.Index.Object, Lenient: true})
+	return i, err
 }
 
-func getIndexLocation() string {
-	if indexLocation := os.Getenv("SETSEARCHERINDEX"); indexLocation != "" {
-		return indexLocation
+// logChanges logs a summary of the changes from the previous index to the new
+// one, i.
+func logChanges(previous, i *index.Index) {
+	changes := index.Diff(previous, i)
+	log.Printf("Changes from the previous index: %s", changes.Summary())
+	for _, show := range changes.ModifiedShows {
+		log.Printf("Modified show %d - %s", show.ID, show.Date)
+	}
+	for _, id := range changes.RemovedShows {
+		log.Printf("Removed show %d - %s", id, previous.ShowDate(id))
 	}
-	return filepath.Clean(os.Getenv("HOME") + "/.setsearcherindex")
 }
 
 func main() {
+	cfg := config.Default()
+	cfg.RegisterIndexFlags(flag.CommandLine)
+	flag.BoolVar(&cfg.Index.Remote, "remote", cfg.Index.Remote, "Deprecated alias of -remote_index")
+	overridesPath := flag.String("overrides", "", "YAML or JSON file of manual fixes to the scraped setlists")
 	flag.Usage = usage
-	flag.Parse()
+	if err := config.Load(flag.CommandLine, os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Effective config:\n%s", config.Effective(flag.CommandLine))
 
 	apiKey := os.Getenv("PHISHAPIKEY")
 	if apiKey == "" {
@@ -127,7 +178,15 @@ func main() {
 	}
 	client := gophish.NewClient(apiKey)
 
-	indexLocation := getIndexLocation()
+	var overrides []index.Override
+	if *overridesPath != "" {
+		var err error
+		if overrides, err = index.ReadOverrides(*overridesPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	indexLocation := cfg.Index.Path
 	w := index.NewWriter(indexLocation)
 
 	shows, err := queryAllShows(client)
@@ -148,13 +207,37 @@ func main() {
 			w.AddSong(longName, shortName)
 		}
 	}
+	for song, aliases := range index.CommonAliases {
+		for _, alias := range aliases {
+			w.AddAlias(song, alias)
+		}
+	}
+	for _, err := range w.ApplyOverrides(overrides) {
+		log.Printf("Skipped %v", err)
+	}
+	if len(overrides) > 0 {
+		log.Printf("Applied overrides from %s", *overridesPath)
+	}
+	previous, err := previousIndex(cfg)
+	if err != nil {
+		log.Printf("Unable to read the previous index, so changes won't be logged; %v", err)
+	}
 	if err := w.Write(); err != nil {
 		log.Fatalf("error writing file: %v\n", err)
 	}
 	log.Printf("wrote index to %s", indexLocation)
+	// Read the new index back, as the app will, so that a bad one is never
+	// uploaded.
+	i, _, err := index.ReadFile(indexLocation, index.ReadOptions{})
+	if err != nil {
+		log.Fatalf("The new index can't be read; %v\n", err)
+	}
+	if previous != nil {
+		logChanges(previous, i)
+	}
 
 	// If this is remote, then we want to upload the result to Google Cloud Store.
-	if *remote {
+	if cfg.Index.Remote {
 		f, err := os.Open(indexLocation)
 		if err != nil {
 			log.Fatalf("Unable to open index; %v\n", err)
@@ -165,7 +248,7 @@ func main() {
 			log.Fatalf("Failed to create client: %v\n", err)
 		}
 		defer client.Close()
-		object := client.Bucket(bucketName).Object(objectName)
+		object := client.Bucket(cfg.Index.Bucket).Object(cfg.Index.Object)
 		wc := object.NewWriter(context.Background())
 		if _, err = io.Copy(wc, f); err != nil {
 			log.Fatalf("Unable to copy index; %v\n", err)
@@ -173,6 +256,6 @@ func main() {
 		if err := wc.Close(); err != nil {
 			log.Fatalf("Unable to close index; %v\n", err)
 		}
-		log.Printf("wrote index to the cloud at %s/%s", bucketName, objectName)
+		log.Printf("wrote index to the cloud at %s/%s", cfg.Index.Bucket, cfg.Index.Object)
 	}
 }
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/awbraunstein/setlist-search/index"
+)
+
+// Exit statuses of batch mode, which follow grep: every query matched a show,
+// some query matched no shows, or something went wrong.
+const (
+	exitMatched = 0
+	exitNoMatch = 1
+	exitFailed  = 2
+)
+
+// batchRow is a show matched by a query in batch mode.
+type batchRow struct {
+	Query string `json:"query"`
+	ID    int    `json:"id"`
+	Date  string `json:"date"`
+	URL   string `json:"url"`
+}
+
+// readQueries returns the queries in a file, one per line. Blank lines and
+// lines starting with # are skipped. The file "-" is stdin.
+func readQueries(name string) ([]string, error) {
+	if name == "-" {
+		return scanQueries(os.Stdin)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return scanQueries(f)
+}
+
+// scanQueries returns the queries read from r, as readQueries does.
+func scanQueries(r io.Reader) ([]string, error) {
+	var queries []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		queries = append(queries, line)
+	}
+	return queries, scanner.Err()
+}
+
+// runBatch reads the index and runs the query q and the queries in file,
+// either of which may be empty. It returns the exit status.
+func (r *repl) runBatch(q, file string) int {
+	var queries []string
+	if q != "" {
+		queries = append(queries, q)
+	}
+	if file != "" {
+		fq, err := readQueries(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "searcher: unable to read queries: %v\n", err)
+			return exitFailed
+		}
+		queries = append(queries, fq...)
+	}
+	i, _, err := index.ReadFile(r.path, index.ReadOptions{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "searcher: unable to read index: %v\n", err)
+		return exitFailed
+	}
+	r.idx = i
+	return r.batch(queries)
+}
+
+// batch runs the queries and writes the matched shows as JSON lines or CSV. It
+// returns the exit status. Queries that fail are reported on stderr and the
+// rest still run.
+func (r *repl) batch(queries []string) int {
+	var (
+		enc *json.Encoder
+		cw  *csv.Writer
+	)
+	if r.format == formatCSV {
+		cw = csv.NewWriter(r.out)
+		cw.Write([]string{"query", "id", "date", "url"})
+	} else {
+		enc = json.NewEncoder(r.out)
+		enc.SetEscapeHTML(false)
+	}
+
+	status := exitMatched
+	for n, q := range queries {
+		shows, err := r.search(q)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "searcher: query %d %q: %v\n", n+1, q, err)
+			status = exitFailed
+			continue
+		}
+		if len(shows) == 0 && status == exitMatched {
+			status = exitNoMatch
+		}
+		for _, s := range showRows(r.idx, shows) {
+			row := batchRow{Query: q, ID: s.ID, Date: s.Date, URL: s.URL}
+			if cw != nil {
+				err = cw.Write([]string{row.Query, strconv.Itoa(row.ID), row.Date, row.URL})
+			} else {
+				err = enc.Encode(row)
+			}
+			if err != nil {
+				return writeFailed(err)
+			}
+		}
+	}
+	if cw != nil {
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return writeFailed(err)
+		}
+	}
+	return status
+}
+
+func writeFailed(err error) int {
+	fmt.Fprintf(os.Stderr, "searcher: unable to write results: %v\n", err)
+	return exitFailed
+}
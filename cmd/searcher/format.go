@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/awbraunstein/setlist-search/index"
+	"github.com/awbraunstein/setlist-search/index/query"
+	"github.com/awbraunstein/setlist-search/searcher"
+)
+
+// Output formats.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatCSV   = "csv"
+)
+
+var formats = []string{formatTable, formatJSON, formatCSV}
+
+func validFormat(format string) bool {
+	for _, f := range formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// showRow is a show in the results of a query.
+type showRow struct {
+	ID       int    `json:"id"`
+	Date     string `json:"date"`
+	Venue    string `json:"venue,omitempty"`
+	Location string `json:"location,omitempty"`
+	Tour     string `json:"tour,omitempty"`
+	URL      string `json:"url"`
+}
+
+// showRows returns the rows of the shows ordered by date.
+func showRows(i *index.Index, shows []int) []showRow {
+	rows := make([]showRow, 0, len(shows))
+	for _, id := range shows {
+		sl := i.Show(id)
+		rows = append(rows, showRow{
+			ID:       id,
+			Date:     sl.Date,
+			Venue:    sl.Venue,
+			Location: sl.Location,
+			Tour:     sl.Tour,
+			URL:      sl.Url,
+		})
+	}
+	sort.Slice(rows, func(a, b int) bool {
+		if rows[a].Date != rows[b].Date {
+			return rows[a].Date < rows[b].Date
+		}
+		return rows[a].ID < rows[b].ID
+	})
+	return rows
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(v)
+}
+
+func writeCSV(w io.Writer, records [][]string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(records); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// printShows prints the shows that matched a query.
+func printShows(w io.Writer, format string, i *index.Index, shows []int) error {
+	rows := showRows(i, shows)
+	switch format {
+	case formatJSON:
+		return writeJSON(w, rows)
+	case formatCSV:
+		records := [][]string{{"id", "date", "venue", "location", "tour", "url"}}
+		for _, r := range rows {
+			records = append(records, []string{strconv.Itoa(r.ID), r.Date, r.Venue, r.Location, r.Tour, r.URL})
+		}
+		return writeCSV(w, records)
+	}
+	fmt.Fprintf(w, "Matched %d shows\n", len(rows))
+	if len(rows) == 0 {
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tDATE\tVENUE\tLOCATION")
+	for _, r := range rows {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", r.ID, r.Date, r.Venue, r.Location)
+	}
+	return tw.Flush()
+}
+
+// sortedKeys returns the keys of counts in order.
+func sortedKeys(counts map[string]int) []string {
+	var keys []string
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// printStats prints the performance history of a song.
+func printStats(w io.Writer, format string, stats *index.SongStats) error {
+	switch format {
+	case formatJSON:
+		return writeJSON(w, stats)
+	case formatCSV:
+		records := [][]string{
+			{"group", "key", "value"},
+			{"song", "id", stats.Song},
+			{"song", "name", stats.Name},
+			{"song", "plays", strconv.Itoa(stats.Plays)},
+			{"song", "shows", strconv.Itoa(stats.Shows)},
+			{"song", "first_played", stats.FirstPlayed},
+			{"song", "last_played", stats.LastPlayed},
+			{"song", "current_gap", strconv.Itoa(stats.CurrentGap)},
+			{"song", "average_gap", strconv.FormatFloat(stats.AverageGap, 'f', 1, 64)},
+			{"song", "max_gap", strconv.Itoa(stats.MaxGap)},
+		}
+		groups := []struct {
+			name   string
+			counts map[string]int
+		}{
+			{"year", stats.ByYear},
+			{"set", stats.BySet},
+			{"position", stats.ByPosition},
+		}
+		for _, g := range groups {
+			for _, k := range sortedKeys(g.counts) {
+				records = append(records, []string{g.name, k, strconv.Itoa(g.counts[k])})
+			}
+		}
+		return writeCSV(w, records)
+	}
+	fmt.Fprintf(w, "%s (%s)\n", stats.Name, stats.Song)
+	fmt.Fprintf(w, "Played %d times in %d shows\n", stats.Plays, stats.Shows)
+	fmt.Fprintf(w, "First played: %s\nLast played: %s\n", stats.FirstPlayed, stats.LastPlayed)
+	fmt.Fprintf(w, "Current gap: %d\nAverage gap: %.1f\nMax gap: %d\n", stats.CurrentGap, stats.AverageGap, stats.MaxGap)
+	printCounts(w, "By year", stats.ByYear)
+	printCounts(w, "By set", stats.BySet)
+	printCounts(w, "By position", stats.ByPosition)
+	return nil
+}
+
+func printCounts(w io.Writer, title string, counts map[string]int) {
+	fmt.Fprintf(w, "%s:\n", title)
+	for _, k := range sortedKeys(counts) {
+		fmt.Fprintf(w, "  %s: %d\n", k, counts[k])
+	}
+}
+
+// setRow is a set of a show.
+type setRow struct {
+	Name  string   `json:"name"`
+	Label string   `json:"label"`
+	Songs []string `json:"songs"`
+	// Connectors join each song to the next one: ",", ">" or "->".
+	Connectors []string `json:"connectors,omitempty"`
+}
+
+// printShow prints the setlist of a show.
+func printShow(w io.Writer, format string, i *index.Index, sl *searcher.Setlist) error {
+	switch format {
+	case formatJSON:
+		var sets []setRow
+		for _, set := range sl.Sets {
+			row := setRow{Name: set.Name(), Label: set.Label(), Songs: set.Songs}
+			for n := 0; n < len(set.Songs)-1; n++ {
+				row.Connectors = append(row.Connectors, set.ConnectorAfter(n).String())
+			}
+			sets = append(sets, row)
+		}
+		return writeJSON(w, struct {
+			showRow
+			Sets       []setRow `json:"sets"`
+			Origin     string   `json:"origin,omitempty"`
+			Overridden bool     `json:"overridden,omitempty"`
+		}{showRows(i, []int{sl.ShowId})[0], sets, sl.Origin, sl.Overridden()})
+	case formatCSV:
+		records := [][]string{{"set", "position", "song", "connector"}}
+		for _, set := range sl.Sets {
+			for n, song := range set.Songs {
+				connector := ""
+				if n < len(set.Songs)-1 {
+					connector = set.ConnectorAfter(n).String()
+				}
+				records = append(records, []string{set.Name(), strconv.Itoa(n + 1), song, connector})
+			}
+		}
+		return writeCSV(w, records)
+	}
+	fmt.Fprintf(w, "%s", sl.Date)
+	if sl.Venue != "" {
+		fmt.Fprintf(w, " %s", sl.Venue)
+	}
+	if sl.Location != "" {
+		fmt.Fprintf(w, ", %s", sl.Location)
+	}
+	if sl.Tour != "" {
+		fmt.Fprintf(w, " (%s)", sl.Tour)
+	}
+	fmt.Fprintln(w)
+	for _, set := range sl.Sets {
+		var b strings.Builder
+		for n, song := range set.Songs {
+			if n > 0 {
+				if c := set.ConnectorAfter(n - 1); c == searcher.Break {
+					b.WriteString(", ")
+				} else {
+					b.WriteString(" " + c.String() + " ")
+				}
+			}
+			b.WriteString(i.SongName(song))
+		}
+		fmt.Fprintf(w, "%s: %s\n", set.Label(), b.String())
+	}
+	if sl.Url != "" {
+		fmt.Fprintln(w, sl.Url)
+	}
+	if sl.Overridden() {
+		fmt.Fprintf(w, "Includes manual corrections (origin %s)\n", sl.Origin)
+	}
+	return nil
+}
+
+// printExplanation prints how each part of a query matched the index.
+func printExplanation(w io.Writer, format string, e *index.Explanation, c query.Complexity) error {
+	if format == formatJSON {
+		return writeJSON(w, struct {
+			Complexity query.Complexity   `json:"complexity"`
+			Plan       *index.Explanation `json:"plan"`
+		}{c, e})
+	}
+	if format == formatCSV {
+		records := [][]string{{"depth", "op", "statement", "matches"}}
+		var walk func(e *index.Explanation, depth int)
+		walk = func(e *index.Explanation, depth int) {
+			records = append(records, []string{strconv.Itoa(depth), e.Op, e.Statement, strconv.Itoa(e.Matches)})
+			for _, child := range e.Children {
+				walk(child, depth+1)
+			}
+		}
+		walk(e, 0)
+		return writeCSV(w, records)
+	}
+	fmt.Fprintf(w, "%d terms and operators, %d levels of nesting, %d NOTs\n", c.Nodes, c.Depth, c.Nots)
+	var walk func(e *index.Explanation, indent string)
+	walk = func(e *index.Explanation, indent string) {
+		desc := e.Statement
+		if e.Op == "SONG" && e.Name != "" && e.Name != e.Statement {
+			desc += " (" + e.Name + ")"
+		} else if e.Op != "SONG" && e.Op != "FIELD" {
+			desc = e.Op
+		}
+		fmt.Fprintf(w, "%s%s: %d shows\n", indent, desc, e.Matches)
+		for _, child := range e.Children {
+			walk(child, indent+"  ")
+		}
+	}
+	walk(e, "")
+	return nil
+}
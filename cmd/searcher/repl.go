@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/awbraunstein/setlist-search/index"
+	"github.com/awbraunstein/setlist-search/index/query"
+	"github.com/awbraunstein/setlist-search/searcher"
+	"github.com/peterh/liner"
+)
+
+// Query modes.
+const (
+	// modeBoolean queries are song IDs and fields, such as venue:msg,
+	// combined with AND, OR and NOT.
+	modeBoolean = "boolean"
+	// modePattern queries are setlist patterns compiled by the searcher
+	// package.
+	modePattern = "pattern"
+)
+
+// errQuit is returned by exec when the user asks to quit.
+var errQuit = errors.New("quit")
+
+// command is a meta-command of the REPL.
+type command struct {
+	name, args, help string
+	run              func(r *repl, arg string) error
+}
+
+var commands []command
+
+func init() {
+	// :help refers to commands, so they're set in init to avoid an
+	// initialization loop.
+	commands = []command{
+		{":stats", "<song>", "print the performance history of a song", (*repl).stats},
+		{":show", "<id>", "print the setlist of a show", (*repl).show},
+		{":explain", "<query>", "print how each part of a boolean query matched", (*repl).explain},
+		{":mode", "pattern|boolean", "set the kind of query", (*repl).setMode},
+		{":format", "table|json|csv", "set the output format", (*repl).setFormat},
+		{":reload", "", "read the index again", (*repl).reload},
+		{":help", "", "print this help", (*repl).help},
+		{":quit", "", "exit", func(*repl, string) error { return errQuit }},
+	}
+}
+
+// repl reads queries and meta-commands, and prints their results.
+type repl struct {
+	path   string
+	idx    *index.Index
+	mode   string
+	format string
+	out    io.Writer
+}
+
+// load reads the index.
+func (r *repl) load() error {
+	start := time.Now()
+	i, _, err := index.ReadFile(r.path, index.ReadOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to read index: %v", err)
+	}
+	r.idx = i
+	fmt.Fprintf(os.Stderr, "Read %d shows from %s in %v\n", i.NumShows(), r.path, time.Since(start))
+	return nil
+}
+
+// exec runs a query or a meta-command.
+func (r *repl) exec(line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil
+	}
+	if !strings.HasPrefix(line, ":") {
+		return r.query(line)
+	}
+	name, arg := line, ""
+	if i := strings.IndexByte(line, ' '); i >= 0 {
+		name, arg = line[:i], strings.TrimSpace(line[i+1:])
+	}
+	for _, c := range commands {
+		if c.name == name || (name == ":q" && c.name == ":quit") {
+			return c.run(r, arg)
+		}
+	}
+	return fmt.Errorf("unknown command %s; try :help", name)
+}
+
+// search returns the shows that match a query in the current mode.
+func (r *repl) search(q string) ([]int, error) {
+	if r.mode == modePattern {
+		s, err := searcher.Compile(q)
+		if err != nil {
+			return nil, err
+		}
+		return r.idx.Match(context.Background(), s)
+	}
+	return r.idx.Query(context.Background(), q)
+}
+
+func (r *repl) query(q string) error {
+	start := time.Now()
+	shows, err := r.search(q)
+	if err != nil {
+		return err
+	}
+	if r.format == formatTable {
+		fmt.Fprintf(r.out, "Query took %v\n", time.Since(start))
+	}
+	return printShows(r.out, r.format, r.idx, shows)
+}
+
+func (r *repl) stats(song string) error {
+	if song == "" {
+		return errors.New("usage: :stats <song>")
+	}
+	stats, err := r.idx.Stats(song)
+	if err != nil {
+		return err
+	}
+	return printStats(r.out, r.format, stats)
+}
+
+func (r *repl) show(arg string) error {
+	id, err := strconv.Atoi(arg)
+	if err != nil {
+		return errors.New("usage: :show <id>")
+	}
+	sl := r.idx.Show(id)
+	if sl == nil {
+		return fmt.Errorf("no show with id %d", id)
+	}
+	return printShow(r.out, r.format, r.idx, sl)
+}
+
+func (r *repl) explain(q string) error {
+	if q == "" {
+		return errors.New("usage: :explain <query>")
+	}
+	stmt, err := r.idx.Parse(q)
+	if err != nil {
+		return err
+	}
+	e, err := r.idx.Explain(context.Background(), stmt)
+	if err != nil {
+		return err
+	}
+	return printExplanation(r.out, r.format, e, query.Measure(stmt))
+}
+
+func (r *repl) setMode(mode string) error {
+	switch mode {
+	case "":
+		fmt.Fprintln(r.out, r.mode)
+	case modeBoolean, modePattern:
+		r.mode = mode
+	default:
+		return fmt.Errorf("unknown mode %q; expected pattern or boolean", mode)
+	}
+	return nil
+}
+
+func (r *repl) setFormat(format string) error {
+	switch {
+	case format == "":
+		fmt.Fprintln(r.out, r.format)
+	case validFormat(format):
+		r.format = format
+	default:
+		return fmt.Errorf("unknown format %q; expected %s", format, strings.Join(formats, ", "))
+	}
+	return nil
+}
+
+func (r *repl) reload(string) error {
+	return r.load()
+}
+
+func (r *repl) help(string) error {
+	fmt.Fprintf(r.out, "Lines are %s queries unless they start with a command:\n", r.mode)
+	for _, c := range commands {
+		fmt.Fprintf(r.out, "  %-28s %s\n", strings.TrimSpace(c.name+" "+c.args), c.help)
+	}
+	return nil
+}
+
+// complete completes the word before pos: a command at the start of the line,
+// the argument of :mode and :format, and otherwise a song, keyword or field.
+func (r *repl) complete(line string, pos int) (head string, completions []string, tail string) {
+	head, tail = line[:pos], line[pos:]
+	start := strings.LastIndexAny(head, " ()[") + 1
+	head, word := head[:start], head[start:]
+
+	keywords := r.mode == modeBoolean
+	if strings.HasPrefix(line, ":") {
+		fields := strings.Fields(head)
+		if len(fields) == 0 {
+			for _, c := range commands {
+				if strings.HasPrefix(c.name, word) {
+					completions = append(completions, c.name+" ")
+				}
+			}
+			return head, completions, tail
+		}
+		var options []string
+		switch fields[0] {
+		case ":mode":
+			options = []string{modeBoolean, modePattern}
+		case ":format":
+			options = formats
+		case ":stats":
+			keywords = false
+		case ":explain":
+			keywords = true
+		default:
+			return head, nil, tail
+		}
+		if options != nil {
+			for _, o := range options {
+				if strings.HasPrefix(o, word) {
+					completions = append(completions, o)
+				}
+			}
+			return head, completions, tail
+		}
+	}
+
+	// Songs are written (song) in patterns, so close the parenthesis.
+	closeSong := r.mode == modePattern && strings.HasSuffix(head, "(") && !strings.HasPrefix(tail, ")")
+	for _, s := range r.idx.Suggest(word, index.MaxSuggestions) {
+		if (s.Kind == index.SuggestKeyword || s.Kind == index.SuggestField) && !keywords {
+			continue
+		}
+		if closeSong {
+			s.Value += ")"
+		}
+		completions = append(completions, s.Value)
+	}
+	return head, completions, tail
+}
+
+// historyFile returns the file the REPL's history is kept in.
+func historyFile() string {
+	return filepath.Clean(os.Getenv("HOME") + "/.setsearcher_history")
+}
+
+// run reads lines from the terminal with line editing until EOF or :quit.
+func (r *repl) run() error {
+	line := liner.NewLiner()
+	defer line.Close()
+	line.SetCtrlCAborts(true)
+	line.SetTabCompletionStyle(liner.TabPrints)
+	line.SetWordCompleter(r.complete)
+
+	history := historyFile()
+	if f, err := os.Open(history); err == nil {
+		line.ReadHistory(f)
+		f.Close()
+	}
+	defer func() {
+		f, err := os.Create(history)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to save history: %v\n", err)
+			return
+		}
+		defer f.Close()
+		if _, err := line.WriteHistory(f); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to save history: %v\n", err)
+		}
+	}()
+
+	for {
+		input, err := line.Prompt("> ")
+		if err == liner.ErrPromptAborted {
+			continue
+		}
+		if err == io.EOF {
+			fmt.Fprintln(r.out)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(input) != "" {
+			line.AppendHistory(input)
+		}
+		if err := r.exec(input); err == errQuit {
+			return nil
+		} else if err != nil {
+			fmt.Fprintf(r.out, "Error: %v\n", err)
+		}
+	}
+}
@@ -1,74 +1,85 @@
 package main
 
 import (
-	"bufio"
-	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
-	"path/filepath"
-	"sort"
-	"strings"
-	"time"
 
-	"github.com/awbraunstein/setlist-search/index"
+	"github.com/awbraunstein/setlist-search/config"
 )
 
-var usageMessage = `usage: searcher
+var usageMessage = `usage: searcher [-index file] [-mode boolean|pattern] [-format table|json|csv]
+       searcher [-index file] [-mode boolean|pattern] [-format json|csv] -q query
+       searcher [-index file] [-mode boolean|pattern] [-format json|csv] -f file
 
 searcher opens the index used by the setlist-search app. The index is the file
-named by $SETSEARCHERINDEX, or else $HOME/.setsearcherindex. It then allows for
-multiple queries on the index.
+given by -index, $SETSEARCHERINDEX, or else $HOME/.setsearcherindex.
+
+With -q or -f, searcher runs the query or the queries in the file, one per
+line, and writes a line for each matched show with the query, show ID, date and
+URL as JSON lines or CSV. Blank lines and lines starting with # are skipped,
+and the file - is stdin. The exit status is 0 if every query matched a show, 1
+if some query matched no shows, and 2 if something went wrong.
+
+Otherwise searcher reads queries interactively. Each line is a query, except
+for the commands:
+
+	:stats <song>		print the performance history of a song
+	:show <id>		print the setlist of a show
+	:explain <query>	print how each part of a boolean query matched
+	:mode pattern|boolean	set the kind of query
+	:format table|json|csv	set the output format
+	:reload			read the index again
+	:help			list the commands
+	:quit			exit
+
+Lines can be edited, and tab completes commands and song names. The history is
+kept in $HOME/.setsearcher_history.
+
+Flags:
 `
 
+var (
+	indexPath = flag.String("index", config.Default().Index.Path, "Location of the index")
+	format    = flag.String("format", "", "Output format: table, json or csv; the default is table, or json in batch mode")
+	mode      = flag.String("mode", modeBoolean, "Kind of query: boolean or pattern")
+	queryFlag = flag.String("q", "", "Run a single query and exit")
+	fileFlag  = flag.String("f", "", "Run the queries in a file and exit")
+)
+
 func usage() {
 	fmt.Fprintf(os.Stderr, usageMessage)
-	os.Exit(2)
-}
-
-func getIndexLocation() string {
-	if indexLocation := os.Getenv("SETSEARCHERINDEX"); indexLocation != "" {
-		return indexLocation
-	}
-	return filepath.Clean(os.Getenv("HOME") + "/.setsearcherindex")
+	flag.PrintDefaults()
+	os.Exit(exitFailed)
 }
 
 func main() {
 	flag.Usage = usage
 	flag.Parse()
-
-	idxLoc := getIndexLocation()
-	fmt.Printf("Opening index: %s\n", idxLoc)
-	start := time.Now()
-	f, err := os.Open(idxLoc)
-	if err != nil {
-		log.Fatalf("Unable to open index; %v\n", err)
+	batch := *queryFlag != "" || *fileFlag != ""
+	if *format == "" {
+		*format = formatTable
+		if batch {
+			*format = formatJSON
+		}
 	}
-	i, err := index.Read(f)
-	if err != nil {
-		log.Fatalf("Unable to read index; %v\n", err)
+	if flag.NArg() != 0 || !validFormat(*format) || (batch && *format == formatTable) ||
+		(*mode != modeBoolean && *mode != modePattern) {
+		usage()
 	}
-	fmt.Printf("Took %v to open index\n", time.Since(start))
-	scanner := bufio.NewScanner(os.Stdin)
-	fmt.Print("> ")
-	for scanner.Scan() {
-		line := scanner.Text()
-		start := time.Now()
-		shows, err := i.Query(context.Background(), line)
-		fmt.Printf("Query took %v\n", time.Since(start))
-		if err != nil {
-			fmt.Printf("Error processing query: %v\n", err)
-			continue
+
+	r := &repl{path: *indexPath, mode: *mode, format: *format, out: os.Stdout}
+	if !batch {
+		if err := r.load(); err != nil {
+			log.Fatal(err)
 		}
-		var dates []string
-		for _, show := range shows {
-			dates = append(dates, i.ShowDate(show))
+		if err := r.run(); err != nil {
+			log.Fatal(err)
 		}
-		sort.Strings(dates)
-
-		fmt.Printf("Matched shows %d:\n%v\n", len(dates), strings.Join(dates, ", "))
-		fmt.Print("> ")
+		fmt.Fprintln(os.Stderr, "Goodbye")
+		return
 	}
-	fmt.Println("Goodbye")
+
+	os.Exit(r.runBatch(*queryFlag, *fileFlag))
 }
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testIndex = `setsearcher index 2
+[SONGS]
+Fee|fee
+Mike's Song|mikes-song
+You Enjoy Myself|you-enjoy-myself
+[END]
+[ALIASES]
+you-enjoy-myself|YEM
+[END]
+[SETLISTS]
+ID{1}DATE{1997-11-22}URL{http://phish.net/1}VENUE{Hampton Coliseum}SET1{mikes-song->fee}ENCORE{you-enjoy-myself}
+ID{2}DATE{1998-04-02}URL{http://phish.net/2}SET1{fee}
+[END]`
+
+// writeTemp writes the files to a new directory, which the returned func
+// removes.
+func writeTemp(t *testing.T, files map[string]string) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "searcher")
+	if err != nil {
+		t.Fatalf("unable to create temp dir; %v", err)
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			os.RemoveAll(dir)
+			t.Fatalf("unable to write %s; %v", name, err)
+		}
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestReadQueries(t *testing.T) {
+	dir, cleanup := writeTemp(t, map[string]string{"queries": "fee\n\n# a comment\n  YEM AND fee  \n"})
+	defer cleanup()
+	got, err := readQueries(filepath.Join(dir, "queries"))
+	if err != nil {
+		t.Fatalf("readQueries got unexpected error: %v", err)
+	}
+	if want := []string{"fee", "YEM AND fee"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("readQueries got %q, but expected %q", got, want)
+	}
+	if _, err := readQueries(filepath.Join(dir, "missing")); err == nil {
+		t.Error("readQueries of a missing file expected an error, but got nil")
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	dir, cleanup := writeTemp(t, map[string]string{
+		"index":    testIndex,
+		"matching": "fee\nYEM\n",
+		"mixed":    "fee\nreba\n",
+		"bad":      "fee\nfee AND\nreba\n",
+	})
+	defer cleanup()
+	tests := []struct {
+		name      string
+		index     string
+		mode      string
+		format    string
+		q, file   string
+		want      int
+		wantLines int
+	}{
+		{name: "match", q: "fee", want: exitMatched, wantLines: 2},
+		{name: "no match", q: "reba", want: exitNoMatch},
+		{name: "bad query", q: "fee AND", want: exitFailed},
+		{name: "file", file: "matching", want: exitMatched, wantLines: 3},
+		{name: "query and file", q: "reba", file: "matching", want: exitNoMatch, wantLines: 3},
+		{name: "some queries match nothing", file: "mixed", want: exitNoMatch, wantLines: 2},
+		{name: "failures win over no matches", file: "bad", want: exitFailed, wantLines: 2},
+		{name: "pattern", mode: modePattern, q: "(mikes-song)->(fee)", want: exitMatched, wantLines: 1},
+		{name: "csv", format: formatCSV, q: "fee", want: exitMatched, wantLines: 3},
+		{name: "missing file", file: "missing", want: exitFailed},
+		{name: "missing index", index: "missing", q: "fee", want: exitFailed},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			r := &repl{path: filepath.Join(dir, "index"), mode: modeBoolean, format: formatJSON, out: &out}
+			if tc.index != "" {
+				r.path = filepath.Join(dir, tc.index)
+			}
+			if tc.mode != "" {
+				r.mode = tc.mode
+			}
+			if tc.format != "" {
+				r.format = tc.format
+			}
+			file := tc.file
+			if file != "" {
+				file = filepath.Join(dir, file)
+			}
+			if got := r.runBatch(tc.q, file); got != tc.want {
+				t.Errorf("runBatch got exit status %d, but expected %d", got, tc.want)
+			}
+			if got := strings.Count(out.String(), "\n"); got != tc.wantLines {
+				t.Errorf("runBatch wrote %d lines, but expected %d:\n%s", got, tc.wantLines, out.String())
+			}
+		})
+	}
+}
+
+func TestExec(t *testing.T) {
+	dir, cleanup := writeTemp(t, map[string]string{"index": testIndex})
+	defer cleanup()
+	var out bytes.Buffer
+	r := &repl{path: filepath.Join(dir, "index"), mode: modeBoolean, format: formatTable, out: &out}
+	if err := r.load(); err != nil {
+		t.Fatalf("load got unexpected error: %v", err)
+	}
+	tests := []struct {
+		line string
+		// want is a string the output must contain, and err one that the
+		// error must contain.
+		want, err string
+	}{
+		{line: "YEM", want: "Matched 1 shows"},
+		{line: ":show 1", want: "Encore: You Enjoy Myself"},
+		{line: ":show x", err: "usage: :show <id>"},
+		{line: ":show 3", err: "no show with id 3"},
+		{line: ":stats fee", want: "fee"},
+		{line: ":explain fee AND NOT YEM", want: "AND"},
+		{line: ":explain fee AND venue:hampton", want: `venue:"hampton": 1 shows`},
+		{line: ":mode", want: modeBoolean},
+		{line: ":mode pattern"},
+		{line: "(mikes-song)->(fee)", want: "Matched 1 shows"},
+		{line: ":mode regex", err: `unknown mode "regex"`},
+		{line: ":format json"},
+		{line: ":show 2", want: `"date": "1998-04-02"`},
+		{line: ":format xml", err: `unknown format "xml"`},
+		{line: ":reload"},
+		{line: ":help", want: ":quit"},
+		{line: ":nope", err: "unknown command :nope"},
+		{line: "   "},
+	}
+	for _, tc := range tests {
+		out.Reset()
+		err := r.exec(tc.line)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("exec(%q) got error %v, but expected one containing %q", tc.line, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("exec(%q) got unexpected error: %v", tc.line, err)
+			continue
+		}
+		if !strings.Contains(out.String(), tc.want) {
+			t.Errorf("exec(%q) wrote %q, but expected it to contain %q", tc.line, out.String(), tc.want)
+		}
+	}
+	for _, line := range []string{":quit", ":q"} {
+		if err := r.exec(line); err != errQuit {
+			t.Errorf("exec(%q) got %v, but expected errQuit", line, err)
+		}
+	}
+}
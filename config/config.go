@@ -0,0 +1,236 @@
+// Package config loads the configuration of the setlist-search binaries.
+//
+// Every setting has a flag. A setting can also be given by an environment
+// variable named SETSEARCHER_ followed by the upper case flag name, or by a key
+// named after the flag in a YAML file given with -config or
+// $SETSEARCHER_CONFIG. Flags take precedence over environment variables, which
+// take precedence over the file.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/awbraunstein/setlist-search/index/query"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// envPrefix is prepended to the upper case flag name to get the environment
+// variable of a setting.
+const envPrefix = "SETSEARCHER_"
+
+// configFlag is the flag naming the config file.
+const configFlag = "config"
+
+// Config is the configuration of the server and the indexer.
+type Config struct {
+	// Addr is the address the server listens on.
+	Addr string
+	// Index is where the index is read from and written to.
+	Index Index
+	// ReadTimeout and WriteTimeout limit the time the server spends reading
+	// a request and writing its response.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// RequestTimeout limits the time spent handling a request.
+	RequestTimeout time.Duration
+	// ShutdownTimeout is how long the server waits for in-flight requests
+	// when shutting down.
+	ShutdownTimeout time.Duration
+	// QueryCacheBytes is the size of the query result cache.
+	QueryCacheBytes int64
+	// MaxIndexAge is the age after which the server reports that it isn't
+	// ready.
+	MaxIndexAge time.Duration
+	// Analytics is whether pages include the analytics templates.
+	Analytics bool
+	// QueryLimits bounds the complexity of search queries.
+	QueryLimits query.Limits
+	// RateLimit is the number of requests per second allowed from each
+	// client, and RateLimitBurst the number it may make at once.
+	RateLimit      float64
+	RateLimitBurst int
+	// TrustedProxies is a comma separated list of the IPs and CIDRs of the
+	// proxies whose X-Forwarded-For and X-Real-IP headers identify clients.
+	TrustedProxies string
+}
+
+// Index describes where the index lives.
+type Index struct {
+	// Remote is whether the index is stored in Google Cloud Storage rather
+	// than Path.
+	Remote bool
+	// Path is the local index file.
+	Path string
+	// Bucket and Object locate the remote index.
+	Bucket string
+	Object string
+	// Project and Topic name the Pub/Sub topic that announces changes to the
+	// remote index.
+	Project string
+	Topic   string
+}
+
+// defaultIndexPath returns the file named by $SETSEARCHERINDEX, or else
+// $HOME/.setsearcherindex.
+func defaultIndexPath() string {
+	if indexLocation := os.Getenv("SETSEARCHERINDEX"); indexLocation != "" {
+		return indexLocation
+	}
+	return filepath.Clean(os.Getenv("HOME") + "/.setsearcherindex")
+}
+
+// Default returns the default configuration.
+func Default() *Config {
+	return &Config{
+		Addr: ":8080",
+		Index: Index{
+			Remote:  true,
+			Path:    defaultIndexPath(),
+			Bucket:  "setlist-searcher-index",
+			Object:  "index.txt",
+			Project: "setlist-searcher",
+			Topic:   "indexer",
+		},
+		ReadTimeout:     15 * time.Second,
+		WriteTimeout:    30 * time.Second,
+		RequestTimeout:  10 * time.Second,
+		ShutdownTimeout: 20 * time.Second,
+		QueryCacheBytes: 32 << 20,
+		Analytics:       true,
+		QueryLimits: query.Limits{
+			MaxNodes: 200,
+			MaxDepth: 32,
+			MaxNots:  20,
+		},
+		RateLimit:      5,
+		RateLimitBurst: 20,
+	}
+}
+
+// RegisterIndexFlags defines the flags describing the index location.
+func (c *Config) RegisterIndexFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&c.Index.Remote, "remote_index", c.Index.Remote, "Whether the index is stored in Google Cloud Storage")
+	fs.StringVar(&c.Index.Path, "index", c.Index.Path, "Location of the local index")
+	fs.StringVar(&c.Index.Bucket, "index_bucket", c.Index.Bucket, "Bucket of the remote index")
+	fs.StringVar(&c.Index.Object, "index_object", c.Index.Object, "Object name of the remote index")
+}
+
+// RegisterServerFlags defines the flags of the server, including the index
+// flags.
+func (c *Config) RegisterServerFlags(fs *flag.FlagSet) {
+	c.RegisterIndexFlags(fs)
+	fs.StringVar(&c.Index.Project, "index_project", c.Index.Project, "Project of the topic announcing index changes")
+	fs.StringVar(&c.Index.Topic, "index_topic", c.Index.Topic, "Topic announcing index changes")
+	fs.StringVar(&c.Addr, "http", c.Addr, "Listen address")
+	fs.DurationVar(&c.ReadTimeout, "read_timeout", c.ReadTimeout, "Maximum time to read a request; 0 means no limit")
+	fs.DurationVar(&c.WriteTimeout, "write_timeout", c.WriteTimeout, "Maximum time to write a response; 0 means no limit")
+	fs.DurationVar(&c.RequestTimeout, "request_timeout", c.RequestTimeout, "Maximum time to handle a request; 0 means no limit")
+	fs.DurationVar(&c.ShutdownTimeout, "shutdown_timeout", c.ShutdownTimeout, "How long to wait for in-flight requests when shutting down")
+	fs.Int64Var(&c.QueryCacheBytes, "query_cache_bytes", c.QueryCacheBytes, "Maximum size of the query result cache in bytes; 0 disables it")
+	fs.DurationVar(&c.MaxIndexAge, "max_index_age", c.MaxIndexAge, "Maximum age of the index before the server reports that it isn't ready; 0 disables the check")
+	fs.BoolVar(&c.Analytics, "analytics", c.Analytics, "Whether pages include analytics")
+	fs.IntVar(&c.QueryLimits.MaxNodes, "max_query_nodes", c.QueryLimits.MaxNodes, "Maximum number of terms and operators in a query; 0 means no limit")
+	fs.IntVar(&c.QueryLimits.MaxDepth, "max_query_depth", c.QueryLimits.MaxDepth, "Maximum nesting of a query; 0 means no limit")
+	fs.IntVar(&c.QueryLimits.MaxNots, "max_query_nots", c.QueryLimits.MaxNots, "Maximum number of NOTs in a query; 0 means no limit")
+	fs.Float64Var(&c.RateLimit, "rate_limit", c.RateLimit, "Requests per second allowed from each client IP; 0 disables rate limiting")
+	fs.IntVar(&c.RateLimitBurst, "rate_limit_burst", c.RateLimitBurst, "Number of requests each client IP may make at once")
+	fs.StringVar(&c.TrustedProxies, "trusted_proxies", c.TrustedProxies, "Comma separated IPs and CIDRs of proxies whose X-Forwarded-For and X-Real-IP headers are trusted")
+}
+
+// envName returns the environment variable of a flag.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(flagName)
+}
+
+// Load parses args with fs, whose flags must already be registered, and
+// applies the config file and environment variables underneath them.
+func Load(fs *flag.FlagSet, args []string) error {
+	path := fs.String(configFlag, os.Getenv(envName(configFlag)), "YAML file of settings keyed by flag name")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// Remember the flags that were given, since the file and environment
+	// variables are applied over them and they must win.
+	given := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = f.Value.String()
+	})
+	if *path != "" {
+		if err := loadFile(fs, *path); err != nil {
+			return err
+		}
+	}
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == configFlag || err != nil {
+			return
+		}
+		if value, ok := os.LookupEnv(envName(f.Name)); ok {
+			if setErr := fs.Set(f.Name, value); setErr != nil {
+				err = errors.Wrapf(setErr, "invalid $%s", envName(f.Name))
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for name, value := range given {
+		if err := fs.Set(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadFile applies the settings in a YAML file.
+func loadFile(fs *flag.FlagSet, path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "unable to read config")
+	}
+	settings := make(map[string]interface{})
+	if err := yaml.Unmarshal(b, &settings); err != nil {
+		return errors.Wrapf(err, "unable to parse config %s", path)
+	}
+	for name, value := range settings {
+		if name == configFlag || fs.Lookup(name) == nil {
+			return fmt.Errorf("unknown setting %q in config %s", name, path)
+		}
+		if err := fs.Set(name, fmt.Sprint(value)); err != nil {
+			return errors.Wrapf(err, "invalid setting %q in config %s", name, path)
+		}
+	}
+	return nil
+}
+
+// Effective returns the settings of fs as a YAML config file.
+func Effective(fs *flag.FlagSet) string {
+	var settings yaml.MapSlice
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == configFlag {
+			return
+		}
+		var value interface{} = f.Value.String()
+		// Keep bools and numbers unquoted, but write durations as strings.
+		if g, ok := f.Value.(flag.Getter); ok {
+			if _, ok := g.Get().(time.Duration); !ok {
+				value = g.Get()
+			}
+		}
+		settings = append(settings, yaml.MapItem{Key: f.Name, Value: value})
+	})
+	b, err := yaml.Marshal(settings)
+	if err != nil {
+		// Flag values are plain strings, numbers and bools, which always
+		// marshal.
+		panic(err)
+	}
+	return string(b)
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig writes a config file to a temporary directory and returns its
+// path.
+func writeConfig(t *testing.T, contents string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("unable to write config: %v", err)
+	}
+	return path
+}
+
+func load(args ...string) (*Config, *flag.FlagSet, error) {
+	cfg := Default()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	cfg.RegisterServerFlags(fs)
+	return cfg, fs, Load(fs, args)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfig(t, `
+http: ":9000"
+query_cache_bytes: 1024
+read_timeout: 1m
+analytics: false
+index_bucket: file-bucket
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+	os.Setenv("SETSEARCHER_QUERY_CACHE_BYTES", "2048")
+	os.Setenv("SETSEARCHER_INDEX_BUCKET", "env-bucket")
+	defer os.Unsetenv("SETSEARCHER_QUERY_CACHE_BYTES")
+	defer os.Unsetenv("SETSEARCHER_INDEX_BUCKET")
+
+	cfg, _, err := load("-config", path, "-index_bucket", "flag-bucket", "-remote_index=false")
+	if err != nil {
+		t.Fatalf("Load got unexpected error: %v", err)
+	}
+	want := Default()
+	want.Addr = ":9000"
+	want.QueryCacheBytes = 2048
+	want.ReadTimeout = time.Minute
+	want.Analytics = false
+	want.Index.Bucket = "flag-bucket"
+	want.Index.Remote = false
+	if *cfg != *want {
+		t.Errorf("got config %+v, but expected %+v", cfg, want)
+	}
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	path := writeConfig(t, "http: :9000\n")
+	defer os.RemoveAll(filepath.Dir(path))
+	os.Setenv("SETSEARCHER_CONFIG", path)
+	defer os.Unsetenv("SETSEARCHER_CONFIG")
+
+	cfg, _, err := load()
+	if err != nil {
+		t.Fatalf("Load got unexpected error: %v", err)
+	}
+	if cfg.Addr != ":9000" {
+		t.Errorf("got address %q, but expected %q", cfg.Addr, ":9000")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name, config, env, want string
+	}{
+		{name: "unknown setting", config: "bogus: 1\n", want: `unknown setting "bogus"`},
+		{name: "bad file value", config: "read_timeout: soon\n", want: `invalid setting "read_timeout"`},
+		{name: "bad yaml", config: "http: [\n", want: "unable to parse config"},
+		{name: "bad env value", env: "soon", want: "invalid $SETSEARCHER_READ_TIMEOUT"},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var args []string
+			if tc.config != "" {
+				path := writeConfig(t, tc.config)
+				defer os.RemoveAll(filepath.Dir(path))
+				args = append(args, "-config", path)
+			}
+			if tc.env != "" {
+				os.Setenv("SETSEARCHER_READ_TIMEOUT", tc.env)
+				defer os.Unsetenv("SETSEARCHER_READ_TIMEOUT")
+			}
+			_, _, err := load(args...)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Load got error %v, but expected one containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestEffectiveRoundTrips(t *testing.T) {
+	cfg, fs, err := load("-http", ":9000", "-max_index_age", "72h", "-analytics=false")
+	if err != nil {
+		t.Fatalf("Load got unexpected error: %v", err)
+	}
+	effective := Effective(fs)
+	if !strings.Contains(effective, "max_index_age: 72h0m0s\n") {
+		t.Errorf("effective config doesn't contain max_index_age:\n%s", effective)
+	}
+
+	path := writeConfig(t, effective)
+	defer os.RemoveAll(filepath.Dir(path))
+	reloaded, _, err := load("-config", path)
+	if err != nil {
+		t.Fatalf("Load got unexpected error reloading the effective config: %v", err)
+	}
+	if *reloaded != *cfg {
+		t.Errorf("got config %+v after reloading, but expected %+v", reloaded, cfg)
+	}
+}
@@ -7,9 +7,12 @@ require (
 	github.com/awbraunstein/echo-trace v0.0.0-20190311053559-cda3030d0828
 	github.com/awbraunstein/gophish v0.0.0-20190404233629-71061dd7e2b4
 	github.com/labstack/echo/v4 v4.0.0
+	github.com/mattn/go-sqlite3 v1.14.6
+	github.com/peterh/liner v1.1.1-0.20190123174540-a2c9a5303de7
 	github.com/pkg/errors v0.8.1
+	github.com/prometheus/client_golang v0.9.3-0.20190127221311-3c4408c8b829
 	golang.org/x/crypto v0.0.0-20190308221718-c2843e01d9a2
 	golang.org/x/net v0.0.0-20190311183353-d8887717615a
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
-	gopkg.in/yaml.v2 v2.2.2 // indirect
+	gopkg.in/yaml.v2 v2.2.2
 )
@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/awbraunstein/setlist-search/index"
+	"github.com/awbraunstein/setlist-search/internal"
+	"github.com/labstack/echo/v4"
+)
+
+// QueryCacheStats returns the hit, miss and size statistics of the query
+// cache.
+func QueryCacheStats(c echo.Context) error {
+	cache, ok := c.Get(internal.CacheContextKey).(*index.Cache)
+	if !ok {
+		return notFound("The query cache is disabled")
+	}
+	return c.JSON(http.StatusOK, cache.Stats())
+}
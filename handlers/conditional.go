@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/awbraunstein/setlist-search/index"
+	"github.com/labstack/echo/v4"
+)
+
+// indexETag returns the entity tag of responses that only depend on the
+// request and the index. It's weak since responses may be compressed.
+func indexETag(idx *index.Index) string {
+	return `W/"` + idx.Hash() + `"`
+}
+
+// etagMatches reports whether an If-None-Match header matches etag, using
+// the weak comparison.
+func etagMatches(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified sets the ETag and Last-Modified headers of a response that only
+// depends on the request and the index, and reports whether the client's copy
+// is still current so that a 304 can be sent instead.
+func notModified(c echo.Context, idx *index.Index) bool {
+	etag := indexETag(idx)
+	modTime := idx.ModTime().UTC().Truncate(time.Second)
+	header := c.Response().Header()
+	header.Set("ETag", etag)
+	header.Set("Last-Modified", modTime.Format(http.TimeFormat))
+
+	req := c.Request()
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, etag)
+	}
+	if ims := req.Header.Get("If-Modified-Since"); ims != "" {
+		t, err := http.ParseTime(ims)
+		return err == nil && !modTime.After(t)
+	}
+	return false
+}
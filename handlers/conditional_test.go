@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/awbraunstein/setlist-search/index"
+)
+
+func TestConditionalGet(t *testing.T) {
+	modTime := time.Date(2019, 4, 1, 12, 0, 0, 0, time.UTC)
+	idx, _, err := index.ReadWithOptions(strings.NewReader(testIndex), index.ReadOptions{ModTime: modTime})
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	e := newServer(idx)
+	e.GET("/api/searchboxconfig", SearchBoxConfigAPI)
+	etag := `W/"` + idx.Hash() + `"`
+
+	for _, target := range []string{"/api/searchboxconfig", "/api/search?query=fee", "/api/v2/search?query=fee"} {
+		rec := serve(e, http.MethodGet, target, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s got status %d, but expected %d", target, rec.Code, http.StatusOK)
+		}
+		if got := rec.Header().Get("ETag"); got != etag {
+			t.Errorf("GET %s got ETag %q, but expected %q", target, got, etag)
+		}
+		if got, want := rec.Header().Get("Last-Modified"), "Mon, 01 Apr 2019 12:00:00 GMT"; got != want {
+			t.Errorf("GET %s got Last-Modified %q, but expected %q", target, got, want)
+		}
+
+		tests := []struct {
+			header, value string
+			want          int
+		}{
+			{"If-None-Match", etag, http.StatusNotModified},
+			{"If-None-Match", `"other", ` + strings.TrimPrefix(etag, "W/"), http.StatusNotModified},
+			{"If-None-Match", "*", http.StatusNotModified},
+			{"If-None-Match", `W/"other"`, http.StatusOK},
+			{"If-Modified-Since", "Mon, 01 Apr 2019 12:00:00 GMT", http.StatusNotModified},
+			{"If-Modified-Since", "Mon, 01 Apr 2019 11:59:59 GMT", http.StatusOK},
+		}
+		for _, tc := range tests {
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			req.Header.Set(tc.header, tc.value)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Errorf("GET %s with %s: %s got status %d, but expected %d", target, tc.header, tc.value, rec.Code, tc.want)
+			}
+			if tc.want == http.StatusNotModified && rec.Body.Len() != 0 {
+				t.Errorf("GET %s got a body with a 304: %q", target, rec.Body)
+			}
+		}
+	}
+
+	// A new index gets a new tag.
+	next, err := index.Read(strings.NewReader(strings.Replace(testIndex, "SET1{fee}", "SET1{fee,reba}", 1)))
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/search?query=fee", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec := httptest.NewRecorder()
+	newServer(next).ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("got status %d for a new index, but expected %d", rec.Code, http.StatusOK)
+	}
+
+	// Errors don't carry validators.
+	rec = serve(e, http.MethodGet, "/api/search?query=fee%20AND", "")
+	if got := rec.Header().Get("ETag"); rec.Code != http.StatusBadRequest || got != "" {
+		t.Errorf("got status %d and ETag %q for a bad query, but expected a 400 without an ETag", rec.Code, got)
+	}
+
+	// A bad request is an error even when the client's copy is current.
+	for _, target := range []string{
+		"/api/search?query=fee%20AND",
+		"/api/search?query=fee&limit=-1",
+		"/api/v2/search?query=fee%20AND",
+		"/api/v2/search?query=fee&fields=id,setlist",
+		"/api/v2/search?query=fee&limit=-1",
+		"/api/v2/search?query=fee&sort=relevance",
+	} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("If-None-Match", etag)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("GET %s with a matching ETag got status %d, but expected %d", target, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	echotrace "github.com/awbraunstein/echo-trace"
+	"github.com/awbraunstein/setlist-search/index"
+	"github.com/awbraunstein/setlist-search/index/query"
+	"github.com/awbraunstein/setlist-search/internal"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"golang.org/x/net/trace"
+)
+
+// ErrorKind classifies the errors that handlers report to clients.
+type ErrorKind int
+
+const (
+	// KindInternal is an unexpected failure of the server.
+	KindInternal ErrorKind = iota
+	// KindBadRequest is a request with missing or invalid params.
+	KindBadRequest
+	// KindBadQuery is a search query that couldn't be parsed.
+	KindBadQuery
+	// KindNotFound is a request for a show or song that doesn't exist.
+	KindNotFound
+	// KindTimeout is a request that ran out of time.
+	KindTimeout
+	// KindIndexUnavailable is a request that arrived before an index was
+	// loaded.
+	KindIndexUnavailable
+	// KindQueryTooComplex is a search query that exceeds the complexity
+	// limits.
+	KindQueryTooComplex
+)
+
+var errorKinds = map[ErrorKind]struct {
+	code   string
+	status int
+}{
+	KindInternal:         {"internal", http.StatusInternalServerError},
+	KindBadRequest:       {"bad_request", http.StatusBadRequest},
+	KindBadQuery:         {"bad_query", http.StatusBadRequest},
+	KindNotFound:         {"not_found", http.StatusNotFound},
+	KindTimeout:          {"timeout", http.StatusGatewayTimeout},
+	KindIndexUnavailable: {"index_unavailable", http.StatusServiceUnavailable},
+	KindQueryTooComplex:  {"query_too_complex", http.StatusUnprocessableEntity},
+}
+
+// Code returns the code of the kind that's used in JSON error bodies.
+func (k ErrorKind) Code() string {
+	return errorKinds[k].code
+}
+
+// Status returns the HTTP status code of the kind.
+func (k ErrorKind) Status() int {
+	return errorKinds[k].status
+}
+
+// Error is an error that's reported to the client. Message is shown to the
+// client, while Err is only logged.
+type Error struct {
+	Kind    ErrorKind
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Kind.Code(), e.Message, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Kind.Code(), e.Message)
+}
+
+func badRequest(message string) error {
+	return &Error{Kind: KindBadRequest, Message: message}
+}
+
+func notFound(message string) error {
+	return &Error{Kind: KindNotFound, Message: message}
+}
+
+// indexError classifies an error returned by the index.
+func indexError(err error) error {
+	if qe, ok := errors.Cause(err).(*index.QueryError); ok {
+		return &Error{Kind: KindBadQuery, Message: qe.Err.Error(), Err: err}
+	}
+	if ce, ok := errors.Cause(err).(*query.ComplexityError); ok {
+		return &Error{Kind: KindQueryTooComplex, Message: ce.Error(), Err: err}
+	}
+	switch errors.Cause(err) {
+	case index.ErrUnknownSong:
+		return &Error{Kind: KindNotFound, Message: "Unknown song", Err: err}
+	case context.DeadlineExceeded:
+		return &Error{Kind: KindTimeout, Message: "Query timed out", Err: err}
+	}
+	return &Error{Kind: KindInternal, Message: "Internal Error", Err: err}
+}
+
+// getIndex returns the index that was injected into the context.
+func getIndex(c echo.Context) (*index.Index, error) {
+	idx, ok := c.Get(internal.InjectorContextKey).(*index.Index)
+	if !ok || idx == nil {
+		return nil, &Error{Kind: KindIndexUnavailable, Message: "The index isn't available yet"}
+	}
+	return idx, nil
+}
+
+// tracef logs to the request's trace, if it has one.
+func tracef(c echo.Context, format string, args ...interface{}) {
+	if tr, ok := c.Get(echotrace.ContextKey).(trace.Trace); ok {
+		tr.LazyPrintf(format, args...)
+	}
+}
+
+// ErrorBody is the JSON body of every error returned by the api.
+type ErrorBody struct {
+	Error ErrorDetails `json:"error"`
+}
+
+// ErrorDetails describes an error returned by the api.
+type ErrorDetails struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// errorDetails converts any error returned by a handler or by echo itself into
+// the details that are shown to the client.
+func errorDetails(err error) ErrorDetails {
+	switch e := err.(type) {
+	case *Error:
+		return ErrorDetails{Status: e.Kind.Status(), Code: e.Kind.Code(), Message: e.Message}
+	case *echo.HTTPError:
+		code := strings.Replace(strings.ToLower(http.StatusText(e.Code)), " ", "_", -1)
+		if code == "" {
+			code = KindInternal.Code()
+		}
+		return ErrorDetails{Status: e.Code, Code: code, Message: fmt.Sprint(e.Message)}
+	}
+	return ErrorDetails{Status: http.StatusInternalServerError, Code: KindInternal.Code(), Message: "Internal Error"}
+}
+
+type errorTemplateData struct {
+	Status  int
+	Message string
+}
+
+// HTTPErrorHandler reports errors returned by handlers. Requests to /api/
+// get a JSON ErrorBody, and pages get the error template.
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+	details := errorDetails(err)
+	tracef(c, "Error handling request: %v", err)
+	// Errors aren't cacheable like the responses they replace.
+	header := c.Response().Header()
+	header.Del("ETag")
+	header.Del("Last-Modified")
+	if details.Status >= http.StatusInternalServerError {
+		c.Logger().Error(err)
+	}
+
+	var rerr error
+	switch {
+	case c.Request().Method == http.MethodHead:
+		rerr = c.NoContent(details.Status)
+	case strings.HasPrefix(c.Request().URL.Path, "/api/"):
+		rerr = c.JSON(details.Status, &ErrorBody{Error: details})
+	default:
+		rerr = c.Render(details.Status, "error.tmpl", &errorTemplateData{Status: details.Status, Message: details.Message})
+		if rerr != nil && !c.Response().Committed {
+			rerr = c.String(details.Status, details.Message)
+		}
+	}
+	if rerr != nil {
+		c.Logger().Error(rerr)
+	}
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/awbraunstein/setlist-search/index/query"
+	"github.com/awbraunstein/setlist-search/internal"
+)
+
+func TestAPIErrors(t *testing.T) {
+	e := newTestServer(t)
+	tests := []struct {
+		target string
+		want   ErrorDetails
+	}{
+		{
+			target: "/api/search",
+			want:   ErrorDetails{Status: http.StatusBadRequest, Code: "bad_request", Message: "Missing query param"},
+		}, {
+			target: "/api/search?query=fee%20AND",
+			want:   ErrorDetails{Status: http.StatusBadRequest, Code: "bad_query", Message: "missing operand for AND"},
+		}, {
+			target: "/api/search?query=fee&sort=relevance",
+			want:   ErrorDetails{Status: http.StatusBadRequest, Code: "bad_request", Message: "Invalid sort param"},
+		}, {
+			target: "/api/v2/search?query=fee&fields=id,setlist",
+			want:   ErrorDetails{Status: http.StatusBadRequest, Code: "bad_request", Message: "Unknown field: setlist"},
+		}, {
+			target: "/api/shows/12",
+			want:   ErrorDetails{Status: http.StatusNotFound, Code: "not_found", Message: "Unknown show"},
+		}, {
+			target: "/api/songs/tweezer",
+			want:   ErrorDetails{Status: http.StatusNotFound, Code: "not_found", Message: "Unknown song"},
+		}, {
+			target: "/api/suggest",
+			want:   ErrorDetails{Status: http.StatusBadRequest, Code: "bad_request", Message: "Missing prefix param"},
+		}, {
+			target: "/api/nothing",
+			want:   ErrorDetails{Status: http.StatusNotFound, Code: "not_found", Message: "Not Found"},
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.target, func(t *testing.T) {
+			rec := serve(e, http.MethodGet, tc.target, "")
+			checkErrorBody(t, rec, tc.want)
+		})
+	}
+}
+
+func checkErrorBody(t *testing.T, rec *httptest.ResponseRecorder, want ErrorDetails) {
+	t.Helper()
+	if rec.Code != want.Status {
+		t.Errorf("got status %d, but expected %d", rec.Code, want.Status)
+	}
+	var body ErrorBody
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("unable to decode error body %q; %v", rec.Body, err)
+	}
+	if body.Error != want {
+		t.Errorf("got: %+v\nexpected: %+v", body.Error, want)
+	}
+}
+
+func TestAPIIndexUnavailable(t *testing.T) {
+	e := newServer(nil)
+	rec := serve(e, http.MethodGet, "/api/search?query=fee", "")
+	checkErrorBody(t, rec, ErrorDetails{Status: http.StatusServiceUnavailable, Code: "index_unavailable", Message: "The index isn't available yet"})
+}
+
+func TestAPITimeout(t *testing.T) {
+	e := newTestServer(t)
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, "/api/search?query=fee", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	checkErrorBody(t, rec, ErrorDetails{Status: http.StatusGatewayTimeout, Code: "timeout", Message: "Query timed out"})
+}
+
+func TestAPIQueryTooComplex(t *testing.T) {
+	e := newTestServer(t)
+	e.Use(internal.QueryLimits(query.Limits{MaxNodes: 3, MaxNots: 1}))
+	tests := []struct {
+		target  string
+		status  int
+		message string
+	}{
+		{"/api/search?query=fee%20OR%20reba", http.StatusOK, ""},
+		{"/api/search?query=fee%20OR%20reba%20OR%20tweezer", http.StatusUnprocessableEntity, "query has 5 terms and operators, but at most 3 are allowed"},
+		{"/api/v2/search?query=NOT%20NOT%20fee", http.StatusUnprocessableEntity, "query has 2 NOTs, but at most 1 are allowed"},
+	}
+	for _, tc := range tests {
+		rec := serve(e, http.MethodGet, tc.target, "")
+		if tc.status == http.StatusOK {
+			if rec.Code != tc.status {
+				t.Errorf("GET %s got status %d, but expected %d", tc.target, rec.Code, tc.status)
+			}
+			continue
+		}
+		checkErrorBody(t, rec, ErrorDetails{Status: tc.status, Code: "query_too_complex", Message: tc.message})
+
+		// The client's copy being current doesn't hide the error.
+		req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+		req.Header.Set("If-None-Match", "*")
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != tc.status {
+			t.Errorf("GET %s with If-None-Match got status %d, but expected %d", tc.target, rec.Code, tc.status)
+		}
+	}
+}
+
+func TestSearchPageErrors(t *testing.T) {
+	e := newTestServer(t)
+
+	rec := serve(e, http.MethodGet, "/search", "")
+	if rec.Code != http.StatusFound {
+		t.Errorf("got status %d, but expected %d", rec.Code, http.StatusFound)
+	}
+	if got := rec.Header().Get("Location"); got != "/" {
+		t.Errorf("got redirect to %q, but expected /", got)
+	}
+
+	// Without a renderer, the error page falls back to plain text.
+	rec = serve(e, http.MethodGet, "/search?query=%3Cb%3E%20OR", "")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("got status %d, but expected %d", rec.Code, http.StatusBadRequest)
+	}
+	if ct := rec.Header().Get("Content-Type"); strings.Contains(ct, "json") {
+		t.Errorf("got Content-Type %q for a page, but expected a non-JSON response", ct)
+	}
+}
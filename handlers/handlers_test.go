@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	echotrace "github.com/awbraunstein/echo-trace"
+	"github.com/awbraunstein/setlist-search/index"
+	"github.com/awbraunstein/setlist-search/internal"
+	"github.com/labstack/echo/v4"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+const testIndex = `setsearcher index 2
+[SONGS]
+Mike's Song|mikes-song
+Weekapaug Groove|weekapaug-groove
+You Enjoy Myself|you-enjoy-myself
+[END]
+[ALIASES]
+you-enjoy-myself|YEM
+[END]
+[SETLISTS]
+ID{1}DATE{1997-11-22}URL{http://phish.net/1}VENUE{Hampton Coliseum}LOCATION{Hampton, VA, USA}TOUR{Fall Tour 1997}SET1{mikes-song->simple>weekapaug-groove,fee}SET2{you-enjoy-myself}
+ID{2}DATE{1997-11-22}URL{http://phish.net/2}SET1{you-enjoy-myself,fee}
+ID{3}DATE{1998-04-02}URL{http://phish.net/3}VENUE{Nassau Coliseum}SET1{reba,mikes-song}ENCORE{you-enjoy-myself}
+ID{4}DATE{1998-04-03}URL{http://phish.net/4}ORIGIN{phish.net+override}SET1{fee}
+[END]`
+
+// newTestServer returns a server with the handlers routed like main, backed by
+// testIndex.
+func newTestServer(t *testing.T) *echo.Echo {
+	t.Helper()
+	idx, err := index.Read(strings.NewReader(testIndex))
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	return newServer(idx)
+}
+
+// newServer returns a server with the handlers routed like main. If idx is
+// nil, no index is injected.
+func newServer(idx *index.Index) *echo.Echo {
+	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler
+	e.Use(echotrace.Middleware)
+	if idx != nil {
+		e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				c.Set(internal.InjectorContextKey, idx)
+				return next(c)
+			}
+		})
+	}
+	e.GET("/search", Search)
+	e.GET("/show/:id", Show)
+	e.GET("/api/search", SearchAPI)
+	e.POST("/api/search", SearchAPI)
+	e.GET("/api/v2/search", SearchAPIV2)
+	e.POST("/api/v2/search", SearchAPIV2)
+	e.GET("/api/shows/:id", ShowAPI)
+	e.GET("/api/songs/:song", SongStatsAPI)
+	e.GET("/api/suggest", SuggestAPI)
+	return e
+}
+
+// serve makes a request to e and returns the response.
+func serve(e *echo.Echo, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+// checkGolden compares got with the contents of testdata/name, or rewrites the
+// file when run with -update.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("unable to update golden file; %v", err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unable to read golden file; %v", err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("%s doesn't match the golden file.\ngot: %s\nexpected: %s", name, got, want)
+	}
+}
+
+func TestSearchAPIGolden(t *testing.T) {
+	e := newTestServer(t)
+	tests := []struct {
+		golden string
+		method string
+		target string
+		body   string
+	}{
+		{golden: "search.golden", method: http.MethodGet, target: "/api/search?query=YEM"},
+		{golden: "search_page.golden", method: http.MethodGet, target: "/api/search?query=fee&limit=2&sort=-date"},
+		{golden: "search_post.golden", method: http.MethodPost, target: "/api/search", body: `{"query": "mikes-song AND NOT reba"}`},
+		{golden: "search_v2.golden", method: http.MethodGet, target: "/api/v2/search?query=YEM%20OR%20mikes-song"},
+		{golden: "search_v2_fields.golden", method: http.MethodGet, target: "/api/v2/search?query=fee&fields=id,matched_songs&limit=2"},
+		{golden: "search_v2_post.golden", method: http.MethodPost, target: "/api/v2/search", body: `{"query": "mikes-song AND NOT reba", "fields": "id,venue,location,tour"}`},
+		{golden: "search_v2_field.golden", method: http.MethodGet, target: "/api/v2/search?query=venue:coliseum%20AND%20YEM&fields=id,venue,matched_songs"},
+		{golden: "suggest.golden", method: http.MethodGet, target: "/api/suggest?prefix=m"},
+		{golden: "suggest_fuzzy.golden", method: http.MethodGet, target: "/api/suggest?prefix=weekapog&limit=1"},
+		{golden: "show.golden", method: http.MethodGet, target: "/api/shows/1?query=fee"},
+		{golden: "show_overridden.golden", method: http.MethodGet, target: "/api/shows/4"},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.golden, func(t *testing.T) {
+			rec := serve(e, tc.method, tc.target, tc.body)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got status %d, but expected %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+			checkGolden(t, tc.golden, rec.Body.Bytes())
+		})
+	}
+}
+
+func TestSearchAPIV2Errors(t *testing.T) {
+	e := newTestServer(t)
+	for _, target := range []string{
+		"/api/v2/search",
+		"/api/v2/search?query=fee&fields=id,setlist",
+		"/api/v2/search?query=fee&limit=-1",
+	} {
+		if rec := serve(e, http.MethodGet, target, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("GET %s got status %d, but expected %d", target, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestShowSongStatsLinks(t *testing.T) {
+	e := newTestServer(t)
+	rec := serve(e, http.MethodGet, "/api/shows/1", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, but expected %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var sd ShowDetails
+	if err := json.Unmarshal(rec.Body.Bytes(), &sd); err != nil {
+		t.Fatalf("unable to decode show; %v", err)
+	}
+	for _, set := range sd.Sets {
+		for _, song := range set.Songs {
+			if song.StatsUrl == "" {
+				t.Errorf("song %s has no stats link", song.Song)
+				continue
+			}
+			if rec := serve(e, http.MethodGet, song.StatsUrl, ""); rec.Code != http.StatusOK {
+				t.Errorf("GET %s got status %d, but expected %d", song.StatsUrl, rec.Code, http.StatusOK)
+			}
+		}
+	}
+}
+
+func TestSearchDefaultLimit(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("setsearcher index 2\n[SONGS]\n[END]\n[ALIASES]\n[END]\n[SETLISTS]\n")
+	shows := defaultSearchLimit + 1
+	for id := 1; id <= shows; id++ {
+		fmt.Fprintf(&b, "ID{%d}DATE{1990-01-01}URL{u}SET1{fee}\n", id)
+	}
+	b.WriteString("[END]")
+	idx, err := index.Read(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	e := newServer(idx)
+	tests := []struct {
+		target    string
+		wantShows int
+		wantNext  bool
+	}{
+		// The v1 API returned every show before it was paginated.
+		{target: "/api/search?query=fee", wantShows: shows},
+		{target: "/api/search?query=fee&limit=10", wantShows: 10, wantNext: true},
+		{target: "/api/v2/search?query=fee", wantShows: defaultSearchLimit, wantNext: true},
+	}
+	for _, tc := range tests {
+		rec := serve(e, http.MethodGet, tc.target, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s got status %d, but expected %d: %s", tc.target, rec.Code, http.StatusOK, rec.Body)
+		}
+		var got struct {
+			Count int               `json:"count"`
+			Shows []json.RawMessage `json:"shows"`
+			Next  string            `json:"next"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("unable to decode results; %v", err)
+		}
+		if got.Count != shows || len(got.Shows) != tc.wantShows || (got.Next != "") != tc.wantNext {
+			t.Errorf("GET %s got count %d, %d shows and next %q, but expected count %d, %d shows and next: %v", tc.target, got.Count, len(got.Shows), got.Next, shows, tc.wantShows, tc.wantNext)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/awbraunstein/setlist-search/internal"
+	"github.com/labstack/echo/v4"
+)
+
+// Healthz reports that the server is up.
+func Healthz(c echo.Context) error {
+	return c.String(http.StatusOK, "ok")
+}
+
+// Readiness is the json payload of the readyz endpoint.
+type Readiness struct {
+	Ready      bool      `json:"ready"`
+	Generation uint64    `json:"generation"`
+	Shows      int       `json:"shows"`
+	LastReload time.Time `json:"last_reload"`
+	Modified   time.Time `json:"modified"`
+	// Subscribed is only set when the index is reloaded from a remote source.
+	Subscribed *bool `json:"subscribed,omitempty"`
+	// Problems explains why the server isn't ready.
+	Problems []string `json:"problems,omitempty"`
+}
+
+// Readyz returns a handler that reports whether the server is ready to serve
+// searches: an index is loaded, the remote index subscription is alive, and
+// the index isn't older than maxAge. A maxAge of 0 disables the age check.
+func Readyz(status func() internal.IndexStatus, maxAge time.Duration) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		s := status()
+		r := &Readiness{Ready: true, LastReload: s.Loaded}
+		if s.Index == nil {
+			r.Problems = append(r.Problems, "no index is loaded")
+		} else {
+			r.Generation = s.Index.Generation()
+			r.Shows = s.Index.NumShows()
+			r.Modified = s.Index.ModTime()
+			if age := time.Since(r.Modified); maxAge > 0 && age > maxAge {
+				r.Problems = append(r.Problems, "index is "+age.Round(time.Second).String()+" old")
+			}
+		}
+		if s.Remote {
+			subscribed := s.Subscribed
+			r.Subscribed = &subscribed
+			if !subscribed {
+				r.Problems = append(r.Problems, "index subscription isn't receiving")
+			}
+		}
+		code := http.StatusOK
+		if len(r.Problems) > 0 {
+			r.Ready = false
+			code = http.StatusServiceUnavailable
+		}
+		return c.JSON(code, r)
+	}
+}
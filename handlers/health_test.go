@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/awbraunstein/setlist-search/index"
+	"github.com/awbraunstein/setlist-search/internal"
+	"github.com/labstack/echo/v4"
+)
+
+func TestReadyz(t *testing.T) {
+	now := time.Now()
+	fresh, _, err := index.ReadWithOptions(strings.NewReader(testIndex), index.ReadOptions{ModTime: now.Add(-time.Hour)})
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	stale, _, err := index.ReadWithOptions(strings.NewReader(testIndex), index.ReadOptions{ModTime: now.Add(-72 * time.Hour)})
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		status   internal.IndexStatus
+		maxAge   time.Duration
+		want     int
+		problems int
+	}{
+		{"local", internal.IndexStatus{Index: fresh, Loaded: now}, 24 * time.Hour, http.StatusOK, 0},
+		{"remote", internal.IndexStatus{Index: fresh, Loaded: now, Remote: true, Subscribed: true}, 24 * time.Hour, http.StatusOK, 0},
+		{"no index", internal.IndexStatus{}, 0, http.StatusServiceUnavailable, 1},
+		{"stale", internal.IndexStatus{Index: stale, Loaded: now}, 24 * time.Hour, http.StatusServiceUnavailable, 1},
+		{"no max age", internal.IndexStatus{Index: stale, Loaded: now}, 0, http.StatusOK, 0},
+		{"unsubscribed", internal.IndexStatus{Index: stale, Loaded: now, Remote: true}, 24 * time.Hour, http.StatusServiceUnavailable, 2},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			e.GET("/readyz", Readyz(func() internal.IndexStatus { return tc.status }, tc.maxAge))
+			rec := serve(e, http.MethodGet, "/readyz", "")
+			if rec.Code != tc.want {
+				t.Errorf("got status %d, but expected %d", rec.Code, tc.want)
+			}
+			var r Readiness
+			if err := json.Unmarshal(rec.Body.Bytes(), &r); err != nil {
+				t.Fatalf("unable to decode %q: %v", rec.Body, err)
+			}
+			if r.Ready != (tc.want == http.StatusOK) {
+				t.Errorf("got ready %t with status %d", r.Ready, rec.Code)
+			}
+			if len(r.Problems) != tc.problems {
+				t.Errorf("got problems %q, but expected %d", r.Problems, tc.problems)
+			}
+			if tc.status.Index != nil && (r.Generation != tc.status.Index.Generation() || r.Shows != 4) {
+				t.Errorf("got generation %d and %d shows, but expected %d and 4", r.Generation, r.Shows, tc.status.Index.Generation())
+			}
+			if (r.Subscribed != nil) != tc.status.Remote {
+				t.Errorf("got subscribed %v for remote %t", r.Subscribed, tc.status.Remote)
+			}
+		})
+	}
+}
@@ -14,9 +14,24 @@ type searchTemplateData struct {
 func Search(c echo.Context) error {
 	query := c.QueryParam("query")
 	if query == "" {
-		c.Redirect(http.StatusMovedPermanently, "/")
+		return c.Redirect(http.StatusFound, "/")
+	}
+	opts, err := newSearchOptions(c.QueryParam("limit"), c.QueryParam("cursor"), c.QueryParam("sort"), defaultSearchLimit)
+	if err != nil {
+		return err
+	}
+	idx, err := getIndex(c)
+	if err != nil {
+		return err
+	}
+	stmt, err := parseQuery(c, idx, query)
+	if err != nil {
+		return err
+	}
+	sr, err := searchIndex(c, idx, query, stmt, opts)
+	if err != nil {
+		return err
 	}
-	sr, _ := searchIndex(c, query)
 	data := &searchTemplateData{
 		Query:   query,
 		Results: sr,
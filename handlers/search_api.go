@@ -3,28 +3,47 @@ package handlers
 import (
 	"net/http"
 
-	echotrace "github.com/awbraunstein/echo-trace"
 	"github.com/awbraunstein/setlist-search/internal"
 	"github.com/labstack/echo/v4"
-	"golang.org/x/net/trace"
 )
 
 // SearchRequest is the json request to the api/search endpoint.
 type SearchRequest struct {
 	Query string `json:"query"`
+	// Limit is the number of shows to return, Cursor is the next field of the
+	// previous page and Sort is "date" or "-date". Every show is returned when
+	// there is no limit.
+	Limit  string `json:"limit"`
+	Cursor string `json:"cursor"`
+	Sort   string `json:"sort"`
 }
 
 func SearchAPI(c echo.Context) error {
 	var req SearchRequest
 	if err := internal.MergeJSONBody(c, &req); err != nil {
-		tr := c.Get(echotrace.ContextKey).(trace.Trace)
-		tr.LazyPrintf("Error parsing JSON: %v", err)
-		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request")
+		tracef(c, "Error parsing JSON: %v", err)
+		return badRequest("Invalid request")
 	}
 	if req.Query == "" {
-		return echo.NewHTTPError(http.StatusBadRequest, "Missing query param")
+		return badRequest("Missing query param")
 	}
-	sr, err := searchIndex(c, req.Query)
+	opts, err := newSearchOptions(req.Limit, req.Cursor, req.Sort, noSearchLimit)
+	if err != nil {
+		return err
+	}
+	idx, err := getIndex(c)
+	if err != nil {
+		return err
+	}
+	// The request is checked in full before a 304 can be sent.
+	stmt, err := parseQuery(c, idx, req.Query)
+	if err != nil {
+		return err
+	}
+	if notModified(c, idx) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	sr, err := searchIndex(c, idx, req.Query, stmt, opts)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/awbraunstein/setlist-search/index"
+	"github.com/awbraunstein/setlist-search/internal"
+	"github.com/labstack/echo/v4"
+)
+
+// SearchRequestV2 is the json request to the api/v2/search endpoint.
+type SearchRequestV2 struct {
+	Query  string `json:"query"`
+	Limit  string `json:"limit"`
+	Cursor string `json:"cursor"`
+	Sort   string `json:"sort"`
+	// Fields is a comma separated list of the show fields to return. All of
+	// them are returned if it's empty.
+	Fields string `json:"fields"`
+}
+
+// Fields of a show in the api/v2/search response.
+var showFieldsV2 = []string{"id", "date", "url", "venue", "location", "tour", "matched_songs"}
+
+// SearchResultsV2 is the json payload of the api/v2/search endpoint. Each
+// show holds the selected fields; venue, location and tour are left out when
+// they aren't known.
+type SearchResultsV2 struct {
+	Count  int                      `json:"count"`
+	Shows  []map[string]interface{} `json:"shows"`
+	Facets *index.Facets            `json:"facets"`
+	Next   string                   `json:"next,omitempty"`
+}
+
+// parseFields returns the set of fields selected by the fields param.
+func parseFields(fields string) (map[string]bool, error) {
+	selected := make(map[string]bool)
+	if fields == "" {
+		for _, f := range showFieldsV2 {
+			selected[f] = true
+		}
+		return selected, nil
+	}
+	known := make(map[string]bool)
+	for _, f := range showFieldsV2 {
+		known[f] = true
+	}
+	for _, f := range strings.Split(fields, ",") {
+		f = strings.TrimSpace(f)
+		if !known[f] {
+			return nil, badRequest("Unknown field: " + f)
+		}
+		selected[f] = true
+	}
+	return selected, nil
+}
+
+func SearchAPIV2(c echo.Context) error {
+	var req SearchRequestV2
+	if err := internal.MergeJSONBody(c, &req); err != nil {
+		tracef(c, "Error parsing JSON: %v", err)
+		return badRequest("Invalid request")
+	}
+	if req.Query == "" {
+		return badRequest("Missing query param")
+	}
+	fields, err := parseFields(req.Fields)
+	if err != nil {
+		return err
+	}
+	opts, err := newSearchOptions(req.Limit, req.Cursor, req.Sort, defaultSearchLimit)
+	if err != nil {
+		return err
+	}
+	idx, err := getIndex(c)
+	if err != nil {
+		return err
+	}
+	// The request is checked in full before a 304 can be sent.
+	stmt, err := parseQuery(c, idx, req.Query)
+	if err != nil {
+		return err
+	}
+	if notModified(c, idx) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	sr, err := searchIndex(c, idx, req.Query, stmt, opts)
+	if err != nil {
+		return err
+	}
+
+	res := &SearchResultsV2{
+		Count:  sr.Count,
+		Shows:  make([]map[string]interface{}, 0, len(sr.Shows)),
+		Facets: sr.Facets,
+		Next:   sr.Next,
+	}
+	for _, si := range sr.Shows {
+		sl := idx.Show(si.Id)
+		show := make(map[string]interface{})
+		set := func(field string, value interface{}) {
+			if fields[field] {
+				show[field] = value
+			}
+		}
+		set("id", si.Id)
+		set("date", si.Date)
+		set("url", si.Url)
+		if sl.Venue != "" {
+			set("venue", sl.Venue)
+		}
+		if sl.Location != "" {
+			set("location", sl.Location)
+		}
+		if sl.Tour != "" {
+			set("tour", sl.Tour)
+		}
+		if fields["matched_songs"] {
+			played := make(map[string]bool)
+			for _, song := range sl.Songs() {
+				played[song] = true
+			}
+			matched := []string{}
+			for _, song := range sr.Terms {
+				if played[song] {
+					matched = append(matched, song)
+				}
+			}
+			show["matched_songs"] = matched
+		}
+		res.Shows = append(res.Shows, show)
+	}
+	return c.JSON(http.StatusOK, res)
+}
@@ -1,20 +1,25 @@
 package handlers
 
 import (
-	"net/http"
+	"encoding/base64"
+	"fmt"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
-	echotrace "github.com/awbraunstein/echo-trace"
 	"github.com/awbraunstein/setlist-search/index"
+	"github.com/awbraunstein/setlist-search/index/query"
 	"github.com/awbraunstein/setlist-search/internal"
 	"github.com/labstack/echo/v4"
-	"golang.org/x/net/trace"
 )
 
 type ShowInfo struct {
 	Date string `json:"date"`
 	Url  string `json:"url"`
+
+	// Internal only.
+	Id int `json:"-"`
 }
 
 type byDate []ShowInfo
@@ -26,41 +31,207 @@ func (si byDate) Swap(i, j int) {
 	si[i], si[j] = si[j], si[i]
 }
 func (si byDate) Less(i, j int) bool {
-	return si[i].Date < si[j].Date
+	return si[i].less(si[j])
+}
+
+// less orders shows by date, and shows on the same date by id, so that every
+// show has a stable place in the results.
+func (si ShowInfo) less(other ShowInfo) bool {
+	if si.Date != other.Date {
+		return si.Date < other.Date
+	}
+	return si.Id < other.Id
+}
+
+// Orderings of search results.
+const (
+	sortDateAsc  = "date"
+	sortDateDesc = "-date"
+)
+
+const (
+	// defaultSearchLimit is the number of shows returned by the search page
+	// and /api/v2/search when no limit is given, and maxSearchLimit is the
+	// largest limit that may be asked for.
+	defaultSearchLimit = 100
+	maxSearchLimit     = 1000
+	// noSearchLimit returns every show when no limit is given, as
+	// /api/search always did before it was paginated.
+	noSearchLimit = 0
+)
+
+// searchOptions controls which page of the results is returned.
+type searchOptions struct {
+	// limit is the number of shows on a page, or noSearchLimit for all of
+	// them.
+	limit int
+	sort  string
+	// after is the last show of the previous page, if there was one.
+	after *ShowInfo
+}
+
+// newSearchOptions validates the limit, cursor and sort params of a search.
+// Each of them may be empty, in which case the limit is defaultLimit.
+func newSearchOptions(limit, cursor, sortBy string, defaultLimit int) (*searchOptions, error) {
+	opts := &searchOptions{limit: defaultLimit, sort: sortDateAsc}
+	if limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			return nil, badRequest("Invalid limit param")
+		}
+		opts.limit = n
+	}
+	switch sortBy {
+	case "":
+	case sortDateAsc, sortDateDesc:
+		opts.sort = sortBy
+	default:
+		return nil, badRequest("Invalid sort param")
+	}
+	if cursor != "" {
+		after, err := decodeCursor(cursor, opts.sort)
+		if err != nil {
+			return nil, badRequest("Invalid cursor param")
+		}
+		opts.after = after
+	}
+	return opts, nil
+}
+
+// encodeCursor returns an opaque cursor that continues the results after si.
+// The cursor records the ordering so that it can't be used with another one.
+func encodeCursor(si ShowInfo, sortBy string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s|%d|%s", sortBy, si.Id, si.Date)))
+}
+
+func decodeCursor(cursor, sortBy string) (*ShowInfo, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(string(b), "|", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed cursor %q", b)
+	}
+	if parts[0] != sortBy {
+		return nil, fmt.Errorf("cursor is for sort %q, not %q", parts[0], sortBy)
+	}
+	id, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed cursor %q", b)
+	}
+	return &ShowInfo{Id: id, Date: parts[2]}, nil
 }
 
+// facetLimit is the number of tours, venues and songs returned in the facets
+// of a search.
+const facetLimit = 10
+
 // SearchResults is the json payload for a search query.
 type SearchResults struct {
 	// Exported to the api.
-	Count int        `json:"count"`
-	Shows []ShowInfo `json:"shows"`
+	Count  int           `json:"count"`
+	Shows  []ShowInfo    `json:"shows"`
+	Facets *index.Facets `json:"facets"`
+	// Next is the cursor of the next page of results, if there is one.
+	Next string `json:"next,omitempty"`
 
 	// Internal only.
+	Query     string        `json:"-"`
+	Terms     []string      `json:"-"`
+	Sort      string        `json:"-"`
+	Limit     int           `json:"-"`
+	Prev      bool          `json:"-"`
 	QueryTime time.Duration `json:"-"`
+	// PrevCursor is the cursor of the previous page of results. It's empty
+	// when the previous page is the first one.
+	PrevCursor string `json:"-"`
+}
+
+// parseQuery parses q and checks it against the query limits of the request,
+// so that a bad query is reported before anything else is done with it.
+func parseQuery(c echo.Context, idx *index.Index, q string) (query.Statement, error) {
+	stmt, err := idx.Parse(q)
+	if limits, ok := c.Get(internal.QueryLimitsContextKey).(query.Limits); ok && err == nil {
+		err = limits.Check(stmt)
+	}
+	if err != nil {
+		return nil, indexError(err)
+	}
+	return stmt, nil
 }
 
-func searchIndex(c echo.Context, query string) (*SearchResults, error) {
-	idx := c.Get(internal.InjectorContextKey).(*index.Index)
+// searchIndex evaluates stmt, the parsed form of q, and returns the page of
+// results that opts asks for.
+func searchIndex(c echo.Context, idx *index.Index, q string, stmt query.Statement, opts *searchOptions) (*SearchResults, error) {
 	start := time.Now()
-	shows, err := idx.Query(c.Request().Context(), query)
+	var shows []int
+	var err error
+	if cache, ok := c.Get(internal.CacheContextKey).(*index.Cache); ok {
+		shows, err = cache.Eval(c.Request().Context(), idx, stmt)
+	} else {
+		shows, err = idx.Eval(c.Request().Context(), stmt)
+	}
 	if err != nil {
-		tr := c.Get(echotrace.ContextKey).(trace.Trace)
-		tr.LazyPrintf("Error executing query: %v", err)
-		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Internal Error")
+		return nil, indexError(err)
 	}
 	elapsed := time.Since(start)
-	tr := c.Get(echotrace.ContextKey).(trace.Trace)
-	tr.LazyPrintf("Query %q completed in %v", query, elapsed)
+	tracef(c, "Query %q completed in %v", q, elapsed)
+	if m, ok := c.Get(internal.MetricsContextKey).(*internal.Metrics); ok {
+		m.ObserveQuery(elapsed)
+	}
+	terms := query.Terms(stmt)
 	sr := &SearchResults{
+		Facets:    idx.Facets(shows, terms, facetLimit),
+		Query:     q,
+		Terms:     terms,
+		Sort:      opts.sort,
+		Limit:     opts.limit,
+		Prev:      opts.after != nil,
 		QueryTime: elapsed,
 	}
 	sr.Count = len(shows)
+	all := make([]ShowInfo, 0, len(shows))
 	for _, show := range shows {
-		sr.Shows = append(sr.Shows, ShowInfo{
+		all = append(all, ShowInfo{
 			Date: idx.ShowDate(show),
 			Url:  idx.ShowUrl(show),
+			Id:   show,
+		})
+	}
+	var sorter sort.Interface = byDate(all)
+	if opts.sort == sortDateDesc {
+		sorter = sort.Reverse(sorter)
+	}
+	sort.Sort(sorter)
+
+	// Skip the shows up to and including the cursor. The show the cursor
+	// points at may no longer match, so find where it would be.
+	first := 0
+	if opts.after != nil {
+		after := *opts.after
+		first = sort.Search(len(all), func(i int) bool {
+			if opts.sort == sortDateDesc {
+				return all[i].less(after)
+			}
+			return after.less(all[i])
 		})
 	}
-	sort.Sort(byDate(sr.Shows))
+	limit := opts.limit
+	if limit == noSearchLimit {
+		limit = len(all)
+	}
+	if prev := first - limit - 1; prev >= 0 {
+		sr.PrevCursor = encodeCursor(all[prev], opts.sort)
+	}
+	end := first + limit
+	if end >= len(all) {
+		end = len(all)
+	} else {
+		sr.Next = encodeCursor(all[end-1], opts.sort)
+	}
+	if first < end {
+		sr.Shows = all[first:end]
+	}
 	return sr, nil
 }
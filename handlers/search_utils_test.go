@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/awbraunstein/setlist-search/index"
+	"github.com/labstack/echo/v4"
+)
+
+func TestSearchOptions(t *testing.T) {
+	cursor := encodeCursor(ShowInfo{Id: 7, Date: "1997-11-22"}, sortDateDesc)
+	tests := []struct {
+		name                  string
+		limit, cursor, sortBy string
+		want                  *searchOptions
+		err                   bool
+	}{
+		{
+			name: "defaults",
+			want: &searchOptions{limit: defaultSearchLimit, sort: sortDateAsc},
+		}, {
+			name:   "cursor",
+			limit:  "5",
+			cursor: cursor,
+			sortBy: sortDateDesc,
+			want:   &searchOptions{limit: 5, sort: sortDateDesc, after: &ShowInfo{Id: 7, Date: "1997-11-22"}},
+		}, {
+			name:   "cursor for another sort",
+			cursor: cursor,
+			err:    true,
+		}, {
+			name:   "malformed cursor",
+			cursor: "not a cursor",
+			err:    true,
+		}, {
+			name:  "zero limit",
+			limit: "0",
+			err:   true,
+		}, {
+			name:  "huge limit",
+			limit: "100000",
+			err:   true,
+		}, {
+			name:   "relevance",
+			sortBy: "relevance",
+			err:    true,
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := newSearchOptions(tc.limit, tc.cursor, tc.sortBy, defaultSearchLimit)
+			if (err != nil) != tc.err {
+				t.Fatalf("newSearchOptions got error %v, but expected error: %v", err, tc.err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got: %+v\nexpected: %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSearchPrevCursor(t *testing.T) {
+	idx, err := index.Read(strings.NewReader(testIndex))
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	shows := []ShowInfo{{Id: 1, Date: "1997-11-22"}, {Id: 2, Date: "1997-11-22"}}
+	tests := []struct {
+		name      string
+		after     *ShowInfo
+		wantShow  int
+		wantPrev  bool
+		wantAfter *ShowInfo
+	}{
+		{name: "first page", wantShow: 1},
+		{name: "second page", after: &shows[0], wantShow: 2, wantPrev: true},
+		{name: "third page", after: &shows[1], wantShow: 4, wantPrev: true, wantAfter: &shows[0]},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/search", nil), httptest.NewRecorder())
+			stmt, err := parseQuery(c, idx, "fee")
+			if err != nil {
+				t.Fatalf("parseQuery got unexpected error: %v", err)
+			}
+			sr, err := searchIndex(c, idx, "fee", stmt, &searchOptions{limit: 1, sort: sortDateAsc, after: tc.after})
+			if err != nil {
+				t.Fatalf("searchIndex got unexpected error: %v", err)
+			}
+			if len(sr.Shows) != 1 || sr.Shows[0].Id != tc.wantShow {
+				t.Errorf("searchIndex got shows %+v, but expected show %d", sr.Shows, tc.wantShow)
+			}
+			if sr.Prev != tc.wantPrev {
+				t.Errorf("searchIndex got Prev %v, but expected %v", sr.Prev, tc.wantPrev)
+			}
+			want := ""
+			if tc.wantAfter != nil {
+				want = encodeCursor(*tc.wantAfter, sortDateAsc)
+			}
+			if sr.PrevCursor != want {
+				t.Errorf("searchIndex got PrevCursor %q, but expected %q", sr.PrevCursor, want)
+			}
+		})
+	}
+}
@@ -4,8 +4,6 @@ import (
 	"net/http"
 	"sort"
 
-	"github.com/awbraunstein/setlist-search/index"
-	"github.com/awbraunstein/setlist-search/internal"
 	"github.com/labstack/echo/v4"
 )
 
@@ -25,7 +23,16 @@ type searchboxConfig struct {
 }
 
 func SearchBoxConfigAPI(c echo.Context) error {
-	idx := c.Get(internal.InjectorContextKey).(*index.Index)
+	idx, err := getIndex(c)
+	if err != nil {
+		return err
+	}
+	// Clients may keep this since it changes infrequently, but must check
+	// that the index hasn't changed before using it.
+	c.Response().Header().Set("Cache-Control", "private, no-cache")
+	if notModified(c, idx) {
+		return c.NoContent(http.StatusNotModified)
+	}
 	charsKind := valueKind{
 		Name:  "special-characters",
 		Color: "green",
@@ -69,11 +76,5 @@ func SearchBoxConfigAPI(c echo.Context) error {
 		},
 	}
 
-	resp := c.Response()
-	header := resp.Header()
-	// Allow clients to cache this since it changes infrequently.
-	header.Add("Cache-Control", "private")
-	// Allow it to be cached for up to 1 day.
-	header.Add("Cache-Control", "max-age=86400")
 	return c.JSON(http.StatusOK, &sbconf)
 }
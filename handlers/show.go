@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/awbraunstein/setlist-search/index/query"
+	"github.com/awbraunstein/setlist-search/searcher"
+	"github.com/labstack/echo/v4"
+)
+
+// ShowSong is a song within a set of a show.
+type ShowSong struct {
+	Song string `json:"song"`
+	Name string `json:"name"`
+	// StatsUrl is the song's stats page.
+	StatsUrl string `json:"stats_url"`
+	// Connector is ">" or "->" when the song transitions or segues into the
+	// next song.
+	Connector string `json:"connector,omitempty"`
+	// Matched is set when the song was matched by the query the show was
+	// found with.
+	Matched bool `json:"matched,omitempty"`
+}
+
+// ShowSet is a set of a show.
+type ShowSet struct {
+	// Name is the short name of the set, e.g. "1" or "e", and Label is its
+	// human readable name, e.g. "Set 1" or "Encore".
+	Name  string     `json:"name"`
+	Label string     `json:"label"`
+	Songs []ShowSong `json:"songs"`
+}
+
+// ShowDetails is the json payload for a show.
+type ShowDetails struct {
+	Id       int       `json:"id"`
+	Date     string    `json:"date"`
+	Url      string    `json:"url"`
+	Venue    string    `json:"venue,omitempty"`
+	Location string    `json:"location,omitempty"`
+	Tour     string    `json:"tour,omitempty"`
+	Sets     []ShowSet `json:"sets"`
+	// Origin is where the setlist came from, e.g. "phish.net" or
+	// "phish.net+override", and Overridden is set when it was added or
+	// patched by hand.
+	Origin     string `json:"origin,omitempty"`
+	Overridden bool   `json:"overridden,omitempty"`
+
+	// Internal only.
+	Query string `json:"-"`
+}
+
+// showDetails looks up the show named in the path. Songs matched by the query
+// param, if there is one, are marked as matched.
+func showDetails(c echo.Context) (*ShowDetails, error) {
+	idx, err := getIndex(c)
+	if err != nil {
+		return nil, err
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, badRequest("Invalid show id")
+	}
+	sl := idx.Show(id)
+	if sl == nil {
+		return nil, notFound("Unknown show")
+	}
+
+	matched := make(map[string]bool)
+	q := c.QueryParam("query")
+	if q != "" {
+		stmt, err := idx.Parse(q)
+		if err != nil {
+			// The show is still worth showing without highlighting.
+			tracef(c, "Error parsing query: %v", err)
+		} else {
+			for _, song := range query.Terms(stmt) {
+				matched[song] = true
+			}
+		}
+	}
+
+	sd := &ShowDetails{
+		Id:         sl.ShowId,
+		Date:       sl.Date,
+		Url:        sl.Url,
+		Venue:      sl.Venue,
+		Location:   sl.Location,
+		Tour:       sl.Tour,
+		Origin:     sl.Origin,
+		Overridden: sl.Overridden(),
+		Query:      q,
+	}
+	for _, set := range sl.Sets {
+		ss := ShowSet{Name: set.Name(), Label: set.Label()}
+		for k, song := range set.Songs {
+			s := ShowSong{
+				Song:     song,
+				Name:     idx.SongName(song),
+				StatsUrl: songStatsURL(song),
+				Matched:  matched[song],
+			}
+			if k < len(set.Songs)-1 && set.ConnectorAfter(k) != searcher.Break {
+				s.Connector = set.ConnectorAfter(k).String()
+			}
+			ss.Songs = append(ss.Songs, s)
+		}
+		sd.Sets = append(sd.Sets, ss)
+	}
+	return sd, nil
+}
+
+// songStatsURL returns the path of the stats page of a song.
+func songStatsURL(song string) string {
+	return "/api/songs/" + url.PathEscape(song)
+}
+
+// Show renders the setlist of a show.
+func Show(c echo.Context) error {
+	sd, err := showDetails(c)
+	if err != nil {
+		return err
+	}
+	return c.Render(http.StatusOK, "show.tmpl", sd)
+}
+
+// ShowAPI returns the setlist of a show.
+func ShowAPI(c echo.Context) error {
+	sd, err := showDetails(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, sd)
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/awbraunstein/setlist-search/index"
+	"github.com/labstack/echo/v4"
+)
+
+// songParam returns the song named in the path. Song IDs such as "ac/dc-bag"
+// may contain a slash, so clients must escape it as %2F.
+func songParam(c echo.Context) string {
+	song := c.Param("song")
+	if unescaped, err := url.PathUnescape(song); err == nil {
+		return unescaped
+	}
+	return song
+}
+
+// defaultNeighborLimit is the number of results returned by the neighbor and
+// transition endpoints when no limit is given.
+const defaultNeighborLimit = 10
+
+// limitParam returns the limit query param, or defaultNeighborLimit if it
+// isn't set.
+func limitParam(c echo.Context) (int, error) {
+	limit := c.QueryParam("limit")
+	if limit == "" {
+		return defaultNeighborLimit, nil
+	}
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 1 {
+		return 0, badRequest("Invalid limit param")
+	}
+	return n, nil
+}
+
+// SongStatsAPI returns the performance history of a song.
+func SongStatsAPI(c echo.Context) error {
+	idx, err := getIndex(c)
+	if err != nil {
+		return err
+	}
+	stats, err := idx.Stats(songParam(c))
+	if err != nil {
+		return indexError(err)
+	}
+	return c.JSON(http.StatusOK, stats)
+}
+
+// SongNeighborsAPI returns the songs most often played in the same show as a
+// song. The sort param orders them by "count", "lift" or "pmi".
+func SongNeighborsAPI(c echo.Context) error {
+	idx, err := getIndex(c)
+	if err != nil {
+		return err
+	}
+	limit, err := limitParam(c)
+	if err != nil {
+		return err
+	}
+	by := c.QueryParam("sort")
+	switch by {
+	case "", index.ByCount, index.ByLift, index.ByPMI:
+	default:
+		return badRequest("Invalid sort param")
+	}
+	neighbors, err := idx.Neighbors(songParam(c), limit, by)
+	if err != nil {
+		return indexError(err)
+	}
+	return c.JSON(http.StatusOK, neighbors)
+}
+
+// SongTransitionsAPI returns the songs that most often directly follow a song.
+func SongTransitionsAPI(c echo.Context) error {
+	idx, err := getIndex(c)
+	if err != nil {
+		return err
+	}
+	limit, err := limitParam(c)
+	if err != nil {
+		return err
+	}
+	transitions, err := idx.Transitions(songParam(c), limit)
+	if err != nil {
+		return indexError(err)
+	}
+	return c.JSON(http.StatusOK, transitions)
+}
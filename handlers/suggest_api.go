@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/awbraunstein/setlist-search/index"
+	"github.com/labstack/echo/v4"
+)
+
+// SuggestResults is the json payload of the api/suggest endpoint.
+type SuggestResults struct {
+	Prefix      string             `json:"prefix"`
+	Suggestions []index.Suggestion `json:"suggestions"`
+}
+
+// SuggestAPI completes the query term given by the prefix param with
+// keywords and songs, most played first.
+func SuggestAPI(c echo.Context) error {
+	prefix := c.QueryParam("prefix")
+	if prefix == "" {
+		return badRequest("Missing prefix param")
+	}
+	limit, err := limitParam(c)
+	if err != nil {
+		return err
+	}
+	idx, err := getIndex(c)
+	if err != nil {
+		return err
+	}
+	if notModified(c, idx) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return c.JSON(http.StatusOK, &SuggestResults{
+		Prefix:      prefix,
+		Suggestions: idx.Suggest(prefix, limit),
+	})
+}
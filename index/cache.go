@@ -0,0 +1,181 @@
+package index
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/awbraunstein/setlist-search/index/query"
+)
+
+// entryOverhead approximates the memory used by a cache entry besides its key
+// and results.
+const entryOverhead = 128
+
+// Cache is an LRU cache of query results. Results are keyed by the index
+// generation and the canonical form of the query, so queries that only differ
+// in spacing, quoting or aliases share an entry, and the results of an old
+// index are never returned for a new one. Cache is safe for concurrent use.
+type Cache struct {
+	maxBytes int64
+
+	mu      sync.Mutex
+	bytes   int64
+	lru     *list.List // of *cacheEntry, most recently used first
+	entries map[string]*list.Element
+	stats   CacheStats
+}
+
+type cacheEntry struct {
+	key   string
+	shows []int
+	size  int64
+}
+
+// CacheStats describes the use of a Cache.
+type CacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Entries   int    `json:"entries"`
+	Bytes     int64  `json:"bytes"`
+	MaxBytes  int64  `json:"max_bytes"`
+}
+
+// NewCache returns a Cache that holds at most about maxBytes of results. A
+// Cache with a maxBytes that isn't positive caches nothing.
+func NewCache(maxBytes int64) *Cache {
+	return &Cache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func cacheKey(i *Index, stmt query.Statement) string {
+	var b strings.Builder
+	b.WriteString(strconv.FormatUint(i.generation, 10))
+	b.WriteByte(' ')
+	writeKey(&b, stmt)
+	return b.String()
+}
+
+// writeKey writes an unambiguous encoding of stmt. Unlike stmt.String(), it
+// quotes the value of each expression, so that a quoted term such as
+// "(tweezer AND fee)" can't be mistaken for the query tweezer AND fee.
+func writeKey(b *strings.Builder, stmt query.Statement) {
+	switch s := stmt.(type) {
+	case *query.AndStatement:
+		b.WriteString("AND(")
+		writeKey(b, s.Left)
+		b.WriteByte(' ')
+		writeKey(b, s.Right)
+		b.WriteByte(')')
+	case *query.OrStatement:
+		b.WriteString("OR(")
+		writeKey(b, s.Left)
+		b.WriteByte(' ')
+		writeKey(b, s.Right)
+		b.WriteByte(')')
+	case *query.NotStatement:
+		b.WriteString("NOT(")
+		writeKey(b, s.S)
+		b.WriteByte(')')
+	case *query.Expression:
+		if s.Field != "" {
+			b.WriteString(s.Field)
+			b.WriteByte(':')
+		}
+		b.WriteString(strconv.Quote(s.Value))
+	default:
+		panic(fmt.Sprintf("index: unexpected node type %T", s))
+	}
+}
+
+// Eval returns the sorted showids that match a parsed query, like i.Eval.
+// The returned slice is shared and must not be modified.
+func (c *Cache) Eval(ctx context.Context, i *Index, stmt query.Statement) ([]int, error) {
+	key := cacheKey(i, stmt)
+	if shows, ok := c.get(key); ok {
+		return shows, nil
+	}
+	shows, err := i.Eval(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	c.add(key, shows)
+	return shows, nil
+}
+
+// Query parses and evaluates a query, like i.Query.
+// The returned slice is shared and must not be modified.
+func (c *Cache) Query(ctx context.Context, i *Index, q string) ([]int, error) {
+	stmt, err := i.Parse(q)
+	if err != nil {
+		return nil, err
+	}
+	return c.Eval(ctx, i, stmt)
+}
+
+func (c *Cache) get(key string) ([]int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	c.lru.MoveToFront(e)
+	return e.Value.(*cacheEntry).shows, true
+}
+
+func (c *Cache) add(key string, shows []int) {
+	size := int64(len(key)) + int64(len(shows))*strconv.IntSize/8 + entryOverhead
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if size > c.maxBytes {
+		return
+	}
+	if _, ok := c.entries[key]; ok {
+		// Another request evaluated the same query concurrently.
+		return
+	}
+	for c.bytes+size > c.maxBytes {
+		c.removeOldest()
+		c.stats.Evictions++
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, shows: shows, size: size})
+	c.bytes += size
+}
+
+func (c *Cache) removeOldest() {
+	e := c.lru.Back()
+	entry := e.Value.(*cacheEntry)
+	c.lru.Remove(e)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size
+}
+
+// Purge removes every entry from the cache.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Init()
+	c.entries = make(map[string]*list.Element)
+	c.bytes = 0
+}
+
+// Stats returns the current statistics of the cache.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = len(c.entries)
+	stats.Bytes = c.bytes
+	stats.MaxBytes = c.maxBytes
+	return stats
+}
@@ -0,0 +1,118 @@
+package index
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+	i, err := Read(strings.NewReader(statsIndex))
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	c := NewCache(1 << 20)
+	ctx := context.Background()
+
+	for _, q := range []string{"YEM AND reba", "you-enjoy-myself  AND  reba", `"You Enjoy Myself" AND reba`} {
+		got, err := c.Query(ctx, i, q)
+		if err != nil {
+			t.Fatalf("Query(%q) got unexpected error: %v", q, err)
+		}
+		if want := []int{1, 3, 4}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Query(%q) = %v, but expected %v", q, got, want)
+		}
+	}
+	if got, want := c.Stats(), (CacheStats{Hits: 2, Misses: 1, Entries: 1, Bytes: c.Stats().Bytes, MaxBytes: 1 << 20}); got != want {
+		t.Errorf("got stats %+v, but expected %+v", got, want)
+	}
+
+	// A new index never sees the results of the old one.
+	j, err := Read(strings.NewReader(statsIndex))
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	if _, err := c.Query(ctx, j, "YEM AND reba"); err != nil {
+		t.Fatalf("Query got unexpected error: %v", err)
+	}
+	if got := c.Stats(); got.Misses != 2 || got.Entries != 2 {
+		t.Errorf("got stats %+v, but expected a miss for the new index", got)
+	}
+
+	c.Purge()
+	if got := c.Stats(); got.Entries != 0 || got.Bytes != 0 {
+		t.Errorf("got stats %+v after Purge, but expected an empty cache", got)
+	}
+
+	if _, err := c.Query(ctx, i, "fee AND"); err == nil {
+		t.Error("Expected an error for a malformed query, but got none")
+	}
+}
+
+func TestCacheQuotedTerm(t *testing.T) {
+	i, err := Read(strings.NewReader(statsIndex))
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	c := NewCache(1 << 20)
+	ctx := context.Background()
+
+	// The quoted term is a single song that was never played, so it must not
+	// share an entry with the query that it looks like.
+	for _, tc := range []struct {
+		q    string
+		want []int
+	}{
+		{q: `"(reba AND fee)"`, want: []int{}},
+		{q: "reba AND fee", want: []int{1, 2, 3, 4}},
+		// A field isn't the song with the same value.
+		{q: "date:1990", want: []int{1, 2}},
+		{q: `"date:1990"`, want: []int{}},
+	} {
+		got, err := c.Query(ctx, i, tc.q)
+		if err != nil {
+			t.Fatalf("Query(%q) got unexpected error: %v", tc.q, err)
+		}
+		if len(got) != len(tc.want) || (len(got) > 0 && !reflect.DeepEqual(got, tc.want)) {
+			t.Errorf("Query(%q) = %v, but expected %v", tc.q, got, tc.want)
+		}
+	}
+	if got := c.Stats(); got.Misses != 4 || got.Entries != 4 {
+		t.Errorf("got stats %+v, but expected an entry for each query", got)
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	i, err := Read(strings.NewReader(statsIndex))
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	// Room for about two entries.
+	c := NewCache(2*entryOverhead + 100)
+	ctx := context.Background()
+	for _, q := range []string{"fee", "reba", "fee", "YEM"} {
+		if _, err := c.Query(ctx, i, q); err != nil {
+			t.Fatalf("Query(%q) got unexpected error: %v", q, err)
+		}
+	}
+	stats := c.Stats()
+	if stats.Evictions != 1 || stats.Entries != 2 || stats.Bytes > stats.MaxBytes {
+		t.Errorf("got stats %+v, but expected one eviction", stats)
+	}
+	// reba was the least recently used, so it was evicted and fee is kept.
+	if _, err := c.Query(ctx, i, "fee"); err != nil {
+		t.Fatalf("Query got unexpected error: %v", err)
+	}
+	if got := c.Stats().Hits; got != stats.Hits+1 {
+		t.Errorf("got %d hits, but expected fee to still be cached", got)
+	}
+
+	c = NewCache(0)
+	if _, err := c.Query(ctx, i, "fee"); err != nil {
+		t.Fatalf("Query got unexpected error: %v", err)
+	}
+	if got := c.Stats().Entries; got != 0 {
+		t.Errorf("got %d entries, but expected a disabled cache to be empty", got)
+	}
+}
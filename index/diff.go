@@ -0,0 +1,190 @@
+package index
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/awbraunstein/setlist-search/searcher"
+)
+
+// Changes is the difference between two indexes.
+type Changes struct {
+	AddedShows    []int        `json:"added_shows,omitempty"`
+	RemovedShows  []int        `json:"removed_shows,omitempty"`
+	ModifiedShows []ShowChange `json:"modified_shows,omitempty"`
+	AddedSongs    []string     `json:"added_songs,omitempty"`
+	RemovedSongs  []string     `json:"removed_songs,omitempty"`
+	ModifiedSongs []SongChange `json:"modified_songs,omitempty"`
+}
+
+// ShowChange describes how a show changed.
+type ShowChange struct {
+	ID int `json:"id"`
+	// Date is the date of the show in the new index.
+	Date string `json:"date"`
+	// Fields are the changed attributes of the show.
+	Fields []FieldChange `json:"fields,omitempty"`
+	// Sets are the sets that were added, removed or changed.
+	Sets []SetChange `json:"sets,omitempty"`
+}
+
+// FieldChange is a changed attribute of a show: "date", "url", "venue",
+// "location", "tour", "origin" or "set order".
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// SetChange is a set whose songs changed. Sets are written in the setlist
+// serialization format, e.g. "a,b->c". Old is empty for an added set and New is
+// empty for a removed one.
+type SetChange struct {
+	// Set is the short name of the set, e.g. "2" or "e".
+	Set string `json:"set"`
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+}
+
+// SongChange describes how the names and aliases of a song changed.
+type SongChange struct {
+	ID             string   `json:"id"`
+	AddedNames     []string `json:"added_names,omitempty"`
+	RemovedNames   []string `json:"removed_names,omitempty"`
+	AddedAliases   []string `json:"added_aliases,omitempty"`
+	RemovedAliases []string `json:"removed_aliases,omitempty"`
+}
+
+// Empty reports whether the indexes are the same.
+func (c *Changes) Empty() bool {
+	return len(c.AddedShows) == 0 && len(c.RemovedShows) == 0 && len(c.ModifiedShows) == 0 &&
+		len(c.AddedSongs) == 0 && len(c.RemovedSongs) == 0 && len(c.ModifiedSongs) == 0
+}
+
+// Summary returns a one line summary of the changes.
+func (c *Changes) Summary() string {
+	return fmt.Sprintf("shows: %d added, %d removed, %d modified; songs: %d added, %d removed, %d modified",
+		len(c.AddedShows), len(c.RemovedShows), len(c.ModifiedShows),
+		len(c.AddedSongs), len(c.RemovedSongs), len(c.ModifiedSongs))
+}
+
+// Diff returns the changes that turn index a into index b. Shows are compared
+// by showid and songs by ID.
+func Diff(a, b *Index) *Changes {
+	c := &Changes{}
+	for _, id := range b.ShowIDs() {
+		old, ok := a.setlists[id]
+		if !ok {
+			c.AddedShows = append(c.AddedShows, id)
+			continue
+		}
+		if sc, changed := diffShow(old, b.setlists[id]); changed {
+			c.ModifiedShows = append(c.ModifiedShows, sc)
+		}
+	}
+	for _, id := range a.ShowIDs() {
+		if _, ok := b.setlists[id]; !ok {
+			c.RemovedShows = append(c.RemovedShows, id)
+		}
+	}
+
+	for _, s := range b.songTable.Songs() {
+		old := a.songTable.Song(s.ID)
+		if old == nil {
+			c.AddedSongs = append(c.AddedSongs, s.ID)
+			continue
+		}
+		sc := SongChange{ID: s.ID}
+		sc.AddedNames, sc.RemovedNames = diffStrings(old.Names, s.Names)
+		sc.AddedAliases, sc.RemovedAliases = diffStrings(old.Aliases, s.Aliases)
+		if len(sc.AddedNames)+len(sc.RemovedNames)+len(sc.AddedAliases)+len(sc.RemovedAliases) > 0 {
+			c.ModifiedSongs = append(c.ModifiedSongs, sc)
+		}
+	}
+	for _, s := range a.songTable.Songs() {
+		if b.songTable.Song(s.ID) == nil {
+			c.RemovedSongs = append(c.RemovedSongs, s.ID)
+		}
+	}
+	return c
+}
+
+// diffShow compares two versions of a show.
+func diffShow(a, b *searcher.Setlist) (ShowChange, bool) {
+	sc := ShowChange{ID: b.ShowId, Date: b.Date}
+	if a.String() == b.String() {
+		return sc, false
+	}
+	for _, f := range []struct{ name, old, new string }{
+		{"date", a.Date, b.Date},
+		{"url", a.Url, b.Url},
+		{"venue", a.Venue, b.Venue},
+		{"location", a.Location, b.Location},
+		{"tour", a.Tour, b.Tour},
+		{"origin", a.Origin, b.Origin},
+	} {
+		if f.old != f.new {
+			sc.Fields = append(sc.Fields, FieldChange{Field: f.name, Old: f.old, New: f.new})
+		}
+	}
+
+	oldSets := make(map[string]string)
+	var oldOrder []string
+	for _, set := range a.Sets {
+		oldSets[set.Name()] = set.String()
+		oldOrder = append(oldOrder, set.Name())
+	}
+	newSets := make(map[string]bool)
+	var newOrder []string
+	for _, set := range b.Sets {
+		name := set.Name()
+		newSets[name] = true
+		newOrder = append(newOrder, name)
+		if old, ok := oldSets[name]; !ok || old != set.String() {
+			sc.Sets = append(sc.Sets, SetChange{Set: name, Old: old, New: set.String()})
+		}
+	}
+	var kept []string
+	for _, name := range oldOrder {
+		if !newSets[name] {
+			sc.Sets = append(sc.Sets, SetChange{Set: name, Old: oldSets[name]})
+		} else {
+			kept = append(kept, name)
+		}
+	}
+	// The same sets may have been played in a different order.
+	var order []string
+	for _, name := range newOrder {
+		if _, ok := oldSets[name]; ok {
+			order = append(order, name)
+		}
+	}
+	if strings.Join(kept, " ") != strings.Join(order, " ") {
+		sc.Fields = append(sc.Fields, FieldChange{Field: "set order", Old: strings.Join(oldOrder, " "), New: strings.Join(newOrder, " ")})
+	}
+	return sc, true
+}
+
+// diffStrings returns the strings that are only in b, and those only in a.
+func diffStrings(a, b []string) (added, removed []string) {
+	inA := make(map[string]bool)
+	for _, s := range a {
+		inA[s] = true
+	}
+	inB := make(map[string]bool)
+	for _, s := range b {
+		inB[s] = true
+		if !inA[s] {
+			added = append(added, s)
+		}
+	}
+	for _, s := range a {
+		if !inB[s] {
+			removed = append(removed, s)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
@@ -0,0 +1,102 @@
+package index
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const diffOld = `setsearcher index 2
+[SONGS]
+Fee|fee
+Reba|reba
+Tube|tube
+You Enjoy Myself|you-enjoy-myself
+[END]
+[ALIASES]
+you-enjoy-myself|YEM
+[END]
+[SETLISTS]
+ID{1}DATE{1990-01-20}URL{a}SET1{you-enjoy-myself,fee}SET2{reba}
+ID{2}DATE{1990-01-21}URL{b}SET1{fee,reba}
+ID{3}DATE{1991-05-02}URL{c}SET1{fee}ENCORE{reba}
+[END]`
+
+const diffNew = `setsearcher index 2
+[SONGS]
+Fee|fee
+Reba|reba
+Tweezer|tweezer
+You Enjoy Myself|you-enjoy-myself
+[END]
+[ALIASES]
+you-enjoy-myself|Y.E.M.
+[END]
+[SETLISTS]
+ID{1}DATE{1990-01-20}URL{a}SET1{you-enjoy-myself->fee}ENCORE{tweezer}
+ID{2}DATE{1990-01-21}URL{b}SET1{fee,reba}
+ID{4}DATE{1992-01-01}URL{d}SET1{tweezer}
+[END]`
+
+func readIndex(t *testing.T, s string) *Index {
+	t.Helper()
+	i, err := Read(strings.NewReader(s))
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	return i
+}
+
+func TestDiff(t *testing.T) {
+	a, b := readIndex(t, diffOld), readIndex(t, diffNew)
+	got := Diff(a, b)
+	want := &Changes{
+		AddedShows:   []int{4},
+		RemovedShows: []int{3},
+		ModifiedShows: []ShowChange{{
+			ID:   1,
+			Date: "1990-01-20",
+			Sets: []SetChange{
+				{Set: "1", Old: "you-enjoy-myself,fee", New: "you-enjoy-myself->fee"},
+				{Set: "e", New: "tweezer"},
+				{Set: "2", Old: "reba"},
+			},
+		}},
+		AddedSongs:   []string{"tweezer"},
+		RemovedSongs: []string{"tube"},
+		ModifiedSongs: []SongChange{{
+			ID:             "you-enjoy-myself",
+			AddedAliases:   []string{"Y.E.M."},
+			RemovedAliases: []string{"YEM"},
+		}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff got:\n%+v\nbut expected:\n%+v", got, want)
+	}
+	if got, want := got.Summary(), "shows: 1 added, 1 removed, 1 modified; songs: 1 added, 1 removed, 1 modified"; got != want {
+		t.Errorf("Summary() = %q, but expected %q", got, want)
+	}
+	if !Diff(a, a).Empty() {
+		t.Errorf("Diff of an index with itself got %+v, but expected no changes", Diff(a, a))
+	}
+}
+
+func TestDiffShowFields(t *testing.T) {
+	a := readIndex(t, "setsearcher index 2\n[SONGS]\n[END]\n[ALIASES]\n[END]\n[SETLISTS]\nID{1}DATE{1990-01-20}URL{a}VENUE{Hall}SET1{a}SET2{b}\n[END]")
+	b := readIndex(t, "setsearcher index 2\n[SONGS]\n[END]\n[ALIASES]\n[END]\n[SETLISTS]\nID{1}DATE{1990-01-21}URL{a}TOUR{Winter}ORIGIN{override}SET2{b}SET1{a}\n[END]")
+	got := Diff(a, b).ModifiedShows
+	want := []ShowChange{{
+		ID:   1,
+		Date: "1990-01-21",
+		Fields: []FieldChange{
+			{Field: "date", Old: "1990-01-20", New: "1990-01-21"},
+			{Field: "venue", Old: "Hall"},
+			{Field: "tour", New: "Winter"},
+			{Field: "origin", New: "override"},
+			{Field: "set order", Old: "1 2", New: "2 1"},
+		},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff got modified shows %+v, but expected %+v", got, want)
+	}
+}
@@ -0,0 +1,60 @@
+package index
+
+import (
+	"context"
+
+	"github.com/awbraunstein/setlist-search/index/query"
+)
+
+// Explanation describes how a part of a query matched the index.
+type Explanation struct {
+	// Op is "AND", "OR" or "NOT" for operators, "SONG" for songs and "FIELD"
+	// for fielded terms such as venue:"Hampton Coliseum".
+	Op string `json:"op"`
+	// Statement is the canonical form of the part of the query.
+	Statement string `json:"statement"`
+	// Name is the human readable name of a song.
+	Name string `json:"name,omitempty"`
+	// Matches is the number of shows that the part of the query matched.
+	Matches  int            `json:"matches"`
+	Children []*Explanation `json:"children,omitempty"`
+}
+
+// Explain evaluates each part of a parsed query and reports how many shows it
+// matched.
+func (i *Index) Explain(ctx context.Context, stmt query.Statement) (*Explanation, error) {
+	shows, err := i.Eval(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	e := &Explanation{Statement: stmt.String(), Matches: len(shows)}
+	var children []query.Statement
+	switch n := stmt.(type) {
+	case *query.AndStatement:
+		e.Op = "AND"
+		children = []query.Statement{n.Left, n.Right}
+	case *query.OrStatement:
+		e.Op = "OR"
+		children = []query.Statement{n.Left, n.Right}
+	case *query.NotStatement:
+		e.Op = "NOT"
+		children = []query.Statement{n.S}
+	case *query.Expression:
+		if n.Field != "" {
+			e.Op = "FIELD"
+			break
+		}
+		e.Op = "SONG"
+		if s := i.Song(n.Value); s != nil {
+			e.Name = s.Name()
+		}
+	}
+	for _, child := range children {
+		ce, err := i.Explain(ctx, child)
+		if err != nil {
+			return nil, err
+		}
+		e.Children = append(e.Children, ce)
+	}
+	return e, nil
+}
@@ -0,0 +1,64 @@
+package index
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	i, err := Read(strings.NewReader(statsIndex))
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	stmt, err := i.Parse("fee AND NOT YEM")
+	if err != nil {
+		t.Fatalf("Parse got unexpected error: %v", err)
+	}
+	got, err := i.Explain(context.Background(), stmt)
+	if err != nil {
+		t.Fatalf("Explain got unexpected error: %v", err)
+	}
+	want := &Explanation{
+		Op:        "AND",
+		Statement: "(fee AND NOT(you-enjoy-myself))",
+		Matches:   3,
+		Children: []*Explanation{
+			{Op: "SONG", Statement: "fee", Name: "fee", Matches: 6},
+			{Op: "NOT", Statement: "NOT(you-enjoy-myself)", Matches: 3, Children: []*Explanation{
+				{Op: "SONG", Statement: "you-enjoy-myself", Name: "You Enjoy Myself", Matches: 3},
+			}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Explain got %+v, but expected %+v", got, want)
+	}
+}
+
+func TestExplainField(t *testing.T) {
+	i, err := Read(strings.NewReader(statsIndex))
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	stmt, err := i.Parse("fee AND year:1991")
+	if err != nil {
+		t.Fatalf("Parse got unexpected error: %v", err)
+	}
+	got, err := i.Explain(context.Background(), stmt)
+	if err != nil {
+		t.Fatalf("Explain got unexpected error: %v", err)
+	}
+	want := &Explanation{
+		Op:        "AND",
+		Statement: `(fee AND year:"1991")`,
+		Matches:   2,
+		Children: []*Explanation{
+			{Op: "SONG", Statement: "fee", Name: "fee", Matches: 6},
+			{Op: "FIELD", Statement: `year:"1991"`, Matches: 2},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Explain got %+v, but expected %+v", got, want)
+	}
+}
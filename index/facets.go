@@ -0,0 +1,111 @@
+package index
+
+import (
+	"sort"
+
+	"github.com/awbraunstein/setlist-search/searcher"
+)
+
+// FacetCount is the number of matched shows that share a value.
+type FacetCount struct {
+	Value string `json:"value"`
+	// Name is the human readable name of a song value.
+	Name  string `json:"name,omitempty"`
+	Count int    `json:"count"`
+}
+
+// Facets summarize a set of shows.
+type Facets struct {
+	// Years counts the shows per year, in chronological order.
+	Years []FacetCount `json:"years"`
+	// Tours and Venues count the shows per tour and per venue.
+	Tours  []FacetCount `json:"tours"`
+	Venues []FacetCount `json:"venues"`
+	// Sets counts the shows per set ("1", "2", "e", ...) that any of the
+	// matched songs were played in.
+	Sets []FacetCount `json:"sets"`
+	// Songs counts the shows that other songs were played in.
+	Songs []FacetCount `json:"songs"`
+}
+
+// Facets returns the facets of shows, which are typically the result of a
+// query that matched songs. Tours, venues and songs are limited to the n most
+// common values, or all of them if n is not positive.
+func (i *Index) Facets(shows []int, songs []string, n int) *Facets {
+	matched := make(map[string]bool)
+	for _, song := range songs {
+		matched[song] = true
+	}
+	years := make(map[string]int)
+	tours := make(map[string]int)
+	venues := make(map[string]int)
+	sets := make(map[string]int)
+	others := make(map[string]int)
+	for _, show := range shows {
+		sl := i.setlists[show]
+		if sl == nil {
+			continue
+		}
+		if len(sl.Date) >= 4 {
+			years[sl.Date[:4]]++
+		}
+		if sl.Tour != "" {
+			tours[sl.Tour]++
+		}
+		if sl.Venue != "" {
+			venues[sl.Venue]++
+		}
+		seen := make(map[string]bool)
+		for _, set := range sl.Sets {
+			if set.Kind == searcher.SoundcheckSet {
+				continue
+			}
+			inSet := false
+			for _, song := range set.Songs {
+				if matched[song] {
+					inSet = true
+				} else if !seen[song] {
+					seen[song] = true
+					others[song]++
+				}
+			}
+			if inSet {
+				sets[set.Name()]++
+			}
+		}
+	}
+
+	f := &Facets{
+		Years:  facetCounts(years, 0),
+		Tours:  facetCounts(tours, n),
+		Venues: facetCounts(venues, n),
+		Sets:   facetCounts(sets, 0),
+		Songs:  facetCounts(others, n),
+	}
+	sort.Slice(f.Years, func(a, b int) bool {
+		return f.Years[a].Value < f.Years[b].Value
+	})
+	for k := range f.Songs {
+		f.Songs[k].Name = i.SongName(f.Songs[k].Value)
+	}
+	return f
+}
+
+// facetCounts returns the n most common values of counts, or all of them if n
+// is not positive.
+func facetCounts(counts map[string]int, n int) []FacetCount {
+	facets := make([]FacetCount, 0, len(counts))
+	for value, count := range counts {
+		facets = append(facets, FacetCount{Value: value, Count: count})
+	}
+	sort.Slice(facets, func(a, b int) bool {
+		if facets[a].Count != facets[b].Count {
+			return facets[a].Count > facets[b].Count
+		}
+		return facets[a].Value < facets[b].Value
+	})
+	if n > 0 && len(facets) > n {
+		facets = facets[:n]
+	}
+	return facets
+}
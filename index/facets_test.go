@@ -0,0 +1,46 @@
+package index
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/awbraunstein/setlist-search/index/query"
+)
+
+func TestFacets(t *testing.T) {
+	i, err := Read(strings.NewReader(`setsearcher index 2
+[SONGS]
+[END]
+[ALIASES]
+[END]
+[SETLISTS]
+ID{1}DATE{1997-11-22}URL{a}VENUE{Hampton Coliseum}TOUR{Fall Tour}SET1{tweezer,fee}SET2{reba,tweezer}
+ID{2}DATE{1997-11-23}URL{b}VENUE{Hampton Coliseum}TOUR{Fall Tour}SOUNDCHECK{tweezer}SET1{fee}ENCORE{tweezer}
+ID{3}DATE{1998-04-02}URL{c}VENUE{Nassau Coliseum}SET1{reba,tweezer}
+ID{4}DATE{1998-04-03}URL{d}SET1{fee}
+[END]`))
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	stmt, err := i.Parse("tweezer AND NOT fluffhead")
+	if err != nil {
+		t.Fatalf("unable to parse query; %v", err)
+	}
+	shows, err := i.Eval(context.Background(), stmt)
+	if err != nil {
+		t.Fatalf("unable to evaluate query; %v", err)
+	}
+	got := i.Facets(shows, query.Terms(stmt), 1)
+	want := &Facets{
+		Years:  []FacetCount{{Value: "1997", Count: 2}, {Value: "1998", Count: 1}},
+		Tours:  []FacetCount{{Value: "Fall Tour", Count: 2}},
+		Venues: []FacetCount{{Value: "Hampton Coliseum", Count: 2}},
+		Sets:   []FacetCount{{Value: "1", Count: 2}, {Value: "2", Count: 1}, {Value: "e", Count: 1}},
+		Songs:  []FacetCount{{Value: "fee", Name: "fee", Count: 2}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %+v\nexpected: %+v", got, want)
+	}
+}
@@ -2,11 +2,13 @@ package index
 
 import (
 	"context"
+	"fmt"
 	"sort"
 	"strings"
 	"time"
 
 	"github.com/awbraunstein/setlist-search/index/query"
+	"github.com/awbraunstein/setlist-search/searcher"
 	"github.com/pkg/errors"
 )
 
@@ -14,6 +16,76 @@ func (i *Index) Songs() map[string]string {
 	return i.songs
 }
 
+// Song returns the canonical song with the given ID, or nil if there isn't
+// one.
+func (i *Index) Song(id string) *Song {
+	return i.songTable.Song(id)
+}
+
+// SongName returns the human readable name of the song with the given ID, or
+// the ID itself if the song has no name.
+func (i *Index) SongName(id string) string {
+	if s := i.Song(id); s != nil {
+		return s.Name()
+	}
+	return id
+}
+
+// SongTable returns the table of canonical songs in the index.
+func (i *Index) SongTable() *SongTable {
+	return i.songTable
+}
+
+// ResolveSong returns the ID of the song that name refers to. Name may be a
+// song ID, a human readable name or an alias such as "YEM".
+func (i *Index) ResolveSong(name string) (string, bool) {
+	return i.songTable.Resolve(name)
+}
+
+// Generation returns a number that is unique to this index within the
+// process. Indexes that are loaded later have larger generations.
+func (i *Index) Generation() uint64 {
+	return i.generation
+}
+
+// Hash returns the hex encoded SHA-256 of the serialized index. Indexes with
+// the same contents have the same hash.
+func (i *Index) Hash() string {
+	return i.hash
+}
+
+// ModTime returns when the index was last modified, or when it was read if
+// that isn't known.
+func (i *Index) ModTime() time.Time {
+	return i.modTime
+}
+
+// NumShows returns the number of shows in the index.
+func (i *Index) NumShows() int {
+	return len(i.setlists)
+}
+
+// ShowIDs returns the sorted showids of every show in the index.
+func (i *Index) ShowIDs() []int {
+	ids := make([]int, 0, len(i.setlists))
+	for id := range i.setlists {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// NumSongs returns the number of songs in the index.
+func (i *Index) NumSongs() int {
+	return len(i.songs)
+}
+
+// Show returns the setlist of the show with the given showid, or nil if there
+// isn't one.
+func (i *Index) Show(id int) *searcher.Setlist {
+	return i.setlists[id]
+}
+
 func (i *Index) ShowDate(id int) string {
 	sl := i.setlists[id]
 	if sl != nil {
@@ -31,26 +103,70 @@ func (i *Index) ShowUrl(id int) string {
 }
 
 func (i *Index) Query(ctx context.Context, q string) ([]int, error) {
-	p := query.NewParser(strings.NewReader(q))
-	stmt, err := p.Parse()
+	stmt, err := i.Parse(q)
 	if err != nil {
 		return nil, err
 	}
+	return i.Eval(ctx, stmt)
+}
+
+// QueryError is returned for queries that can't be parsed.
+type QueryError struct {
+	Query string
+	Err   error
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("bad query %q: %v", e.Query, e.Err)
+}
+
+// Parse parses a query, resolving song names and aliases against the index.
+func (i *Index) Parse(q string) (query.Statement, error) {
+	stmt, err := query.NewResolvingParser(strings.NewReader(q), i.songTable).Parse()
+	if err != nil {
+		return nil, &QueryError{Query: q, Err: err}
+	}
+	return stmt, nil
+}
+
+// Eval returns the sorted showids that match a parsed query. If ctx is done
+// before the query is evaluated, the cause of the error is ctx.Err().
+func (i *Index) Eval(ctx context.Context, stmt query.Statement) ([]int, error) {
 	return i.evaluate(ctx, stmt)
 }
 
+// Match returns the sorted showids of the shows that match a setlist pattern.
+// If ctx is done before every show is matched, the cause of the error is
+// ctx.Err().
+func (i *Index) Match(ctx context.Context, s *searcher.Searcher) ([]int, error) {
+	var shows []int
+	for id, sl := range i.setlists {
+		if err := ctx.Err(); err != nil {
+			return nil, errors.Wrap(err, "match stopped")
+		}
+		if s.Match(sl) {
+			shows = append(shows, id)
+		}
+	}
+	sort.Ints(shows)
+	return shows, nil
+}
+
 func (i *Index) evaluate(ctx context.Context, stmt query.Statement) ([]int, error) {
 	var eval func(query.Statement) map[int]bool
 	var err error
 	eval = func(stmt query.Statement) map[int]bool {
-		if deadline, ok := ctx.Deadline(); ok && deadline.After(time.Now()) {
-			err = errors.New("Deadline exceeded for query")
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = errors.Wrap(ctxErr, "query stopped")
 			return nil
 		}
 		switch n := stmt.(type) {
 		case *query.AndStatement:
 			leftShows := eval(n.Left)
 			rightShows := eval(n.Right)
+			if err != nil {
+				return nil
+			}
 			// intersection
 			newShows := make(map[int]bool)
 			for show := range leftShows {
@@ -62,6 +178,10 @@ func (i *Index) evaluate(ctx context.Context, stmt query.Statement) ([]int, erro
 		case *query.OrStatement:
 			leftShows := eval(n.Left)
 			rightShows := eval(n.Right)
+			if err != nil {
+				// ctx is done, so the partial results are discarded.
+				return nil
+			}
 			// union
 			for show := range leftShows {
 				rightShows[show] = true
@@ -69,6 +189,9 @@ func (i *Index) evaluate(ctx context.Context, stmt query.Statement) ([]int, erro
 			return rightShows
 		case *query.NotStatement:
 			shows := eval(n.S)
+			if err != nil {
+				return nil
+			}
 			newShows := make(map[int]bool)
 			for show := range i.setlists {
 				if !shows[show] {
@@ -77,6 +200,9 @@ func (i *Index) evaluate(ctx context.Context, stmt query.Statement) ([]int, erro
 			}
 			return newShows
 		case *query.Expression:
+			if n.Field != "" {
+				return i.fieldShows(n.Field, n.Value)
+			}
 			shows := make(map[int]bool)
 			for _, show := range i.reverseIndex[n.Value] {
 				shows[show] = true
@@ -102,3 +228,28 @@ func (i *Index) evaluate(ctx context.Context, stmt query.Statement) ([]int, erro
 	return showList, nil
 
 }
+
+// fieldShows returns the shows whose field matches value. Venues, locations
+// and tours match if they contain the value, ignoring case and punctuation,
+// and dates if they start with it.
+func (i *Index) fieldShows(field, value string) map[int]bool {
+	shows := make(map[int]bool)
+	folded := foldName(value)
+	for id, sl := range i.setlists {
+		var match bool
+		switch field {
+		case query.FieldVenue:
+			match = folded != "" && strings.Contains(foldName(sl.Venue), folded)
+		case query.FieldLocation:
+			match = folded != "" && strings.Contains(foldName(sl.Location), folded)
+		case query.FieldTour:
+			match = folded != "" && strings.Contains(foldName(sl.Tour), folded)
+		case query.FieldYear, query.FieldDate:
+			match = strings.HasPrefix(sl.Date, value)
+		}
+		if match {
+			shows[id] = true
+		}
+	}
+	return shows
+}
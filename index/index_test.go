@@ -5,7 +5,12 @@ import (
 	"io/ioutil"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/awbraunstein/setlist-search/searcher"
+	"github.com/pkg/errors"
 )
 
 func TestQuery(t *testing.T) {
@@ -16,9 +21,13 @@ func TestQuery(t *testing.T) {
 	tmpName := tmpFile.Name()
 	defer os.Remove(tmpName)
 
-	indexStr := `setsearcher index 1
+	indexStr := `setsearcher index 2
 [SONGS]
 Chalk Dust Torture|chalk-dust-torture
+You Enjoy Myself|you-enjoy-myself
+[END]
+[ALIASES]
+you-enjoy-myself|YEM
 [END]
 [SETLISTS]
 ID{1249948108}DATE{2000-09-17}URL{http://phish.net/setlists/phish-september-17-2000-merriweather-post-pavilion-columbia-md-usa.html}SET1{guyute,back-on-the-train,bathtub-gin,limb-by-limb,the-moma-dance,lawn-boy,fluffhead,the-curtain-with,chalk-dust-torture}SET2{rock-and-roll,theme-from-the-bottom,dog-log,the-mango-song,free}ENCORE{contact,rocky-top}
@@ -64,6 +73,15 @@ ID{1250458932}DATE{1994-04-06}URL{http://phish.net/setlists/phish-april-06-1994-
 		}, {
 			query: "harry-hood AND NOT cavern",
 			want:  []int{1250387629},
+		}, {
+			query: "YEM AND bathtub-gin",
+			want:  []int{1250387629},
+		}, {
+			query: `"You Enjoy Myself" AND "Bathtub Gin"`,
+			want:  []int{1250387629},
+		}, {
+			query: "ac/dc-bag",
+			want:  []int{1250458591},
 		},
 	}
 
@@ -80,3 +98,154 @@ ID{1250458932}DATE{1994-04-06}URL{http://phish.net/setlists/phish-april-06-1994-
 		})
 	}
 }
+
+func TestQueryFields(t *testing.T) {
+	i, err := Read(strings.NewReader(`setsearcher index 2
+[SONGS]
+[END]
+[ALIASES]
+[END]
+[SETLISTS]
+ID{1}DATE{1997-11-22}URL{a}VENUE{Hampton Coliseum}LOCATION{Hampton, VA, USA}TOUR{Fall Tour 1997}SET1{fee}
+ID{2}DATE{1997-12-31}URL{b}VENUE{Madison Square Garden}LOCATION{New York, NY, USA}TOUR{Fall Tour 1997}SET1{reba}
+ID{3}DATE{1998-04-02}URL{c}VENUE{Nassau Coliseum}LOCATION{Uniondale, NY, USA}SET1{fee}
+ID{4}DATE{1998-11-02}URL{d}SET1{reba}
+[END]`))
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{query: "venue:coliseum", want: []int{1, 3}},
+		{query: `venue:"madison square"`, want: []int{2}},
+		// Punctuation is ignored.
+		{query: `location:"NY USA"`, want: []int{2, 3}},
+		{query: `tour:"fall tour"`, want: []int{1, 2}},
+		{query: "year:1998", want: []int{3, 4}},
+		{query: "date:1997-11", want: []int{1}},
+		{query: "date:1998-04-02 OR (reba AND NOT venue:garden)", want: []int{3, 4}},
+		// A value that is only punctuation matches nothing.
+		{query: `venue:","`, want: nil},
+		{query: "year:2020", want: nil},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.query, func(t *testing.T) {
+			got, err := i.Query(context.Background(), tc.query)
+			if err != nil {
+				t.Fatalf("Got unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected %v, but got %v", tc.want, got)
+			}
+		})
+	}
+	if _, err := i.Query(context.Background(), "city:hampton"); err == nil {
+		t.Error("Expected an error for an unknown field, but got none")
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	i, err := Read(strings.NewReader(statsIndex))
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+
+	if _, err := i.Query(context.Background(), "fee AND"); err == nil {
+		t.Error("Expected an error for a malformed query, but got none")
+	} else if _, ok := err.(*QueryError); !ok {
+		t.Errorf("Expected a *QueryError, but got %T: %v", err, err)
+	}
+
+	// A deadline that hasn't passed yet must not stop the query.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	if _, err := i.Query(ctx, "fee"); err != nil {
+		t.Errorf("Got unexpected error: %v", err)
+	}
+
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if _, err := i.Query(ctx, "fee"); errors.Cause(err) != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded, but got %v", err)
+	}
+}
+
+// cancelAfter is a context that is canceled after Err has been called n times.
+type cancelAfter struct {
+	context.Context
+	n int
+}
+
+func (c *cancelAfter) Err() error {
+	if c.n == 0 {
+		return context.Canceled
+	}
+	c.n--
+	return nil
+}
+
+func TestQueryCanceledDuringEval(t *testing.T) {
+	i, err := Read(strings.NewReader(statsIndex))
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	for _, q := range []string{"fee OR reba", "fee AND reba", "NOT (fee OR reba)", "(fee OR reba) AND (YEM OR fee)"} {
+		for n := 0; n < 8; n++ {
+			shows, err := i.Query(&cancelAfter{Context: context.Background(), n: n}, q)
+			if err == nil {
+				// The query finished before the context was canceled.
+				continue
+			}
+			if errors.Cause(err) != context.Canceled || shows != nil {
+				t.Errorf("Query(%q) canceled after %d checks got %v, %v, but expected context.Canceled", q, n, shows, err)
+			}
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	i, err := Read(strings.NewReader(statsIndex))
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	tests := []struct {
+		pattern string
+		want    []int
+	}{
+		{"(fee),(reba)", []int{2, 3}},
+		{"^(fee)", []int{2, 3, 4, 5, 6}},
+		{"(reba)$", []int{2, 4}},
+		{"(tweezer)", nil},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.pattern, func(t *testing.T) {
+			got, err := i.Match(context.Background(), searcher.MustCompile(tc.pattern))
+			if err != nil {
+				t.Fatalf("Match got unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Match(%s) = %v, but expected %v", tc.pattern, got, tc.want)
+			}
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := i.Match(ctx, searcher.MustCompile("(fee)")); errors.Cause(err) != context.Canceled {
+		t.Errorf("Match with a canceled context got error %v, but expected %v", err, context.Canceled)
+	}
+}
+
+func TestShowIDs(t *testing.T) {
+	i, err := Read(strings.NewReader(statsIndex))
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	if got, want := i.ShowIDs(), []int{1, 2, 3, 4, 5, 6}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ShowIDs() = %v, but expected %v", got, want)
+	}
+}
@@ -0,0 +1,165 @@
+package index
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// MergePolicy decides which index wins when merged indexes disagree about a
+// show or about the song that a name refers to.
+type MergePolicy int
+
+const (
+	// MergeLast keeps the version from the last index that has it, so that
+	// later indexes act as updates.
+	MergeLast MergePolicy = iota
+	// MergeFirst keeps the version from the first index that has it.
+	MergeFirst
+	// MergeNewest keeps the version from the most recently modified index.
+	// Ties go to the later index.
+	MergeNewest
+	// MergeStrict fails on any conflict.
+	MergeStrict
+)
+
+// ParseMergePolicy returns the policy named "last", "first", "newest" or
+// "strict".
+func ParseMergePolicy(name string) (MergePolicy, error) {
+	for p, n := range mergePolicyNames {
+		if n == name {
+			return MergePolicy(p), nil
+		}
+	}
+	return MergeLast, fmt.Errorf("unknown merge policy %q", name)
+}
+
+var mergePolicyNames = []string{"last", "first", "newest", "strict"}
+
+func (p MergePolicy) String() string {
+	if int(p) < len(mergePolicyNames) {
+		return mergePolicyNames[p]
+	}
+	return "MergePolicy(" + strconv.Itoa(int(p)) + ")"
+}
+
+// Conflict is a show or song name that merged indexes disagree about.
+type Conflict struct {
+	// Kind is "show" or "song".
+	Kind string
+	// Key is the showid of a show or the name of a song.
+	Key string
+	// Indexes are the positions of the indexes that disagree, and Winner is
+	// the position of the one that was kept. Nothing is kept by MergeStrict.
+	Indexes []int
+	Winner  int
+}
+
+// ConflictError is returned by Merge with MergeStrict when the indexes
+// disagree.
+type ConflictError struct {
+	Conflicts []Conflict
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("indexes have %d conflicts, the first of which is %s %s", len(e.Conflicts), e.Conflicts[0].Kind, e.Conflicts[0].Key)
+}
+
+// Merge combines indexes into a new index. Songs, names and aliases are
+// combined, and shows are taken from every index. When indexes have different
+// versions of a show, or map a song name to different songs, policy picks the
+// version that is kept and a Conflict is reported.
+func Merge(policy MergePolicy, indexes ...*Index) (*Index, []Conflict, error) {
+	if policy < MergeLast || policy > MergeStrict {
+		return nil, nil, fmt.Errorf("unknown merge policy %v", policy)
+	}
+	// better reports whether index a wins over index b.
+	better := func(a, b int) bool {
+		switch policy {
+		case MergeFirst:
+			return a < b
+		case MergeNewest:
+			ta, tb := indexes[a].modTime, indexes[b].modTime
+			if !ta.Equal(tb) {
+				return ta.After(tb)
+			}
+		}
+		return a > b
+	}
+
+	var conflicts []Conflict
+	// pick chooses among the indexes that have a key, and reports a conflict
+	// if their versions differ.
+	pick := func(kind, key string, have []int, version func(int) string) int {
+		winner := have[0]
+		differ := false
+		for _, n := range have[1:] {
+			if version(n) != version(have[0]) {
+				differ = true
+			}
+			if better(n, winner) {
+				winner = n
+			}
+		}
+		if differ {
+			conflicts = append(conflicts, Conflict{Kind: kind, Key: key, Indexes: have, Winner: winner})
+		}
+		return winner
+	}
+
+	w := NewWriter("")
+	songNames := make(map[string][]int)
+	var nameOrder []string
+	showIndexes := make(map[int][]int)
+	var showOrder []int
+	for n, i := range indexes {
+		for name := range i.songs {
+			if songNames[name] == nil {
+				nameOrder = append(nameOrder, name)
+			}
+			songNames[name] = append(songNames[name], n)
+		}
+		for _, s := range i.songTable.Songs() {
+			for _, alias := range s.Aliases {
+				w.AddAlias(s.ID, alias)
+			}
+		}
+		for _, id := range i.ShowIDs() {
+			if showIndexes[id] == nil {
+				showOrder = append(showOrder, id)
+			}
+			showIndexes[id] = append(showIndexes[id], n)
+		}
+	}
+	sort.Strings(nameOrder)
+	sort.Ints(showOrder)
+	for _, name := range nameOrder {
+		winner := pick("song", name, songNames[name], func(n int) string { return indexes[n].songs[name] })
+		w.AddSong(name, indexes[winner].songs[name])
+	}
+	for _, id := range showOrder {
+		winner := pick("show", strconv.Itoa(id), showIndexes[id], func(n int) string { return indexes[n].setlists[id].String() })
+		w.AddSetlist(indexes[winner].setlists[id])
+	}
+	if policy == MergeStrict && len(conflicts) > 0 {
+		return nil, conflicts, &ConflictError{Conflicts: conflicts}
+	}
+
+	var opts ReadOptions
+	opts.Name = "merged index"
+	for _, i := range indexes {
+		if i.modTime.After(opts.ModTime) {
+			opts.ModTime = i.modTime
+		}
+	}
+	var b bytes.Buffer
+	if _, err := w.WriteTo(&b); err != nil {
+		return nil, conflicts, err
+	}
+	merged, _, err := ReadWithOptions(&b, opts)
+	if err != nil {
+		return nil, conflicts, err
+	}
+	return merged, conflicts, nil
+}
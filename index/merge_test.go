@@ -0,0 +1,110 @@
+package index
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readIndexAt(t *testing.T, s string, modTime time.Time) *Index {
+	t.Helper()
+	i, _, err := ReadWithOptions(strings.NewReader(s), ReadOptions{ModTime: modTime})
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	return i
+}
+
+func TestMerge(t *testing.T) {
+	older := readIndexAt(t, diffOld, time.Unix(100, 0))
+	newer := readIndexAt(t, diffNew, time.Unix(200, 0))
+
+	tests := []struct {
+		policy MergePolicy
+		a, b   *Index
+		// winner is the index whose version of show 1 is kept.
+		winner *Index
+	}{
+		{MergeLast, older, newer, newer},
+		{MergeLast, newer, older, older},
+		{MergeFirst, older, newer, older},
+		{MergeNewest, newer, older, newer},
+		{MergeNewest, older, newer, newer},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.policy.String(), func(t *testing.T) {
+			merged, conflicts, err := Merge(tc.policy, tc.a, tc.b)
+			if err != nil {
+				t.Fatalf("Merge got unexpected error: %v", err)
+			}
+			if got, want := merged.ShowIDs(), []int{1, 2, 3, 4}; !reflect.DeepEqual(got, want) {
+				t.Errorf("merged shows = %v, but expected %v", got, want)
+			}
+			if got, want := merged.Show(1).String(), tc.winner.Show(1).String(); got != want {
+				t.Errorf("merged show 1 = %s, but expected %s", got, want)
+			}
+			winner := 0
+			if tc.winner == tc.b {
+				winner = 1
+			}
+			want := []Conflict{{Kind: "show", Key: "1", Indexes: []int{0, 1}, Winner: winner}}
+			if !reflect.DeepEqual(conflicts, want) {
+				t.Errorf("Merge got conflicts %v, but expected %v", conflicts, want)
+			}
+			for _, song := range []string{"tube", "tweezer"} {
+				if merged.Song(song) == nil {
+					t.Errorf("merged index is missing song %s", song)
+				}
+			}
+			if got, want := merged.Song("you-enjoy-myself").Aliases, []string{"Y.E.M.", "YEM"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("merged aliases = %v, but expected %v", got, want)
+			}
+			if !merged.ModTime().Equal(time.Unix(200, 0)) {
+				t.Errorf("merged ModTime() = %v, but expected the newest input's", merged.ModTime())
+			}
+		})
+	}
+}
+
+func TestMergeStrict(t *testing.T) {
+	a, b := readIndex(t, diffOld), readIndex(t, diffNew)
+	if _, _, err := Merge(MergeStrict, a, a); err != nil {
+		t.Errorf("Merge of identical indexes got unexpected error: %v", err)
+	}
+	_, conflicts, err := Merge(MergeStrict, a, b)
+	if _, ok := err.(*ConflictError); !ok {
+		t.Fatalf("Merge got error %v, but expected a *ConflictError", err)
+	}
+	if len(conflicts) != 1 {
+		t.Errorf("Merge got conflicts %v, but expected one", conflicts)
+	}
+}
+
+func TestMergeSongConflict(t *testing.T) {
+	a := readIndex(t, "setsearcher index 2\n[SONGS]\nGin|bathtub-gin\n[END]\n[ALIASES]\n[END]\n[SETLISTS]\n[END]")
+	b := readIndex(t, "setsearcher index 2\n[SONGS]\nGin|gin\n[END]\n[ALIASES]\n[END]\n[SETLISTS]\n[END]")
+	merged, conflicts, err := Merge(MergeFirst, a, b)
+	if err != nil {
+		t.Fatalf("Merge got unexpected error: %v", err)
+	}
+	if got := merged.Songs()["Gin"]; got != "bathtub-gin" {
+		t.Errorf("merged song Gin = %q, but expected %q", got, "bathtub-gin")
+	}
+	want := []Conflict{{Kind: "song", Key: "Gin", Indexes: []int{0, 1}, Winner: 0}}
+	if !reflect.DeepEqual(conflicts, want) {
+		t.Errorf("Merge got conflicts %v, but expected %v", conflicts, want)
+	}
+}
+
+func TestParseMergePolicy(t *testing.T) {
+	for _, p := range []MergePolicy{MergeLast, MergeFirst, MergeNewest, MergeStrict} {
+		if got, err := ParseMergePolicy(p.String()); err != nil || got != p {
+			t.Errorf("ParseMergePolicy(%q) = %v, %v; expected %v", p.String(), got, err, p)
+		}
+	}
+	if _, err := ParseMergePolicy("best"); err == nil {
+		t.Errorf("ParseMergePolicy(%q) expected an error, but got nil", "best")
+	}
+}
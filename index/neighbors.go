@@ -0,0 +1,193 @@
+package index
+
+import (
+	"math"
+	"sort"
+
+	"github.com/awbraunstein/setlist-search/searcher"
+	"github.com/pkg/errors"
+)
+
+// Neighbor is a song that is played in the same shows as another song.
+type Neighbor struct {
+	Song string `json:"song"`
+	Name string `json:"name"`
+	// Count is the number of shows that both songs were played in.
+	Count int `json:"count"`
+	// Lift is how many times more often the songs are played together than
+	// they would be if they were played independently of each other.
+	Lift float64 `json:"lift"`
+	// PMI is the pointwise mutual information of the songs, log2(Lift).
+	PMI float64 `json:"pmi"`
+}
+
+// Transition is a song that directly follows another song.
+type Transition struct {
+	Song string `json:"song"`
+	Name string `json:"name"`
+	// Count is the number of times the song followed the other song.
+	Count int `json:"count"`
+	// Probability is the fraction of the other song's transitions that went
+	// to this song.
+	Probability float64 `json:"probability"`
+}
+
+// Orderings of neighbors.
+const (
+	ByCount = "count"
+	ByLift  = "lift"
+	ByPMI   = "pmi"
+)
+
+// relations holds the statistics that relate songs to each other. They're
+// computed the first time they're needed.
+type relations struct {
+	// showCounts maps a song to the number of shows it was played in.
+	showCounts map[string]int
+	// transitions maps a song to the songs that directly followed it in the
+	// same set, and the number of times that they did.
+	transitions map[string]map[string]int
+}
+
+func (i *Index) relations() *relations {
+	i.relationsOnce.Do(func() {
+		r := &relations{
+			showCounts:  make(map[string]int),
+			transitions: make(map[string]map[string]int),
+		}
+		for _, sl := range i.setlists {
+			seen := make(map[string]bool)
+			for _, song := range sl.Songs() {
+				if !seen[song] {
+					seen[song] = true
+					r.showCounts[song]++
+				}
+			}
+			// Songs only follow each other within a set, not from the end
+			// of one set to the start of the next. Soundchecks aren't
+			// counted, as they aren't by Songs.
+			for _, set := range sl.Sets {
+				if set.Kind == searcher.SoundcheckSet {
+					continue
+				}
+				for n := 1; n < len(set.Songs); n++ {
+					prev := set.Songs[n-1]
+					if r.transitions[prev] == nil {
+						r.transitions[prev] = make(map[string]int)
+					}
+					r.transitions[prev][set.Songs[n]]++
+				}
+			}
+		}
+		i.rels = r
+	})
+	return i.rels
+}
+
+func (i *Index) resolveKnownSong(song string) (string, error) {
+	id, ok := i.ResolveSong(song)
+	if !ok || len(i.reverseIndex[id]) == 0 {
+		return "", errors.Wrapf(ErrUnknownSong, "%q", song)
+	}
+	return id, nil
+}
+
+// Neighbors returns the songs that are most often played in the same show as
+// song, ordered by ByCount, ByLift or ByPMI. At most n neighbors are returned,
+// or all of them if n is not positive.
+func (i *Index) Neighbors(song string, n int, by string) ([]Neighbor, error) {
+	id, err := i.resolveKnownSong(song)
+	if err != nil {
+		return nil, err
+	}
+	switch by {
+	case "", ByCount, ByLift, ByPMI:
+	default:
+		return nil, errors.Errorf("unknown ordering %q", by)
+	}
+	rels := i.relations()
+
+	counts := make(map[string]int)
+	seenShows := make(map[int]bool)
+	for _, show := range i.reverseIndex[id] {
+		if seenShows[show] {
+			continue
+		}
+		seenShows[show] = true
+		seen := map[string]bool{id: true}
+		for _, other := range i.setlists[show].Songs() {
+			if !seen[other] {
+				seen[other] = true
+				counts[other]++
+			}
+		}
+	}
+
+	total := float64(len(i.setlists))
+	shows := float64(rels.showCounts[id])
+	neighbors := make([]Neighbor, 0, len(counts))
+	for other, count := range counts {
+		lift := float64(count) * total / (shows * float64(rels.showCounts[other]))
+		neighbors = append(neighbors, Neighbor{
+			Song:  other,
+			Name:  i.SongName(other),
+			Count: count,
+			Lift:  lift,
+			PMI:   math.Log2(lift),
+		})
+	}
+	sort.Slice(neighbors, func(a, b int) bool {
+		x, y := neighbors[a], neighbors[b]
+		if by == ByLift || by == ByPMI {
+			if x.Lift != y.Lift {
+				return x.Lift > y.Lift
+			}
+		}
+		if x.Count != y.Count {
+			return x.Count > y.Count
+		}
+		if x.Lift != y.Lift {
+			return x.Lift > y.Lift
+		}
+		return x.Song < y.Song
+	})
+	if n > 0 && len(neighbors) > n {
+		neighbors = neighbors[:n]
+	}
+	return neighbors, nil
+}
+
+// Transitions returns the songs that most often directly follow song within a
+// set. At most n transitions are returned, or all of them if n is not
+// positive.
+func (i *Index) Transitions(song string, n int) ([]Transition, error) {
+	id, err := i.resolveKnownSong(song)
+	if err != nil {
+		return nil, err
+	}
+	next := i.relations().transitions[id]
+	total := 0
+	for _, count := range next {
+		total += count
+	}
+	transitions := make([]Transition, 0, len(next))
+	for other, count := range next {
+		transitions = append(transitions, Transition{
+			Song:        other,
+			Name:        i.SongName(other),
+			Count:       count,
+			Probability: float64(count) / float64(total),
+		})
+	}
+	sort.Slice(transitions, func(a, b int) bool {
+		x, y := transitions[a], transitions[b]
+		if x.Count != y.Count {
+			return x.Count > y.Count
+		}
+		return x.Song < y.Song
+	})
+	if n > 0 && len(transitions) > n {
+		transitions = transitions[:n]
+	}
+	return transitions, nil
+}
@@ -0,0 +1,106 @@
+package index
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestNeighbors(t *testing.T) {
+	i, err := Read(strings.NewReader(statsIndex))
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	tests := []struct {
+		by   string
+		n    int
+		want []Neighbor
+	}{
+		{
+			by: ByCount,
+			want: []Neighbor{
+				{Song: "reba", Name: "reba", Count: 3, Lift: 1.5, PMI: math.Log2(1.5)},
+				{Song: "fee", Name: "fee", Count: 3, Lift: 1, PMI: 0},
+			},
+		}, {
+			by: ByPMI,
+			n:  1,
+			want: []Neighbor{
+				{Song: "reba", Name: "reba", Count: 3, Lift: 1.5, PMI: math.Log2(1.5)},
+			},
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.by, func(t *testing.T) {
+			got, err := i.Neighbors("you-enjoy-myself", tc.n, tc.by)
+			if err != nil {
+				t.Fatalf("Neighbors got unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got: %+v\nexpected: %+v", got, tc.want)
+			}
+		})
+	}
+
+	if _, err := i.Neighbors("you-enjoy-myself", 0, "popularity"); err == nil {
+		t.Error("Neighbors with an unknown ordering expected an error, but got nil")
+	}
+	if _, err := i.Neighbors("tweezer", 0, ByCount); errors.Cause(err) != ErrUnknownSong {
+		t.Errorf("Neighbors(tweezer) = %v, but expected ErrUnknownSong", err)
+	}
+}
+
+func TestTransitions(t *testing.T) {
+	i, err := Read(strings.NewReader(statsIndex))
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	tests := []struct {
+		song string
+		n    int
+		want []Transition
+	}{
+		{
+			song: "fee",
+			want: []Transition{
+				{Song: "reba", Name: "reba", Count: 2, Probability: 2.0 / 3},
+				{Song: "you-enjoy-myself", Name: "You Enjoy Myself", Count: 1, Probability: 1.0 / 3},
+			},
+		}, {
+			// The end of a set doesn't lead into the next set.
+			song: "reba",
+			want: []Transition{
+				{Song: "you-enjoy-myself", Name: "You Enjoy Myself", Count: 1, Probability: 1},
+			},
+		}, {
+			song: "YEM",
+			n:    1,
+			want: []Transition{
+				{Song: "fee", Name: "fee", Count: 1, Probability: 0.5},
+			},
+		}, {
+			// Soundchecks aren't counted.
+			song: "you-enjoy-myself",
+			want: []Transition{
+				{Song: "fee", Name: "fee", Count: 1, Probability: 0.5},
+				{Song: "reba", Name: "reba", Count: 1, Probability: 0.5},
+			},
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.song, func(t *testing.T) {
+			got, err := i.Transitions(tc.song, tc.n)
+			if err != nil {
+				t.Fatalf("Transitions(%q) got unexpected error: %v", tc.song, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got: %+v\nexpected: %+v", got, tc.want)
+			}
+		})
+	}
+}
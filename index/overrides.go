@@ -0,0 +1,316 @@
+package index
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/awbraunstein/setlist-search/searcher"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Override operations.
+const (
+	// ReplaceSet replaces the songs of a set of a show, adding the set if the
+	// show doesn't have it. An empty list of songs removes the set, unless it
+	// is the show's only set.
+	ReplaceSet = "replace_set"
+	// RenameSong fixes the name of a song, its ID, or both. Setlists that
+	// played the song are rewritten when its ID changes.
+	RenameSong = "rename_song"
+	// AddShow adds a show that is missing from the scraped data.
+	AddShow = "add_show"
+	// HideShow leaves a show out of the index.
+	HideShow = "hide_show"
+)
+
+// Override is a manual patch to the scraped setlists. Overrides are read from a
+// YAML or JSON file that holds a list of them, e.g.
+//
+//   - op: replace_set
+//     show: 1252698266
+//     set: "2"
+//     songs: "tweezer->reba,tweezer-reprise"
+//     note: phish.net is missing Reba
+//   - op: rename_song
+//     song: tweezer-reprize
+//     name: Tweezer Reprise
+//     to: tweezer-reprise
+//   - op: add_show
+//     setlist: "ID{1}DATE{1983-12-02}URL{}SET1{slave-to-the-traffic-light}"
+//   - op: hide_show
+//     show: 1252698267
+type Override struct {
+	// Op is one of ReplaceSet, RenameSong, AddShow or HideShow.
+	Op string `yaml:"op"`
+	// Show is the showid of the show to patch, for ReplaceSet and HideShow.
+	Show int `yaml:"show,omitempty"`
+	// Set is the short name of the set, e.g. "2" or "e", and Songs are its
+	// songs in the setlist serialization format, for ReplaceSet.
+	Set   string `yaml:"set,omitempty"`
+	Songs string `yaml:"songs,omitempty"`
+	// Song is the ID of the song to fix, Name is its correct name and To is
+	// its correct ID, for RenameSong. Either Name or To may be left empty.
+	Song string `yaml:"song,omitempty"`
+	Name string `yaml:"name,omitempty"`
+	To   string `yaml:"to,omitempty"`
+	// Setlist is the serialized setlist of the show, for AddShow.
+	Setlist string `yaml:"setlist,omitempty"`
+	// Note explains why the override is needed. It isn't used otherwise.
+	Note string `yaml:"note,omitempty"`
+}
+
+func (o *Override) String() string {
+	switch o.Op {
+	case ReplaceSet:
+		return fmt.Sprintf("%s of set %s of show %d", o.Op, o.Set, o.Show)
+	case RenameSong:
+		return fmt.Sprintf("%s of %s", o.Op, o.Song)
+	case HideShow:
+		return fmt.Sprintf("%s of show %d", o.Op, o.Show)
+	}
+	return o.Op
+}
+
+// validate checks that the override has the fields that its operation needs.
+func (o *Override) validate() error {
+	switch o.Op {
+	case ReplaceSet:
+		if o.Show <= 0 {
+			return errors.New("replace_set needs a show")
+		}
+		if _, err := searcher.ParseSet(o.Set, o.Songs); err != nil {
+			return err
+		}
+	case RenameSong:
+		if o.Song == "" {
+			return errors.New("rename_song needs a song")
+		}
+		if o.Name == "" && o.To == "" {
+			return errors.New("rename_song needs a name or a new ID")
+		}
+		// The names and IDs are written to the index as is.
+		for _, s := range []string{o.Song, o.Name, o.To} {
+			if s == "" {
+				continue
+			}
+			if err := CheckSongText(s); err != nil {
+				return errors.Wrap(err, "rename_song")
+			}
+		}
+	case AddShow:
+		if _, err := searcher.ParseSetlist(o.Setlist); err != nil {
+			return err
+		}
+	case HideShow:
+		if o.Show <= 0 {
+			return errors.New("hide_show needs a show")
+		}
+	default:
+		return fmt.Errorf("unknown override op %q", o.Op)
+	}
+	return nil
+}
+
+// ParseOverrides parses a YAML or JSON list of overrides.
+func ParseOverrides(data []byte) ([]Override, error) {
+	var overrides []Override
+	if err := yaml.UnmarshalStrict(data, &overrides); err != nil {
+		return nil, err
+	}
+	for n := range overrides {
+		if err := overrides[n].validate(); err != nil {
+			return nil, fmt.Errorf("override %d: %v", n+1, err)
+		}
+	}
+	return overrides, nil
+}
+
+// ReadOverrides reads the overrides file at path.
+func ReadOverrides(path string) ([]Override, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read overrides")
+	}
+	overrides, err := ParseOverrides(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to parse overrides %s", path)
+	}
+	return overrides, nil
+}
+
+// ApplyOverrides patches the setlists and songs that were added to the writer,
+// in order, and marks every setlist that was changed as overridden. Overrides
+// that no longer apply, such as a fix for a show that isn't in the index, are
+// skipped and returned as errors so that the rest still take effect.
+func (w *IndexWriter) ApplyOverrides(overrides []Override) []error {
+	var errs []error
+	for n := range overrides {
+		o := &overrides[n]
+		if err := w.applyOverride(o); err != nil {
+			errs = append(errs, fmt.Errorf("override %d (%s): %v", n+1, o, err))
+		}
+	}
+	return errs
+}
+
+func (w *IndexWriter) applyOverride(o *Override) error {
+	if err := o.validate(); err != nil {
+		return err
+	}
+	switch o.Op {
+	case ReplaceSet:
+		sl, ok := w.setlists[o.Show]
+		if !ok {
+			return errors.New("the show isn't in the index")
+		}
+		set, _ := searcher.ParseSet(o.Set, o.Songs)
+		if o.Songs == "" {
+			if findSet(sl, set.Name()) < 0 {
+				return fmt.Errorf("the show has no set %s to remove", o.Set)
+			}
+			// A setlist with no sets can't be read back from the index.
+			if len(sl.Sets) == 1 {
+				return fmt.Errorf("set %s is the only set of the show; use %s to remove the show", o.Set, HideShow)
+			}
+		}
+		sl = overridden(sl)
+		replaceSet(sl, set, o.Songs == "")
+		w.setlists[o.Show] = sl
+	case RenameSong:
+		return w.renameSong(o.Song, o.Name, o.To)
+	case AddShow:
+		sl, _ := searcher.ParseSetlist(o.Setlist)
+		if _, ok := w.setlists[sl.ShowId]; ok {
+			return fmt.Errorf("show %d is already in the index", sl.ShowId)
+		}
+		sl.Origin = searcher.OriginOverride
+		w.setlists[sl.ShowId] = sl
+	case HideShow:
+		if _, ok := w.setlists[o.Show]; !ok {
+			return errors.New("the show isn't in the index")
+		}
+		delete(w.setlists, o.Show)
+	}
+	return nil
+}
+
+// renameSong gives the song with ID id the name name, if it isn't empty, and
+// the ID to, if it isn't empty.
+func (w *IndexWriter) renameSong(id, name, to string) error {
+	var names []string
+	for n, v := range w.songs {
+		if v == id {
+			names = append(names, n)
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("song %s isn't in the index", id)
+	}
+	if to == "" {
+		to = id
+	}
+	if name != "" {
+		for _, n := range names {
+			delete(w.songs, n)
+		}
+		names = []string{name}
+	}
+	for _, n := range names {
+		w.songs[n] = to
+	}
+	if to == id {
+		return nil
+	}
+	for alias := range w.aliases[id] {
+		w.AddAlias(to, alias)
+	}
+	delete(w.aliases, id)
+	for showID, sl := range w.setlists {
+		var renamed *searcher.Setlist
+		for s, set := range sl.Sets {
+			for i, song := range set.Songs {
+				if song != id {
+					continue
+				}
+				if renamed == nil {
+					renamed = overridden(sl)
+				}
+				renamed.Sets[s].Songs[i] = to
+			}
+		}
+		if renamed != nil {
+			w.setlists[showID] = renamed
+		}
+	}
+	return nil
+}
+
+// overridden returns a copy of sl, which may be shared with the caller of
+// AddSetlist, whose origin includes searcher.OriginOverride.
+func overridden(sl *searcher.Setlist) *searcher.Setlist {
+	c := *sl
+	c.Sets = make([]*searcher.Set, len(sl.Sets))
+	for i, set := range sl.Sets {
+		s := *set
+		s.Songs = append([]string(nil), set.Songs...)
+		s.Connectors = append([]searcher.Connector(nil), set.Connectors...)
+		c.Sets[i] = &s
+	}
+	if !c.Overridden() {
+		if c.Origin == "" {
+			c.Origin = searcher.OriginOverride
+		} else {
+			c.Origin += "+" + searcher.OriginOverride
+		}
+	}
+	return &c
+}
+
+// findSet returns the position of the set of sl named name, or -1.
+func findSet(sl *searcher.Setlist, name string) int {
+	for i, s := range sl.Sets {
+		if s.Name() == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// replaceSet replaces the set of sl with the same name as set, or removes it.
+// A new set is placed before the first set that is played after it.
+func replaceSet(sl *searcher.Setlist, set *searcher.Set, remove bool) {
+	if i := findSet(sl, set.Name()); i >= 0 {
+		if remove {
+			sl.Sets = append(sl.Sets[:i], sl.Sets[i+1:]...)
+		} else {
+			sl.Sets[i] = set
+		}
+		return
+	}
+	at := len(sl.Sets)
+	for i, s := range sl.Sets {
+		if playedBefore(set, s) {
+			at = i
+			break
+		}
+	}
+	sl.Sets = append(sl.Sets, nil)
+	copy(sl.Sets[at+1:], sl.Sets[at:])
+	sl.Sets[at] = set
+}
+
+// setOrder is the order in which the kinds of sets are played.
+var setOrder = map[searcher.SetKind]int{
+	searcher.SoundcheckSet: 0,
+	searcher.RegularSet:    1,
+	searcher.EncoreSet:     2,
+}
+
+// playedBefore reports whether set a is played before set b.
+func playedBefore(a, b *searcher.Set) bool {
+	if a.Kind != b.Kind {
+		return setOrder[a.Kind] < setOrder[b.Kind]
+	}
+	return a.Ordinal < b.Ordinal
+}
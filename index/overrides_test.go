@@ -0,0 +1,175 @@
+package index
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/awbraunstein/setlist-search/searcher"
+)
+
+const overridesYAML = `
+- op: replace_set
+  show: 1
+  set: "2"
+  songs: "reba->tweezer"
+  note: phish.net is missing the second set
+- op: replace_set
+  show: 1
+  set: e
+  songs: ""
+- op: rename_song
+  song: tweezer-reprize
+  name: Tweezer Reprise
+  to: tweezer-reprise
+- op: add_show
+  setlist: "ID{4}DATE{1984-12-01}URL{d}SET1{fee}"
+- op: hide_show
+  show: 3
+`
+
+func TestApplyOverrides(t *testing.T) {
+	overrides, err := ParseOverrides([]byte(overridesYAML))
+	if err != nil {
+		t.Fatalf("ParseOverrides got unexpected error: %v", err)
+	}
+	w := NewWriter("")
+	for _, s := range []string{
+		"ID{1}DATE{1984-11-01}URL{a}ORIGIN{phish.net}SET1{fee,tweezer-reprize}ENCORE{reba}",
+		"ID{2}DATE{1984-11-02}URL{b}ORIGIN{phish.net}SET1{fee}",
+		"ID{3}DATE{1984-11-03}URL{c}ORIGIN{phish.net}SET1{tweezer-reprize}",
+	} {
+		sl, err := searcher.ParseSetlist(s)
+		if err != nil {
+			t.Fatalf("unable to parse setlist; %v", err)
+		}
+		w.AddSetlist(sl)
+	}
+	scraped := w.setlists[1]
+	w.AddSong("Fee", "fee")
+	w.AddSong("Reba", "reba")
+	w.AddSong("Tweezer", "tweezer")
+	w.AddSong("Tweezer Reprize", "tweezer-reprize")
+	w.AddAlias("tweezer-reprize", "Tweez Rep")
+
+	if errs := w.ApplyOverrides(overrides); len(errs) > 0 {
+		t.Fatalf("ApplyOverrides got unexpected errors: %v", errs)
+	}
+	var b bytes.Buffer
+	if _, err := w.WriteTo(&b); err != nil {
+		t.Fatalf("unable to write index; %v", err)
+	}
+	want := `setsearcher index 2
+[SONGS]
+Fee|fee
+Reba|reba
+Tweezer|tweezer
+Tweezer Reprise|tweezer-reprise
+[END]
+[ALIASES]
+tweezer-reprise|Tweez Rep
+[END]
+[SETLISTS]
+ID{1}DATE{1984-11-01}URL{a}ORIGIN{phish.net+override}SET1{fee,tweezer-reprise}SET2{reba->tweezer}
+ID{2}DATE{1984-11-02}URL{b}ORIGIN{phish.net}SET1{fee}
+ID{4}DATE{1984-12-01}URL{d}ORIGIN{override}SET1{fee}
+[END]`
+	if got := b.String(); got != want {
+		t.Errorf("ApplyOverrides got index:\n%s\nbut expected:\n%s", got, want)
+	}
+	if got, want := scraped.String(), "ID{1}DATE{1984-11-01}URL{a}ORIGIN{phish.net}SET1{fee,tweezer-reprize}ENCORE{reba}"; got != want {
+		t.Errorf("ApplyOverrides changed the added setlist to %s", got)
+	}
+}
+
+func TestApplyOverridesSkipped(t *testing.T) {
+	w := NewWriter("")
+	sl, err := searcher.ParseSetlist("ID{1}DATE{1984-11-01}URL{a}SET1{fee}")
+	if err != nil {
+		t.Fatalf("unable to parse setlist; %v", err)
+	}
+	w.AddSetlist(sl)
+	w.AddSong("Fee", "fee")
+	errs := w.ApplyOverrides([]Override{
+		{Op: HideShow, Show: 2},
+		{Op: ReplaceSet, Show: 1, Set: "2"},
+		{Op: RenameSong, Song: "reba", Name: "Reba"},
+		{Op: AddShow, Setlist: "ID{1}DATE{1984-11-01}URL{a}SET1{reba}"},
+		{Op: ReplaceSet, Show: 1, Set: "1"},
+		{Op: ReplaceSet, Show: 1, Set: "e", Songs: "reba"},
+	})
+	if len(errs) != 5 {
+		t.Fatalf("ApplyOverrides got errors %v, but expected 5", errs)
+	}
+	if got, want := errs[0].Error(), "override 1 (hide_show of show 2): the show isn't in the index"; got != want {
+		t.Errorf("ApplyOverrides got error %q, but expected %q", got, want)
+	}
+	if got, want := errs[4].Error(), "override 5 (replace_set of set 1 of show 1): set 1 is the only set of the show; use hide_show to remove the show"; got != want {
+		t.Errorf("ApplyOverrides got error %q, but expected %q", got, want)
+	}
+	if got, want := w.setlists[1].String(), "ID{1}DATE{1984-11-01}URL{a}ORIGIN{override}SET1{fee}ENCORE{reba}"; got != want {
+		t.Errorf("ApplyOverrides got setlist %s, but expected %s", got, want)
+	}
+}
+
+func TestParseOverrides(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data string
+		err  string
+	}{
+		{
+			name: "json",
+			data: `[{"op": "hide_show", "show": 1}, {"op": "rename_song", "song": "a", "to": "b"}]`,
+		},
+		{
+			name: "unknown op",
+			data: `[{"op": "delete_show", "show": 1}]`,
+			err:  `override 1: unknown override op "delete_show"`,
+		},
+		{
+			name: "unknown field",
+			data: `[{"op": "hide_show", "showid": 1}]`,
+			err:  "not found",
+		},
+		{
+			name: "bad set",
+			data: `[{"op": "replace_set", "show": 1, "set": "x"}]`,
+			err:  "override 1:",
+		},
+		{
+			name: "bad setlist",
+			data: "- op: hide_show\n  show: 1\n- op: add_show\n  setlist: SET1{a}\n",
+			err:  "override 2:",
+		},
+		{
+			name: "rename to a name with a separator",
+			data: "- op: rename_song\n  song: a\n  name: A|B\n",
+			err:  "override 1: rename_song:",
+		},
+		{
+			name: "rename to an ID with a line break",
+			data: `[{"op": "rename_song", "song": "a", "to": "b\nc"}]`,
+			err:  "override 1: rename_song:",
+		},
+		{
+			name: "rename without a name",
+			data: "- op: rename_song\n  song: a\n",
+			err:  "override 1: rename_song needs a name or a new ID",
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseOverrides([]byte(tc.data))
+			if tc.err == "" {
+				if err != nil {
+					t.Errorf("ParseOverrides got unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("ParseOverrides got error %v, but expected one containing %q", err, tc.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package query
+
+import "fmt"
+
+// Complexity measures how expensive a statement is to evaluate.
+type Complexity struct {
+	// Nodes is the number of expressions and operators.
+	Nodes int
+	// Depth is the greatest number of nested statements.
+	Depth int
+	// Nots is the number of NOT operators, which are expensive since they
+	// match most shows.
+	Nots int
+}
+
+// Measure returns the complexity of stmt.
+func Measure(stmt Statement) Complexity {
+	var c Complexity
+	depth := 0
+	Inspect(stmt, func(n Statement) bool {
+		if n == nil {
+			depth--
+			return false
+		}
+		depth++
+		c.Nodes++
+		if depth > c.Depth {
+			c.Depth = depth
+		}
+		if _, ok := n.(*NotStatement); ok {
+			c.Nots++
+		}
+		return true
+	})
+	return c
+}
+
+// Limits bounds the complexity of the statements that may be evaluated. A
+// limit that isn't positive isn't enforced.
+type Limits struct {
+	MaxNodes int
+	MaxDepth int
+	MaxNots  int
+}
+
+// ComplexityError is returned for a statement that exceeds a limit.
+type ComplexityError struct {
+	// What describes the measure that exceeded its limit.
+	What  string
+	Value int
+	Limit int
+}
+
+func (e *ComplexityError) Error() string {
+	return fmt.Sprintf("query has %d %s, but at most %d are allowed", e.Value, e.What, e.Limit)
+}
+
+// Check returns a *ComplexityError if stmt exceeds one of the limits.
+func (l Limits) Check(stmt Statement) error {
+	c := Measure(stmt)
+	switch {
+	case l.MaxNodes > 0 && c.Nodes > l.MaxNodes:
+		return &ComplexityError{What: "terms and operators", Value: c.Nodes, Limit: l.MaxNodes}
+	case l.MaxDepth > 0 && c.Depth > l.MaxDepth:
+		return &ComplexityError{What: "levels of nesting", Value: c.Depth, Limit: l.MaxDepth}
+	case l.MaxNots > 0 && c.Nots > l.MaxNots:
+		return &ComplexityError{What: "NOTs", Value: c.Nots, Limit: l.MaxNots}
+	}
+	return nil
+}
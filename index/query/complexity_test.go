@@ -0,0 +1,65 @@
+package query
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMeasure(t *testing.T) {
+	tests := []struct {
+		query string
+		want  Complexity
+	}{
+		{"a", Complexity{Nodes: 1, Depth: 1}},
+		{"NOT a", Complexity{Nodes: 2, Depth: 2, Nots: 1}},
+		{"a AND b", Complexity{Nodes: 3, Depth: 2}},
+		{"a AND (b OR NOT c)", Complexity{Nodes: 6, Depth: 4, Nots: 1}},
+		{"NOT NOT a OR NOT b", Complexity{Nodes: 6, Depth: 4, Nots: 3}},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.query, func(t *testing.T) {
+			stmt, err := NewParser(strings.NewReader(tc.query)).Parse()
+			if err != nil {
+				t.Fatalf("Parse got unexpected error: %v", err)
+			}
+			if got := Measure(stmt); got != tc.want {
+				t.Errorf("Measure(%s) = %+v, but expected %+v", stmt, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLimitsCheck(t *testing.T) {
+	limits := Limits{MaxNodes: 9, MaxDepth: 4, MaxNots: 1}
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"a AND (b OR NOT c)", ""},
+		{"a OR b OR c OR d OR e OR f", "query has 11 terms and operators, but at most 9 are allowed"},
+		{"a AND (b AND (c AND NOT d))", "query has 5 levels of nesting, but at most 4 are allowed"},
+		{"NOT a AND NOT b", "query has 2 NOTs, but at most 1 are allowed"},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.query, func(t *testing.T) {
+			stmt, err := NewParser(strings.NewReader(tc.query)).Parse()
+			if err != nil {
+				t.Fatalf("Parse got unexpected error: %v", err)
+			}
+			err = limits.Check(stmt)
+			var got string
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tc.want {
+				t.Errorf("Check(%s) got error %q, but expected %q", stmt, got, tc.want)
+			}
+		})
+	}
+
+	if err := (Limits{}).Check(&NotStatement{S: &NotStatement{S: &Expression{Value: "a"}}}); err != nil {
+		t.Errorf("zero Limits got unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package query
+
+import "fmt"
+
+// Fields of a show that a query can match with field:value, such as
+// venue:"Madison Square Garden".
+const (
+	// FieldVenue, FieldLocation and FieldTour match the shows whose venue,
+	// location or tour contains the value, ignoring case and punctuation.
+	FieldVenue    = "venue"
+	FieldLocation = "location"
+	FieldTour     = "tour"
+	// FieldYear matches the shows of a year, and FieldDate the shows whose
+	// date starts with the value, e.g. date:1997-11 for a month.
+	FieldYear = "year"
+	FieldDate = "date"
+)
+
+// Fields are the fields that a query can match, in the order they're
+// suggested.
+var Fields = []string{FieldVenue, FieldLocation, FieldTour, FieldYear, FieldDate}
+
+// checkField returns an error if field isn't one of Fields or value can't
+// match it.
+func checkField(field, value string) error {
+	switch field {
+	case FieldVenue, FieldLocation, FieldTour, FieldDate:
+	case FieldYear:
+		if len(value) != 4 || !isDigits(value) {
+			return fmt.Errorf("year %q isn't a four digit year", value)
+		}
+	default:
+		return fmt.Errorf("unknown field %q", field)
+	}
+	if value == "" {
+		return fmt.Errorf("missing value for %s:", field)
+	}
+	return nil
+}
+
+func isDigits(s string) bool {
+	for _, ch := range s {
+		if !isDigit(ch) {
+			return false
+		}
+	}
+	return true
+}
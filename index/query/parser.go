@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strconv"
 )
 
 type Statement interface {
@@ -47,7 +48,11 @@ func (s *NotStatement) String() string {
 	return "NOT(" + s.S.String() + ")"
 }
 
+// Expression matches the shows that played a song, or, if Field is set, the
+// shows whose field matches Value.
 type Expression struct {
+	// Field is one of Fields, or empty for a song.
+	Field string
 	Value string
 }
 
@@ -56,6 +61,9 @@ func (*Expression) kind() string {
 }
 
 func (e *Expression) String() string {
+	if e.Field != "" {
+		return e.Field + ":" + strconv.Quote(e.Value)
+	}
 	return e.Value
 }
 
@@ -102,6 +110,35 @@ func Inspect(node Statement, f func(Statement) bool) {
 	Walk(inspector(f), node)
 }
 
+// Terms returns the songs of the expressions in stmt that a show is matched
+// by, in the order that they first appear. Expressions beneath an odd number
+// of NOTs are left out, since they only ever exclude shows, as are fielded
+// expressions, which don't name songs.
+func Terms(stmt Statement) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	var walk func(stmt Statement, negated bool)
+	walk = func(stmt Statement, negated bool) {
+		switch n := stmt.(type) {
+		case *AndStatement:
+			walk(n.Left, negated)
+			walk(n.Right, negated)
+		case *OrStatement:
+			walk(n.Left, negated)
+			walk(n.Right, negated)
+		case *NotStatement:
+			walk(n.S, !negated)
+		case *Expression:
+			if !negated && n.Field == "" && !seen[n.Value] {
+				seen[n.Value] = true
+				terms = append(terms, n.Value)
+			}
+		}
+	}
+	walk(stmt, false)
+	return terms
+}
+
 // Parser represents a parser.
 type Parser struct {
 	s   *Scanner
@@ -117,6 +154,15 @@ func NewParser(r io.Reader) *Parser {
 	return &Parser{s: NewScanner(r)}
 }
 
+// NewResolvingParser returns a new instance of Parser that resolves song names
+// with res, so that "YEM" and "You Enjoy Myself" both become
+// "you-enjoy-myself".
+func NewResolvingParser(r io.Reader, res Resolver) *Parser {
+	s := NewScanner(r)
+	s.resolver = res
+	return &Parser{s: s}
+}
+
 // scan returns the next token from the underlying scanner.
 // If a token has been unscanned then read that instead.
 func (p *Parser) scan() (tok Token, lit string) {
@@ -151,6 +197,8 @@ func (p *Parser) Parse() (Statement, error) {
 	type data struct {
 		lit string
 		tok Token
+		// value is the value of a FIELD.
+		value string
 	}
 
 	var exprQueue []data
@@ -158,19 +206,30 @@ func (p *Parser) Parse() (Statement, error) {
 	var statementStack []Statement
 	for tok, lit := p.scanIgnoreWhitespace(); tok != EOF; tok, lit = p.scanIgnoreWhitespace() {
 		switch tok {
+		case ILLEGAL:
+			return nil, fmt.Errorf("unexpected %q in query", lit)
 		case IDENT:
-			exprQueue = append(exprQueue, data{lit, tok})
+			exprQueue = append(exprQueue, data{lit: lit, tok: tok})
+		case FIELD:
+			vtok, value := p.scanIgnoreWhitespace()
+			if vtok != IDENT {
+				return nil, fmt.Errorf("missing value for %s:", lit)
+			}
+			if err := checkField(lit, value); err != nil {
+				return nil, err
+			}
+			exprQueue = append(exprQueue, data{lit: lit, tok: tok, value: value})
 		case NOT:
-			opStack = append(opStack, data{lit, tok})
+			opStack = append(opStack, data{lit: lit, tok: tok})
 		case AND, OR:
 			for len(opStack) != 0 && ((opStack[len(opStack)-1].tok.isFunction() || opStack[len(opStack)-1].tok.isOperator()) && opStack[len(opStack)-1].tok != LEFT_PAREN) {
 				var op data
 				op, opStack = opStack[len(opStack)-1], opStack[:len(opStack)-1]
 				exprQueue = append(exprQueue, op)
 			}
-			opStack = append(opStack, data{lit, tok})
+			opStack = append(opStack, data{lit: lit, tok: tok})
 		case LEFT_PAREN:
-			opStack = append(opStack, data{lit, tok})
+			opStack = append(opStack, data{lit: lit, tok: tok})
 		case RIGHT_PAREN:
 			for len(opStack) != 0 && opStack[len(opStack)-1].tok != LEFT_PAREN {
 				var op data
@@ -197,17 +256,28 @@ func (p *Parser) Parse() (Statement, error) {
 		switch expr.tok {
 		case IDENT:
 			statementStack = append(statementStack, &Expression{Value: expr.lit})
+		case FIELD:
+			statementStack = append(statementStack, &Expression{Field: expr.lit, Value: expr.value})
 		case NOT:
+			if len(statementStack) < 1 {
+				return nil, fmt.Errorf("missing operand for %s", expr.lit)
+			}
 			var inner Statement
 			inner, statementStack = statementStack[len(statementStack)-1], statementStack[:len(statementStack)-1]
 			not := &NotStatement{S: inner}
 			statementStack = append(statementStack, not)
 		case AND:
+			if len(statementStack) < 2 {
+				return nil, fmt.Errorf("missing operand for %s", expr.lit)
+			}
 			var left, right Statement
 			right, left, statementStack = statementStack[len(statementStack)-1], statementStack[len(statementStack)-2], statementStack[:len(statementStack)-2]
 			and := &AndStatement{Left: left, Right: right}
 			statementStack = append(statementStack, and)
 		case OR:
+			if len(statementStack) < 2 {
+				return nil, fmt.Errorf("missing operand for %s", expr.lit)
+			}
 			var left, right Statement
 			right, left, statementStack = statementStack[len(statementStack)-1], statementStack[len(statementStack)-2], statementStack[:len(statementStack)-2]
 			and := &OrStatement{Left: left, Right: right}
@@ -6,6 +6,13 @@ import (
 	"testing"
 )
 
+type mapResolver map[string]string
+
+func (m mapResolver) Resolve(name string) (string, bool) {
+	v, ok := m[name]
+	return v, ok
+}
+
 func TestParse(t *testing.T) {
 	tests := []struct {
 		query string
@@ -45,10 +52,44 @@ func TestParse(t *testing.T) {
 				},
 			},
 			err: false,
+		}, {
+			query: `"Mike's Song" AND 2001 AND ac/dc-bag`,
+			want: &AndStatement{
+				Left: &AndStatement{
+					Left:  &Expression{Value: "Mike's Song"},
+					Right: &Expression{Value: "2001"},
+				},
+				Right: &Expression{Value: "ac/dc-bag"},
+			},
+			err: false,
+		}, {
+			query: `"a`,
+			want:  nil,
+			err:   true,
+		}, {
+			query: "a & b",
+			want:  nil,
+			err:   true,
 		}, {
 			query: "(a",
 			want:  nil,
 			err:   true,
+		}, {
+			query: "a AND",
+			want:  nil,
+			err:   true,
+		}, {
+			query: "OR a",
+			want:  nil,
+			err:   true,
+		}, {
+			query: "NOT",
+			want:  nil,
+			err:   true,
+		}, {
+			query: "a AND NOT",
+			want:  nil,
+			err:   true,
 		}, {
 			query: "a)",
 			want:  nil,
@@ -74,3 +115,123 @@ func TestParse(t *testing.T) {
 		})
 	}
 }
+
+func TestParseResolve(t *testing.T) {
+	res := mapResolver{"YEM": "you-enjoy-myself", "Mike's Song": "mikes-song"}
+	p := NewResolvingParser(strings.NewReader(`YEM OR "Mike's Song" OR NOT tweezer`), res)
+	got, err := p.Parse()
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	want := &OrStatement{
+		Left: &OrStatement{
+			Left:  &Expression{Value: "you-enjoy-myself"},
+			Right: &Expression{Value: "mikes-song"},
+		},
+		Right: &NotStatement{S: &Expression{Value: "tweezer"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected:\n%v\ngot:\n%v", want, got)
+	}
+}
+
+func TestParseApostrophe(t *testing.T) {
+	res := mapResolver{"Mike's": "mikes-song", "Wolfman's": "wolfmans-brother"}
+	p := NewResolvingParser(strings.NewReader("Mike's AND NOT Wolfman's"), res)
+	got, err := p.Parse()
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	want := &AndStatement{
+		Left:  &Expression{Value: "mikes-song"},
+		Right: &NotStatement{S: &Expression{Value: "wolfmans-brother"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected:\n%v\ngot:\n%v", want, got)
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	// Field values aren't songs, so they aren't resolved.
+	res := mapResolver{"msg": "mikes-song", "YEM": "you-enjoy-myself"}
+	tests := []struct {
+		query string
+		want  Statement
+		err   string
+	}{
+		{
+			query: `venue:"Madison Square Garden"`,
+			want:  &Expression{Field: FieldVenue, Value: "Madison Square Garden"},
+		}, {
+			query: "YEM AND Venue:msg",
+			want: &AndStatement{
+				Left:  &Expression{Value: "you-enjoy-myself"},
+				Right: &Expression{Field: FieldVenue, Value: "msg"},
+			},
+		}, {
+			query: "year:1997 AND NOT date: 1997-11",
+			want: &AndStatement{
+				Left:  &Expression{Field: FieldYear, Value: "1997"},
+				Right: &NotStatement{S: &Expression{Field: FieldDate, Value: "1997-11"}},
+			},
+		}, {
+			query: "(tour:fall OR location:vt) AND YEM",
+			want: &AndStatement{
+				Left: &OrStatement{
+					Left:  &Expression{Field: FieldTour, Value: "fall"},
+					Right: &Expression{Field: FieldLocation, Value: "vt"},
+				},
+				Right: &Expression{Value: "you-enjoy-myself"},
+			},
+		},
+		{query: "venue:", err: "missing value for venue:"},
+		{query: "venue:(msg)", err: "missing value for venue:"},
+		{query: `venue:""`, err: "missing value for venue:"},
+		{query: "color:red", err: `unknown field "color"`},
+		{query: "year:97", err: `year "97" isn't a four digit year`},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.query, func(t *testing.T) {
+			got, err := NewResolvingParser(strings.NewReader(tc.query), res).Parse()
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("Got error %v, but expected %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Got unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Expected:\n%v\ngot:\n%v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestTerms(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "fee", want: []string{"fee"}},
+		{query: "fee AND (reba OR fee)", want: []string{"fee", "reba"}},
+		{query: "fee AND NOT reba", want: []string{"fee"}},
+		{query: "NOT (fee AND NOT reba)", want: []string{"reba"}},
+		{query: "NOT fee", want: nil},
+		{query: "fee AND venue:msg", want: []string{"fee"}},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.query, func(t *testing.T) {
+			stmt, err := NewParser(strings.NewReader(tc.query)).Parse()
+			if err != nil {
+				t.Fatalf("Got unexpected error: %v", err)
+			}
+			if got := Terms(stmt); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Terms(%q) = %v, but expected %v", tc.query, got, tc.want)
+			}
+		})
+	}
+}
@@ -17,9 +17,9 @@ const (
 
 	// Literals
 	IDENT
+	FIELD // venue: in venue:"Hampton Coliseum"
 
 	// Special characters
-	// COLON       // :
 	LEFT_PAREN  // (
 	RIGHT_PAREN // )
 
@@ -50,15 +50,28 @@ func isDigit(ch rune) bool {
 	return (ch >= '0' && ch <= '9')
 }
 
+// isAllowedCh reports whether ch may appear in an identifier after its first
+// character. Apostrophes allow aliases such as Mike's to be typed unquoted.
 func isAllowedCh(ch rune) bool {
-	return ch == '-' || ch == '_'
+	return ch == '-' || ch == '_' || ch == '/' || ch == '\''
 }
 
 var eof = rune(0)
 
+// Resolver maps the song names used in a query onto the canonical song names
+// that are stored in the index.
+type Resolver interface {
+	Resolve(name string) (string, bool)
+}
+
 // Scanner represents a lexical scanner.
 type Scanner struct {
 	r *bufio.Reader
+	// resolver, if set, is used to resolve identifiers.
+	resolver Resolver
+	// raw is set after a field, whose value isn't a song and so isn't
+	// resolved.
+	raw bool
 }
 
 // NewScanner returns a new instance of Scanner.
@@ -85,13 +98,16 @@ func (s *Scanner) Scan() (tok Token, lit string) {
 	ch := s.read()
 
 	// If we see whitespace then consume all contiguous whitespace.
-	// If we see a letter then consume as an ident or reserved word.
+	// If we see a letter or digit then consume as an ident or reserved word.
+	// If we see a double quote then consume as a quoted ident.
 	if isWhitespace(ch) {
 		s.unread()
 		return s.scanWhitespace()
-	} else if isLetter(ch) {
+	} else if isLetter(ch) || isDigit(ch) {
 		s.unread()
 		return s.scanIdent()
+	} else if ch == '"' {
+		return s.scanQuoted()
 	}
 
 	// Otherwise read the individual character.
@@ -158,6 +174,48 @@ func (s *Scanner) scanIdent() (tok Token, lit string) {
 		return NOT, buf.String()
 	}
 
+	// An identifier followed by a colon names a field.
+	if ch := s.read(); ch == ':' {
+		s.raw = true
+		return FIELD, strings.ToLower(buf.String())
+	} else if ch != eof {
+		s.unread()
+	}
+
 	// Otherwise return as a regular identifier.
-	return IDENT, buf.String()
+	return IDENT, s.resolve(buf.String())
+}
+
+// scanQuoted consumes a double quoted ident such as "Mike's Song". The opening
+// quote has already been consumed.
+func (s *Scanner) scanQuoted() (tok Token, lit string) {
+	var buf bytes.Buffer
+	for {
+		ch := s.read()
+		if ch == eof {
+			// The closing quote is missing.
+			return ILLEGAL, `"` + buf.String()
+		}
+		if ch == '"' {
+			break
+		}
+		buf.WriteRune(ch)
+	}
+	return IDENT, s.resolve(buf.String())
+}
+
+// resolve returns the canonical name of an identifier, or the identifier
+// itself if it can't be resolved.
+func (s *Scanner) resolve(lit string) string {
+	if s.raw {
+		s.raw = false
+		return lit
+	}
+	if s.resolver == nil {
+		return lit
+	}
+	if name, ok := s.resolver.Resolve(lit); ok {
+		return name
+	}
+	return lit
 }
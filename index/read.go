@@ -2,18 +2,26 @@ package index
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/awbraunstein/setlist-search/searcher"
-	"github.com/pkg/errors"
 )
 
 // The index format is as follows:
 //
-//  "setsearcher index 1"
+//  "setsearcher index 2"
 //  [SONGS]
+//  [ALIASES]
 //  [SETLISTS]
 //
 // Each section will be separated by a newline ("\n") and start with the
@@ -22,13 +30,26 @@ import (
 // Songs will be a map from human name to short name. This will account for when
 // there are multiple versions of the songs human name. The separator is "|".
 //
+// Aliases will be a list of short name to alias pairs, such as
+// "you-enjoy-myself|YEM". The separator is "|". Version 1 indexes have no
+// aliases section.
+//
 // Setlists will be a list of setlists where each setlist is formatted according
 // to the setlist serialization method separated by newlines.
+//
+// Lines may end in either "\n" or "\r\n".
 
 const (
-	header = "setsearcher index 1"
+	headerPrefix = "setsearcher index "
+	// indexVersion is the version of the index that is written. Indexes as
+	// old as minIndexVersion can still be read.
+	indexVersion    = 2
+	minIndexVersion = 1
 )
 
+// header is the first line of the indexes that are written.
+var header = headerPrefix + strconv.Itoa(indexVersion)
+
 // Index is the setlist searcher index that's loaded into memory to run analysis
 // on setlists.
 type Index struct {
@@ -38,81 +59,317 @@ type Index struct {
 	setlists map[int]*searcher.Setlist
 	// map from song to the list of showids that that song was played in.
 	reverseIndex map[string][]int
+	// songTable holds the canonical songs along with their names and aliases.
+	songTable *SongTable
+	// order holds the showids sorted chronologically, and position maps a
+	// showid to its index in order.
+	order    []int
+	position map[int]int
+	// rels relates songs to each other and is built lazily by relations.
+	relationsOnce sync.Once
+	rels          *relations
+	// suggestions completes song names and is built lazily by suggester.
+	suggestOnce sync.Once
+	suggestions *trie
+	// generation uniquely identifies this index among the indexes loaded by
+	// the process.
+	generation uint64
+	// hash is the hex encoded SHA-256 of the serialized index, and modTime is
+	// when it was last modified.
+	hash    string
+	modTime time.Time
+}
+
+// generations counts the indexes that have been loaded.
+var generations uint64
+
+// ReadOptions control how an index is read.
+type ReadOptions struct {
+	// Name is the name of the index used in diagnostics. It defaults to
+	// "index".
+	Name string
+	// Lenient skips malformed songs and setlists instead of failing. Each
+	// skipped record is returned as a warning. Problems with the structure of
+	// the index, such as a bad header, are always errors.
+	Lenient bool
+	// ModTime is when the index was last modified. It defaults to the time
+	// that the index was read.
+	ModTime time.Time
+}
+
+// ParseError describes a problem with a single line of an index.
+type ParseError struct {
+	Name string
+	Line int
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s:%d: %v", e.Name, e.Line, e.Err)
 }
 
-// Read reads an Index.
+// Read reads an Index. Any malformed line is an error.
 func Read(file io.Reader) (*Index, error) {
+	i, _, err := ReadWithOptions(file, ReadOptions{})
+	return i, err
+}
+
+// ReadFile opens and reads the index stored in the named file. Diagnostics
+// are reported against name unless opts.Name is set.
+func ReadFile(name string, opts ReadOptions) (*Index, []*ParseError, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	if opts.Name == "" {
+		opts.Name = name
+	}
+	if opts.ModTime.IsZero() {
+		if fi, err := f.Stat(); err == nil {
+			opts.ModTime = fi.ModTime()
+		}
+	}
+	return ReadWithOptions(f, opts)
+}
+
+// ReadWithOptions reads an Index. In lenient mode, the malformed records that
+// were skipped are returned as warnings.
+func ReadWithOptions(file io.Reader, opts ReadOptions) (*Index, []*ParseError, error) {
 	i := &Index{
 		songs:        make(map[string]string),
 		setlists:     make(map[int]*searcher.Setlist),
 		reverseIndex: make(map[string][]int),
+		songTable:    NewSongTable(),
+		generation:   atomic.AddUint64(&generations, 1),
+	}
+	if opts.Name == "" {
+		opts.Name = "index"
 	}
+	i.modTime = opts.ModTime
+	if i.modTime.IsZero() {
+		i.modTime = time.Now()
+	}
+	h := sha256.New()
+	r := newLineReader(io.TeeReader(file, h), opts)
+	if err := r.readHeader(); err != nil {
+		return nil, nil, err
+	}
+	if err := i.readSongs(r); err != nil {
+		return nil, nil, err
+	}
+	if r.version >= 2 {
+		if err := i.readAliases(r); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := i.readSetlists(r); err != nil {
+		return nil, nil, err
+	}
+	for song := range i.reverseIndex {
+		i.songTable.AddSong(song)
+	}
+	i.buildOrder()
+	if err := r.readTrailer(); err != nil {
+		return nil, nil, err
+	}
+	i.hash = hex.EncodeToString(h.Sum(nil))
+	return i, r.warnings, nil
+}
 
+// lineReader reads an index line by line, keeping track of the current line
+// number for diagnostics.
+type lineReader struct {
+	scanner  *bufio.Scanner
+	opts     ReadOptions
+	line     int
+	version  int
+	warnings []*ParseError
+}
+
+// maxLineLength is the longest line that can be read from an index.
+const maxLineLength = 1024 * 1024
+
+func newLineReader(file io.Reader, opts ReadOptions) *lineReader {
 	scanner := bufio.NewScanner(file)
-	if err := readHeader(scanner); err != nil {
-		return nil, err
+	scanner.Buffer(nil, maxLineLength)
+	scanner.Split(scanLines)
+	return &lineReader{scanner: scanner, opts: opts}
+}
+
+// next advances to the next line, which is then available through text.
+func (r *lineReader) next() bool {
+	if !r.scanner.Scan() {
+		return false
+	}
+	r.line++
+	return true
+}
+
+func (r *lineReader) text() string {
+	return r.scanner.Text()
+}
+
+// errorf returns an error for the current line.
+func (r *lineReader) errorf(format string, args ...interface{}) *ParseError {
+	return &ParseError{Name: r.opts.Name, Line: r.line, Err: fmt.Errorf(format, args...)}
+}
+
+// eofError returns an error for a premature end of the index, or the error
+// that stopped the scan.
+func (r *lineReader) eofError(format string, args ...interface{}) error {
+	if err := r.scanner.Err(); err != nil {
+		return &ParseError{Name: r.opts.Name, Line: r.line + 1, Err: err}
+	}
+	return &ParseError{Name: r.opts.Name, Line: r.line, Err: fmt.Errorf(format, args...)}
+}
+
+// malformed reports a malformed record. It returns the error if the record
+// can't be skipped.
+func (r *lineReader) malformed(err *ParseError) error {
+	if !r.opts.Lenient {
+		return err
+	}
+	r.warnings = append(r.warnings, err)
+	return nil
+}
+
+func (r *lineReader) readHeader() error {
+	if !r.next() {
+		r.line = 1
+		return r.eofError("index contains no header")
 	}
-	if err := i.readSongs(scanner); err != nil {
-		return nil, err
+	version := strings.TrimPrefix(r.text(), headerPrefix)
+	if version == r.text() {
+		return r.errorf("index header malformed; %q", r.text())
 	}
-	if err := i.readSetlists(scanner); err != nil {
-		return nil, err
+	v, err := strconv.Atoi(version)
+	if err != nil {
+		return r.errorf("index header malformed; %q", r.text())
 	}
-	return i, nil
+	if v < minIndexVersion || v > indexVersion {
+		return r.errorf("unsupported index version %d", v)
+	}
+	r.version = v
+	return nil
 }
 
-func readHeader(scanner *bufio.Scanner) error {
-	if !scanner.Scan() {
-		errors.New("index contains no header")
+// expectSection reads the line that opens the named section.
+func (r *lineReader) expectSection(name string) error {
+	if !r.next() {
+		return r.eofError("expected %s section", name)
 	}
-	if scanner.Text() != header {
-		fmt.Errorf("index header malformed; %q", scanner.Text())
+	if r.text() != name {
+		return r.errorf("expected %s section, but found %q", name, r.text())
 	}
 	return nil
 }
 
-func (i *Index) readSongs(scanner *bufio.Scanner) error {
-	for scanner.Scan() {
-		// We are in the songs stanza.
-		if scanner.Text() == "[SONGS]" {
-			continue
+// readTrailer checks that nothing but blank lines follows the last section.
+func (r *lineReader) readTrailer() error {
+	for r.next() {
+		if r.text() != "" {
+			return r.errorf("unexpected content after the end of the index: %q", r.text())
 		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return &ParseError{Name: r.opts.Name, Line: r.line + 1, Err: err}
+	}
+	return nil
+}
+
+func (i *Index) readSongs(r *lineReader) error {
+	if err := r.expectSection("[SONGS]"); err != nil {
+		return err
+	}
+	for r.next() {
 		// We are now done with this section.
-		if scanner.Text() == "[END]" {
+		if r.text() == "[END]" {
 			return nil
 		}
-		// Expect a longText,data-value format.
-		parts := strings.Split(scanner.Text(), "|")
-
-		if len(parts) != 2 {
-			return fmt.Errorf("Song malformatted: %#v", scanner.Text())
+		// Expect a longText|data-value format.
+		parts := strings.Split(r.text(), "|")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			if err := r.malformed(r.errorf("song malformatted: %q", r.text())); err != nil {
+				return err
+			}
+			continue
 		}
 		i.songs[parts[0]] = parts[1]
+		i.songTable.AddName(parts[0], parts[1])
 	}
-	return errors.New("Expected a closing statement for the songs section")
+	return r.eofError("expected a closing statement for the songs section")
 }
 
-func (i *Index) readSetlists(scanner *bufio.Scanner) error {
-	for scanner.Scan() {
-		// We are in the setlist stanza.
-		if scanner.Text() == "[SETLISTS]" {
+func (i *Index) readAliases(r *lineReader) error {
+	if err := r.expectSection("[ALIASES]"); err != nil {
+		return err
+	}
+	for r.next() {
+		// We are now done with this section.
+		if r.text() == "[END]" {
+			return nil
+		}
+		// Expect a short-name|alias format.
+		parts := strings.SplitN(r.text(), "|", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			if err := r.malformed(r.errorf("alias malformatted: %q", r.text())); err != nil {
+				return err
+			}
 			continue
 		}
+		i.songTable.AddAlias(parts[0], parts[1])
+	}
+	return r.eofError("expected a closing statement for the aliases section")
+}
+
+func (i *Index) readSetlists(r *lineReader) error {
+	if err := r.expectSection("[SETLISTS]"); err != nil {
+		return err
+	}
+	for r.next() {
 		// We are now done with this section.
-		if scanner.Text() == "[END]" {
+		if r.text() == "[END]" {
 			return nil
 		}
-		setlist := scanner.Text()
-		sl, err := searcher.ParseSetlist(setlist)
+		sl, err := searcher.ParseSetlist(r.text())
 		if err != nil {
-			return err
+			if err := r.malformed(r.errorf("%v", err)); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, ok := i.setlists[sl.ShowId]; ok {
+			if err := r.malformed(r.errorf("duplicate setlist for show %d", sl.ShowId)); err != nil {
+				return err
+			}
+			continue
 		}
 		i.setlists[sl.ShowId] = sl
 		for _, song := range sl.Songs() {
 			i.reverseIndex[song] = append(i.reverseIndex[song], sl.ShowId)
 		}
 	}
-	return errors.New("Expected a closing statement for the setlists section")
+	return r.eofError("expected a closing statement for the setlists section")
+}
+
+// scanLines is a split function for a bufio.Scanner that returns each line of
+// text, stripped of any trailing end-of-line marker. The end-of-line marker may
+// be either "\n" or "\r\n".
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		// We have a full newline-terminated line.
+		return i + 1, dropCR(data[0:i]), nil
+	}
+	// If we're at EOF, we have a final, non-terminated line. Return it.
+	if atEOF {
+		return len(data), dropCR(data), nil
+	}
+	// Request more data.
+	return 0, nil, nil
 }
 
 // dropCR drops a terminal \r from the data.
@@ -3,6 +3,8 @@ package index
 import (
 	"io/ioutil"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -15,10 +17,14 @@ func TestOpenIndex(t *testing.T) {
 	tmpName := tmpFile.Name()
 	defer os.Remove(tmpName)
 
-	indexStr := `setsearcher index 1
+	indexStr := `setsearcher index 2
 [SONGS]
 Chalk Dust Torture|chalk-dust-torture
 [END]
+[ALIASES]
+chalk-dust-torture|CDT
+chalk-dust-torture|Chalkdust
+[END]
 [SETLISTS]
 ID{1249948108}DATE{2000-09-17}URL{http://phish.net/setlists/phish-september-17-2000-merriweather-post-pavilion-columbia-md-usa.html}SET1{guyute,back-on-the-train,bathtub-gin,limb-by-limb,the-moma-dance,lawn-boy,fluffhead,the-curtain-with,chalk-dust-torture}SET2{rock-and-roll,theme-from-the-bottom,dog-log,the-mango-song,free}ENCORE{contact,rocky-top}
 ID{1249948445}DATE{1985-03-04}URL{http://phish.net/setlists/phish-march-04-1985-hunts-burlington-vt-usa.html}SET1{anarchy,camel-walk,fire-up-the-ganja,skippy-the-wondermouse,in-the-midnight-hour}
@@ -54,6 +60,10 @@ ID{1250458932}DATE{1994-04-06}URL{http://phish.net/setlists/phish-april-06-1994-
 		t.Errorf("Expected two shows with the song wolfmans-brother")
 	}
 
+	if got, want := i.Song("chalk-dust-torture").Aliases, []string{"CDT", "Chalkdust"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected aliases %v, but got %v", want, got)
+	}
+
 	writeFile, err := ioutil.TempFile("", "searcher-read-test")
 	if err != nil {
 		t.Fatal(err)
@@ -76,3 +86,150 @@ ID{1250458932}DATE{1994-04-06}URL{http://phish.net/setlists/phish-april-06-1994-
 		t.Errorf("Expected:\n%s\n\nGot:\n%s", indexStr, got)
 	}
 }
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		index string
+		err   string
+	}{
+		{
+			name:  "empty",
+			index: "",
+			err:   "index:1: index contains no header",
+		}, {
+			name:  "bad header",
+			index: "setsearcher\n[SONGS]\n[END]\n[SETLISTS]\n[END]",
+			err:   `index:1: index header malformed; "setsearcher"`,
+		}, {
+			name:  "unsupported version",
+			index: "setsearcher index 9\n[SONGS]\n[END]\n[SETLISTS]\n[END]",
+			err:   "index:1: unsupported index version 9",
+		}, {
+			name:  "missing songs section",
+			index: "setsearcher index 1\n[SETLISTS]\n[END]",
+			err:   `index:2: expected [SONGS] section, but found "[SETLISTS]"`,
+		}, {
+			name:  "missing aliases section",
+			index: "setsearcher index 2\n[SONGS]\n[END]\n[SETLISTS]\n[END]",
+			err:   `index:4: expected [ALIASES] section, but found "[SETLISTS]"`,
+		}, {
+			name:  "malformed alias",
+			index: "setsearcher index 2\n[SONGS]\n[END]\n[ALIASES]\nyem\n[END]\n[SETLISTS]\n[END]",
+			err:   `index:5: alias malformatted: "yem"`,
+		}, {
+			name:  "malformed song",
+			index: "setsearcher index 1\n[SONGS]\nTweezer|tweezer\nFee\n[END]\n[SETLISTS]\n[END]",
+			err:   `index:4: song malformatted: "Fee"`,
+		}, {
+			name:  "unclosed songs",
+			index: "setsearcher index 1\n[SONGS]\nTweezer|tweezer",
+			err:   "index:3: expected a closing statement for the songs section",
+		}, {
+			name:  "malformed setlist",
+			index: "setsearcher index 1\n[SONGS]\n[END]\n[SETLISTS]\nID{1}DATE{2000-01-01}URL{a}SET1{a}\nID{2}SET1{a}\n[END]",
+			err:   "index:6: ParseSetlist: couldn't find DATE tag in setlist: ID{2}SET1{a}",
+		}, {
+			name:  "duplicate setlist",
+			index: "setsearcher index 1\n[SONGS]\n[END]\n[SETLISTS]\nID{1}DATE{2000-01-01}URL{a}SET1{a}\nID{1}DATE{2000-01-01}URL{a}SET1{b}\n[END]",
+			err:   "index:6: duplicate setlist for show 1",
+		}, {
+			name:  "trailing content",
+			index: "setsearcher index 1\n[SONGS]\n[END]\n[SETLISTS]\n[END]\n\nextra",
+			err:   `index:7: unexpected content after the end of the index: "extra"`,
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Read(strings.NewReader(tc.index))
+			if err == nil {
+				t.Fatalf("expected error %q, but got nil", tc.err)
+			}
+			if err.Error() != tc.err {
+				t.Fatalf("got error %q, but expected %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestReadCRLF(t *testing.T) {
+	indexStr := "setsearcher index 1\r\n[SONGS]\r\nTweezer|tweezer\r\n[END]\r\n[SETLISTS]\r\nID{1}DATE{2000-01-01}URL{a}SET1{tweezer,fee}\r\n[END]\r\n"
+	i, err := Read(strings.NewReader(indexStr))
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	if got := i.Songs()["Tweezer"]; got != "tweezer" {
+		t.Errorf("got song %q, but expected tweezer", got)
+	}
+	if got := i.ShowUrl(1); got != "a" {
+		t.Errorf("got url %q, but expected a", got)
+	}
+	if got := len(i.reverseIndex["fee"]); got != 1 {
+		t.Errorf("got %d shows with fee, but expected 1", got)
+	}
+}
+
+func TestReadLenient(t *testing.T) {
+	indexStr := "setsearcher index 1\n[SONGS]\nTweezer|tweezer\nFee\n[END]\n[SETLISTS]\nID{1}DATE{2000-01-01}URL{a}SET1{tweezer}\nID{2}SET1{a}\nID{3}DATE{2000-01-03}URL{c}SET1{fee}\n[END]"
+	i, warnings, err := ReadWithOptions(strings.NewReader(indexStr), ReadOptions{Name: "test.txt", Lenient: true})
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	if len(i.setlists) != 2 {
+		t.Errorf("Wrong number of shows. Expected 2, but got %d", len(i.setlists))
+	}
+	var got []string
+	for _, w := range warnings {
+		got = append(got, w.Error())
+	}
+	want := []string{
+		`test.txt:4: song malformatted: "Fee"`,
+		"test.txt:8: ParseSetlist: couldn't find DATE tag in setlist: ID{2}SET1{a}",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got warnings:\n%v\nexpected:\n%v", got, want)
+	}
+
+	// Structural problems are errors even in lenient mode.
+	if _, _, err := ReadWithOptions(strings.NewReader("setsearcher index 1\n[SONGS]\n"), ReadOptions{Lenient: true}); err == nil {
+		t.Errorf("expected an error for an unclosed section, but got nil")
+	}
+}
+
+func TestReadHash(t *testing.T) {
+	read := func(s string) *Index {
+		t.Helper()
+		i, err := Read(strings.NewReader(s))
+		if err != nil {
+			t.Fatalf("unable to read index; %v", err)
+		}
+		return i
+	}
+	a, b, c := read(statsIndex), read(statsIndex), read(strings.Replace(statsIndex, "reba", "tube", -1))
+	if a.Hash() != b.Hash() {
+		t.Errorf("Identical indexes got different hashes %q and %q", a.Hash(), b.Hash())
+	}
+	if a.Hash() == c.Hash() {
+		t.Errorf("Different indexes got the same hash %q", a.Hash())
+	}
+	if a.Generation() >= b.Generation() {
+		t.Errorf("Got generation %d after %d, but expected it to increase", b.Generation(), a.Generation())
+	}
+	if a.ModTime().IsZero() {
+		t.Error("Got a zero ModTime, but expected the time the index was read")
+	}
+}
+
+func TestCheckSongText(t *testing.T) {
+	for _, s := range []string{"Mike's Song", "mikes-song", "Y.E.M."} {
+		if err := CheckSongText(s); err != nil {
+			t.Errorf("CheckSongText(%q) got unexpected error: %v", s, err)
+		}
+	}
+	for _, s := range []string{"", "a|b", "a\nb", "a\r", "[END]"} {
+		if err := CheckSongText(s); err == nil {
+			t.Errorf("CheckSongText(%q) expected an error, but got nil", s)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package index
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Song is a canonical song in the index.
+type Song struct {
+	// ID is the canonical short name of the song that is used in setlists,
+	// e.g. "mikes-song".
+	ID string
+	// Names are the human readable names that the song has been listed
+	// under, e.g. "Mike's Song".
+	Names []string
+	// Aliases are alternate names and abbreviations of the song, e.g. "YEM".
+	Aliases []string
+}
+
+// Name returns the first human readable name of the song, or its ID if it has
+// none.
+func (s *Song) Name() string {
+	if len(s.Names) == 0 {
+		return s.ID
+	}
+	return s.Names[0]
+}
+
+// Priorities of the ways a song can be looked up. When two songs share a
+// folded name, the one with the highest priority wins.
+const (
+	aliasPriority = iota
+	namePriority
+	idPriority
+)
+
+type songRef struct {
+	id       string
+	priority int
+}
+
+// SongTable maps the names, aliases and abbreviations of songs onto their
+// canonical song IDs.
+type SongTable struct {
+	songs map[string]*Song
+	// lookup maps folded names onto songs.
+	lookup map[string]songRef
+}
+
+// NewSongTable returns an empty SongTable.
+func NewSongTable() *SongTable {
+	return &SongTable{
+		songs:  make(map[string]*Song),
+		lookup: make(map[string]songRef),
+	}
+}
+
+// foldName folds a song name for lookup by dropping case, punctuation and
+// spaces, so that "Mike's Song", "Mikes Song" and "mikes-song" are all equal.
+func foldName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
+
+func (t *SongTable) add(key string, ref songRef) {
+	key = foldName(key)
+	if key == "" {
+		return
+	}
+	if old, ok := t.lookup[key]; ok && old.priority >= ref.priority {
+		return
+	}
+	t.lookup[key] = ref
+}
+
+func (t *SongTable) song(id string) *Song {
+	s := t.songs[id]
+	if s == nil {
+		s = &Song{ID: id}
+		t.songs[id] = s
+		t.add(id, songRef{id, idPriority})
+	}
+	return s
+}
+
+func insertSorted(list []string, s string) []string {
+	i := sort.SearchStrings(list, s)
+	if i < len(list) && list[i] == s {
+		return list
+	}
+	list = append(list, "")
+	copy(list[i+1:], list[i:])
+	list[i] = s
+	return list
+}
+
+// AddSong adds a song by its ID.
+func (t *SongTable) AddSong(id string) {
+	t.song(id)
+}
+
+// AddName adds a human readable name for the song with the given ID.
+func (t *SongTable) AddName(name, id string) {
+	s := t.song(id)
+	s.Names = insertSorted(s.Names, name)
+	t.add(name, songRef{id, namePriority})
+}
+
+// AddAlias adds an alias or abbreviation for the song with the given ID.
+func (t *SongTable) AddAlias(id, alias string) {
+	s := t.song(id)
+	s.Aliases = insertSorted(s.Aliases, alias)
+	t.add(alias, songRef{id, aliasPriority})
+}
+
+// Song returns the song with the given ID, or nil if there isn't one.
+func (t *SongTable) Song(id string) *Song {
+	return t.songs[id]
+}
+
+// Songs returns all of the songs in the table sorted by ID.
+func (t *SongTable) Songs() []*Song {
+	var songs []*Song
+	for _, s := range t.songs {
+		songs = append(songs, s)
+	}
+	sort.Slice(songs, func(i, j int) bool {
+		return songs[i].ID < songs[j].ID
+	})
+	return songs
+}
+
+// Resolve returns the ID of the song that name refers to. Name may be a song
+// ID, a human readable name or an alias, and is matched regardless of case and
+// punctuation.
+func (t *SongTable) Resolve(name string) (string, bool) {
+	if _, ok := t.songs[name]; ok {
+		return name, true
+	}
+	if ref, ok := t.lookup[foldName(name)]; ok {
+		return ref.id, true
+	}
+	return "", false
+}
+
+// CommonAliases are the well known abbreviations and nicknames of songs,
+// keyed by song ID.
+var CommonAliases = map[string][]string{
+	"ac/dc-bag":                       {"Bag"},
+	"also-sprach-zarathustra":         {"2001"},
+	"back-on-the-train":               {"BOTT"},
+	"backwards-down-the-number-line":  {"BDTNL"},
+	"bathtub-gin":                     {"Gin"},
+	"cars-trucks-buses":               {"CTB"},
+	"chalk-dust-torture":              {"CDT", "Chalkdust"},
+	"character-zero":                  {"Zero"},
+	"crosseyed-and-painless":          {"Crosseyed"},
+	"david-bowie":                     {"Bowie"},
+	"down-with-disease":               {"DWD", "Disease"},
+	"fluffhead":                       {"Fluff"},
+	"golgi-apparatus":                 {"Golgi"},
+	"good-times-bad-times":            {"GTBT"},
+	"gotta-jibboo":                    {"Jibboo"},
+	"harry-hood":                      {"Hood"},
+	"i-am-hydrogen":                   {"Hydrogen"},
+	"kill-devil-falls":                {"KDF"},
+	"limb-by-limb":                    {"LxL"},
+	"mikes-song":                      {"Mike's"},
+	"my-friend-my-friend":             {"MFMF"},
+	"punch-you-in-the-eye":            {"PYITE"},
+	"run-like-an-antelope":            {"Antelope"},
+	"runaway-jim":                     {"Jim"},
+	"sample-in-a-jar":                 {"Sample"},
+	"scent-of-a-mule":                 {"Mule"},
+	"slave-to-the-traffic-light":      {"Slave", "STTTL"},
+	"sneakin-sally-through-the-alley": {"Sally"},
+	"split-open-and-melt":             {"SOAM", "Melt"},
+	"suzy-greenberg":                  {"Suzy"},
+	"the-lizards":                     {"Lizards"},
+	"the-mango-song":                  {"Mango"},
+	"the-moma-dance":                  {"Moma"},
+	"the-squirming-coil":              {"Coil"},
+	"theme-from-the-bottom":           {"Theme"},
+	"tweezer-reprise":                 {"Tweeprise"},
+	"walls-of-the-cave":               {"WOTC"},
+	"weekapaug-groove":                {"Weekapaug", "Paug"},
+	"wolfmans-brother":                {"Wolfman's"},
+	"you-enjoy-myself":                {"YEM"},
+}
@@ -0,0 +1,46 @@
+package index
+
+import (
+	"testing"
+)
+
+func TestSongTableResolve(t *testing.T) {
+	st := NewSongTable()
+	st.AddName("Mike's Song", "mikes-song")
+	st.AddName("Mikes Song", "mikes-song")
+	st.AddName("You Enjoy Myself", "you-enjoy-myself")
+	st.AddAlias("you-enjoy-myself", "YEM")
+	st.AddName("Zero", "zero")
+	st.AddAlias("character-zero", "Zero")
+	st.AddSong("ac/dc-bag")
+
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{name: "mikes-song", want: "mikes-song", ok: true},
+		{name: "Mike's Song", want: "mikes-song", ok: true},
+		{name: "Mike’s Song", want: "mikes-song", ok: true},
+		{name: "MIKES SONG", want: "mikes-song", ok: true},
+		{name: "yem", want: "you-enjoy-myself", ok: true},
+		{name: "YEM", want: "you-enjoy-myself", ok: true},
+		{name: "ACDC Bag", want: "ac/dc-bag", ok: true},
+		// A song's name takes precedence over another song's alias.
+		{name: "Zero", want: "zero", ok: true},
+		{name: "Tweezer", want: "", ok: false},
+	}
+	for _, tc := range tests {
+		got, ok := st.Resolve(tc.name)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("Resolve(%q) = %q, %v; expected %q, %v", tc.name, got, ok, tc.want, tc.ok)
+		}
+	}
+
+	if got := st.Song("mikes-song").Name(); got != "Mike's Song" {
+		t.Errorf("Name() = %q; expected Mike's Song", got)
+	}
+	if got := st.Song("ac/dc-bag").Name(); got != "ac/dc-bag" {
+		t.Errorf("Name() = %q; expected ac/dc-bag", got)
+	}
+}
@@ -0,0 +1,141 @@
+package index
+
+import (
+	"sort"
+
+	"github.com/awbraunstein/setlist-search/searcher"
+	"github.com/pkg/errors"
+)
+
+// ErrUnknownSong is returned when a song isn't in the index.
+var ErrUnknownSong = errors.New("unknown song")
+
+// SongStats holds the performance history of a single song.
+type SongStats struct {
+	// Song is the canonical ID of the song and Name is its human readable name.
+	Song string `json:"song"`
+	Name string `json:"name"`
+	// Plays is the number of times the song was played, and Shows is the
+	// number of shows it was played in.
+	Plays int `json:"plays"`
+	Shows int `json:"shows"`
+	// FirstPlayed and LastPlayed are the dates of the debut and the most
+	// recent performance.
+	FirstPlayed string `json:"first_played"`
+	LastPlayed  string `json:"last_played"`
+	// CurrentGap is the number of shows since the song was last played.
+	CurrentGap int `json:"current_gap"`
+	// AverageGap and MaxGap describe the number of shows between consecutive
+	// performances.
+	AverageGap float64 `json:"average_gap"`
+	MaxGap     int     `json:"max_gap"`
+	// ByYear maps a year to the number of plays in that year.
+	ByYear map[string]int `json:"plays_by_year"`
+	// BySet maps a set name ("1", "2", "e", ...) to the number of plays in it.
+	BySet map[string]int `json:"plays_by_set"`
+	// ByPosition maps a position within a set ("opener", "middle" or
+	// "closer") to the number of plays in that position.
+	ByPosition map[string]int `json:"plays_by_position"`
+}
+
+// Positions of a song within a set.
+const (
+	PositionOpener = "opener"
+	PositionMiddle = "middle"
+	PositionCloser = "closer"
+)
+
+// position returns the position of the song at index n of a set with the
+// given length. A song that makes up a whole set is counted as its opener.
+func position(n, length int) string {
+	switch {
+	case n == 0:
+		return PositionOpener
+	case n == length-1:
+		return PositionCloser
+	}
+	return PositionMiddle
+}
+
+// buildOrder sorts the shows chronologically.
+func (i *Index) buildOrder() {
+	i.order = make([]int, 0, len(i.setlists))
+	for id := range i.setlists {
+		i.order = append(i.order, id)
+	}
+	sort.Slice(i.order, func(a, b int) bool {
+		x, y := i.setlists[i.order[a]], i.setlists[i.order[b]]
+		if x.Date != y.Date {
+			return x.Date < y.Date
+		}
+		return x.ShowId < y.ShowId
+	})
+	i.position = make(map[int]int, len(i.order))
+	for n, id := range i.order {
+		i.position[id] = n
+	}
+}
+
+// Stats returns the performance history of a song. The song may be given by
+// its ID, name or alias.
+func (i *Index) Stats(song string) (*SongStats, error) {
+	id, err := i.resolveKnownSong(song)
+	if err != nil {
+		return nil, err
+	}
+	stats := &SongStats{
+		Song:       id,
+		Name:       i.SongName(id),
+		ByYear:     make(map[string]int),
+		BySet:      make(map[string]int),
+		ByPosition: make(map[string]int),
+	}
+
+	// Find the chronological position of every show the song was played in.
+	seen := make(map[int]bool)
+	var positions []int
+	for _, show := range i.reverseIndex[id] {
+		if !seen[show] {
+			seen[show] = true
+			positions = append(positions, i.position[show])
+		}
+	}
+	sort.Ints(positions)
+
+	for _, n := range positions {
+		sl := i.setlists[i.order[n]]
+		for _, set := range sl.Sets {
+			if set.Kind == searcher.SoundcheckSet {
+				continue
+			}
+			for k, s := range set.Songs {
+				if s != id {
+					continue
+				}
+				stats.Plays++
+				if len(sl.Date) >= 4 {
+					stats.ByYear[sl.Date[:4]]++
+				}
+				stats.BySet[set.Name()]++
+				stats.ByPosition[position(k, len(set.Songs))]++
+			}
+		}
+	}
+
+	stats.Shows = len(positions)
+	stats.FirstPlayed = i.setlists[i.order[positions[0]]].Date
+	stats.LastPlayed = i.setlists[i.order[positions[len(positions)-1]]].Date
+	stats.CurrentGap = len(i.order) - 1 - positions[len(positions)-1]
+	totalGap := 0
+	for n := 1; n < len(positions); n++ {
+		gap := positions[n] - positions[n-1]
+		totalGap += gap
+		if gap > stats.MaxGap {
+			stats.MaxGap = gap
+		}
+	}
+	if len(positions) > 1 {
+		stats.AverageGap = float64(totalGap) / float64(len(positions)-1)
+	}
+	return stats, nil
+}
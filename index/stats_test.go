@@ -0,0 +1,69 @@
+package index
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+const statsIndex = `setsearcher index 2
+[SONGS]
+You Enjoy Myself|you-enjoy-myself
+[END]
+[ALIASES]
+you-enjoy-myself|YEM
+[END]
+[SETLISTS]
+ID{1}DATE{1990-01-20}URL{a}SET1{you-enjoy-myself,fee}SET2{reba,you-enjoy-myself}
+ID{2}DATE{1990-01-21}URL{b}SET1{fee,reba}
+ID{3}DATE{1991-05-02}URL{c}SET1{fee,reba}ENCORE{you-enjoy-myself}
+ID{4}DATE{1991-05-01}URL{d}SET1{fee,you-enjoy-myself,reba}
+ID{5}DATE{1992-01-01}URL{e}SOUNDCHECK{you-enjoy-myself,reba,fee}SET1{fee}
+ID{6}DATE{1992-01-02}URL{f}SET1{fee}
+[END]`
+
+func TestStats(t *testing.T) {
+	i, err := Read(strings.NewReader(statsIndex))
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	got, err := i.Stats("YEM")
+	if err != nil {
+		t.Fatalf("Stats(YEM) got unexpected error: %v", err)
+	}
+	want := &SongStats{
+		Song:        "you-enjoy-myself",
+		Name:        "You Enjoy Myself",
+		Plays:       4,
+		Shows:       3,
+		FirstPlayed: "1990-01-20",
+		LastPlayed:  "1991-05-02",
+		CurrentGap:  2,
+		AverageGap:  1.5,
+		MaxGap:      2,
+		ByYear:      map[string]int{"1990": 2, "1991": 2},
+		BySet:       map[string]int{"1": 2, "2": 1, "e": 1},
+		ByPosition: map[string]int{
+			PositionOpener: 2,
+			PositionMiddle: 1,
+			PositionCloser: 1,
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %+v\nexpected: %+v", got, want)
+	}
+}
+
+func TestStatsUnknownSong(t *testing.T) {
+	i, err := Read(strings.NewReader(statsIndex))
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	for _, song := range []string{"tweezer", ""} {
+		if _, err := i.Stats(song); errors.Cause(err) != ErrUnknownSong {
+			t.Errorf("Stats(%q) = %v, but expected ErrUnknownSong", song, err)
+		}
+	}
+}
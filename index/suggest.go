@@ -0,0 +1,290 @@
+package index
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/awbraunstein/setlist-search/index/query"
+)
+
+// Kinds of suggestions.
+const (
+	SuggestSong    = "song"
+	SuggestKeyword = "keyword"
+	SuggestField   = "field"
+)
+
+// MaxSuggestions is the most suggestions that Suggest returns.
+const MaxSuggestions = 25
+
+// keywords are the operators of the query language.
+var keywords = []string{"AND", "OR", "NOT"}
+
+// Suggestion is a completion of a partially typed query term.
+type Suggestion struct {
+	// Kind is SuggestSong, SuggestKeyword or SuggestField.
+	Kind string `json:"kind"`
+	// Value is the text to put in the query: the song ID, the keyword or the
+	// field followed by a colon, e.g. "venue:".
+	Value string `json:"value"`
+	// Name is the human readable name of a song.
+	Name string `json:"name,omitempty"`
+	// Plays is the number of shows a song was played in.
+	Plays int `json:"plays,omitempty"`
+	// Fuzzy is whether the song only approximately matched.
+	Fuzzy bool `json:"fuzzy,omitempty"`
+}
+
+// trie maps the folded names of songs onto the songs. Each node holds the
+// most played songs beneath it, so completing a prefix only walks the prefix.
+type trie struct {
+	root  *trieNode
+	plays map[string]int
+}
+
+type trieNode struct {
+	children map[rune]*trieNode
+	// ids are the songs with a name that ends at this node.
+	ids []string
+	// top are the most played songs with a name that starts with the
+	// prefix of this node, most played first.
+	top []string
+}
+
+func newTrieNode() *trieNode {
+	return &trieNode{children: make(map[rune]*trieNode)}
+}
+
+func (t *trie) insert(key, id string) {
+	n := t.root
+	for _, r := range key {
+		child, ok := n.children[r]
+		if !ok {
+			child = newTrieNode()
+			n.children[r] = child
+		}
+		n = child
+	}
+	n.ids = append(n.ids, id)
+}
+
+// less orders songs by the number of times they were played, then by ID.
+func (t *trie) less(a, b string) bool {
+	if t.plays[a] != t.plays[b] {
+		return t.plays[a] > t.plays[b]
+	}
+	return a < b
+}
+
+// rank fills in the top songs of n and the nodes beneath it.
+func (t *trie) rank(n *trieNode) {
+	seen := make(map[string]bool)
+	var top []string
+	add := func(id string) {
+		if !seen[id] {
+			seen[id] = true
+			top = append(top, id)
+		}
+	}
+	for _, id := range n.ids {
+		add(id)
+	}
+	for _, child := range n.children {
+		t.rank(child)
+		for _, id := range child.top {
+			add(id)
+		}
+	}
+	sort.Slice(top, func(i, j int) bool { return t.less(top[i], top[j]) })
+	if len(top) > MaxSuggestions {
+		top = top[:MaxSuggestions]
+	}
+	n.top = top
+}
+
+// lookup returns the node of a prefix, or nil if no name starts with it.
+func (t *trie) lookup(prefix string) *trieNode {
+	n := t.root
+	for _, r := range prefix {
+		n = n.children[r]
+		if n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// fuzzy calls visit with the distance of each node whose prefix is within
+// maxDist edits of query. The descendants of a visited node aren't visited.
+func (t *trie) fuzzy(query []rune, maxDist int, visit func(n *trieNode, dist int)) {
+	row := make([]int, len(query)+1)
+	for j := range row {
+		row[j] = j
+	}
+	var walk func(n *trieNode, r rune, prev []int)
+	walk = func(n *trieNode, r rune, prev []int) {
+		row := make([]int, len(prev))
+		row[0] = prev[0] + 1
+		best := row[0]
+		for j := 1; j < len(row); j++ {
+			cost := 1
+			if query[j-1] == r {
+				cost = 0
+			}
+			row[j] = minInt(minInt(row[j-1]+1, prev[j]+1), prev[j-1]+cost)
+			best = minInt(best, row[j])
+		}
+		if dist := row[len(row)-1]; dist <= maxDist {
+			visit(n, dist)
+			return
+		}
+		if best > maxDist {
+			return
+		}
+		for r, child := range n.children {
+			walk(child, r, row)
+		}
+	}
+	for r, child := range t.root.children {
+		walk(child, r, row)
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// nameKeys returns the keys a name is completed from: the folded name and the
+// folded name from each of its later words, so that "gin" completes
+// "Bathtub Gin".
+func nameKeys(name string) []string {
+	var keys []string
+	wordStart := true
+	for i, r := range name {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWord && wordStart {
+			if key := foldName(name[i:]); key != "" {
+				keys = append(keys, key)
+			}
+		}
+		wordStart = !isWord
+	}
+	return keys
+}
+
+func (i *Index) suggester() *trie {
+	i.suggestOnce.Do(func() {
+		t := &trie{root: newTrieNode(), plays: i.relations().showCounts}
+		for _, s := range i.songTable.Songs() {
+			names := append([]string{s.ID}, s.Names...)
+			names = append(names, s.Aliases...)
+			for _, name := range names {
+				for _, key := range nameKeys(name) {
+					t.insert(key, s.ID)
+				}
+			}
+		}
+		t.rank(t.root)
+		i.suggestions = t
+	})
+	return i.suggestions
+}
+
+// maxEdits returns the number of edits allowed in a fuzzy match of a prefix
+// with n letters. Short prefixes match too much to allow any.
+func maxEdits(n int) int {
+	switch {
+	case n < 3:
+		return 0
+	case n < 6:
+		return 1
+	}
+	return 2
+}
+
+// Suggest returns up to n completions of a partially typed query term: the
+// keywords AND, OR and NOT and the fields, such as venue:, that it starts, then
+// the songs with a name, ID or alias that it starts or any word of a name that
+// it starts, most played first. Songs that only approximately match come last.
+func (i *Index) Suggest(prefix string, n int) []Suggestion {
+	if n > MaxSuggestions {
+		n = MaxSuggestions
+	}
+	suggestions := []Suggestion{}
+	if prefix == "" || n < 1 {
+		return suggestions
+	}
+	for _, k := range keywords {
+		if strings.HasPrefix(k, strings.ToUpper(prefix)) {
+			suggestions = append(suggestions, Suggestion{Kind: SuggestKeyword, Value: k})
+		}
+	}
+	for _, f := range query.Fields {
+		if strings.HasPrefix(f+":", strings.ToLower(prefix)) {
+			suggestions = append(suggestions, Suggestion{Kind: SuggestField, Value: f + ":"})
+		}
+	}
+
+	t := i.suggester()
+	seen := make(map[string]bool)
+	song := func(id string, fuzzy bool) {
+		if !seen[id] {
+			seen[id] = true
+			suggestions = append(suggestions, Suggestion{
+				Kind:  SuggestSong,
+				Value: id,
+				Name:  i.SongName(id),
+				Plays: t.plays[id],
+				Fuzzy: fuzzy,
+			})
+		}
+	}
+	folded := foldName(prefix)
+	if folded == "" {
+		return truncateSuggestions(suggestions, n)
+	}
+	if node := t.lookup(folded); node != nil {
+		for _, id := range node.top {
+			song(id, false)
+		}
+	}
+	if len(suggestions) < n {
+		if maxDist := maxEdits(len([]rune(folded))); maxDist > 0 {
+			dists := make(map[string]int)
+			t.fuzzy([]rune(folded), maxDist, func(node *trieNode, dist int) {
+				for _, id := range node.top {
+					if d, ok := dists[id]; !ok || dist < d {
+						dists[id] = dist
+					}
+				}
+			})
+			var ids []string
+			for id := range dists {
+				if !seen[id] {
+					ids = append(ids, id)
+				}
+			}
+			sort.Slice(ids, func(a, b int) bool {
+				if dists[ids[a]] != dists[ids[b]] {
+					return dists[ids[a]] < dists[ids[b]]
+				}
+				return t.less(ids[a], ids[b])
+			})
+			for _, id := range ids {
+				song(id, true)
+			}
+		}
+	}
+	return truncateSuggestions(suggestions, n)
+}
+
+func truncateSuggestions(suggestions []Suggestion, n int) []Suggestion {
+	if len(suggestions) > n {
+		return suggestions[:n]
+	}
+	return suggestions
+}
@@ -0,0 +1,98 @@
+package index
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const suggestIndex = `setsearcher index 2
+[SONGS]
+Bathtub Gin|bathtub-gin
+Mike's Song|mikes-song
+Tweezer|tweezer
+Tweezer Reprise|tweezer-reprise
+You Enjoy Myself|you-enjoy-myself
+[END]
+[ALIASES]
+you-enjoy-myself|YEM
+[END]
+[SETLISTS]
+ID{1}DATE{1990-01-20}URL{a}SET1{tweezer,bathtub-gin,tweezer-reprise}
+ID{2}DATE{1990-01-21}URL{b}SET1{tweezer,mikes-song,you-enjoy-myself}
+ID{3}DATE{1990-01-22}URL{c}SET1{tweezer-reprise,mikes-song}
+ID{4}DATE{1990-01-23}URL{d}SET1{tweezer-reprise,reba}
+[END]`
+
+// values returns the kind and value of each suggestion, with a ~ before
+// fuzzy matches.
+func values(suggestions []Suggestion) []string {
+	var got []string
+	for _, s := range suggestions {
+		v := s.Kind + ":" + s.Value
+		if s.Fuzzy {
+			v = "~" + v
+		}
+		got = append(got, v)
+	}
+	return got
+}
+
+func TestSuggest(t *testing.T) {
+	i, err := Read(strings.NewReader(suggestIndex))
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	tests := []struct {
+		prefix string
+		n      int
+		want   []string
+	}{
+		// Ranked by plays.
+		{"tw", 10, []string{"song:tweezer-reprise", "song:tweezer"}},
+		{"TWEEZER R", 10, []string{"song:tweezer-reprise", "~song:tweezer"}},
+		// Names, IDs and aliases.
+		{"mike's", 10, []string{"song:mikes-song"}},
+		{"mikes-s", 10, []string{"song:mikes-song"}},
+		{"yem", 10, []string{"song:you-enjoy-myself"}},
+		// Later words of a name.
+		{"gin", 10, []string{"song:bathtub-gin"}},
+		{"rep", 10, []string{"song:tweezer-reprise", "~song:reba"}},
+		// Keywords come first.
+		{"n", 10, []string{"keyword:NOT"}},
+		{"o", 10, []string{"keyword:OR"}},
+		{"an", 10, []string{"keyword:AND"}},
+		// So do fields, which complete with a colon.
+		{"venu", 10, []string{"field:venue:"}},
+		{"Venue:", 10, []string{"field:venue:"}},
+		{"y", 10, []string{"field:year:", "song:you-enjoy-myself"}},
+		{"t", 2, []string{"field:tour:", "song:tweezer-reprise"}},
+		// Fuzzy matches come last.
+		{"twezer", 10, []string{"~song:tweezer-reprise", "~song:tweezer"}},
+		{"rebba", 10, []string{"~song:reba"}},
+		{"bathtob", 10, []string{"~song:bathtub-gin"}},
+		// Short prefixes aren't fuzzy.
+		{"tx", 10, nil},
+		{"", 10, nil},
+		{"'", 10, nil},
+		{"tw", 1, []string{"song:tweezer-reprise"}},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.prefix, func(t *testing.T) {
+			got := i.Suggest(tc.prefix, tc.n)
+			if got == nil {
+				t.Fatal("Suggest returned nil")
+			}
+			if !reflect.DeepEqual(values(got), tc.want) {
+				t.Errorf("Suggest(%q, %d) = %q, but expected %q", tc.prefix, tc.n, values(got), tc.want)
+			}
+		})
+	}
+
+	got := i.Suggest("tweezer r", 1)
+	want := []Suggestion{{Kind: SuggestSong, Value: "tweezer-reprise", Name: "Tweezer Reprise", Plays: 3}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Suggest(tweezer r) = %+v, but expected %+v", got, want)
+	}
+}
@@ -1,13 +1,16 @@
 package index
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"sort"
 	"strings"
 
 	"github.com/awbraunstein/setlist-search/searcher"
+	"github.com/pkg/errors"
 )
 
 type IndexWriter struct {
@@ -16,6 +19,8 @@ type IndexWriter struct {
 	// setlists is a map from showid to setlist info.
 	setlists map[int]*searcher.Setlist
 	songs    map[string]string
+	// aliases is a map from short name to the set of aliases for that song.
+	aliases map[string]map[string]bool
 
 	// The tmp file we will be writing to.
 	file *os.File
@@ -26,6 +31,7 @@ func NewWriter(indexLocation string) *IndexWriter {
 		indexLocation: indexLocation,
 		setlists:      make(map[int]*searcher.Setlist),
 		songs:         make(map[string]string),
+		aliases:       make(map[string]map[string]bool),
 	}
 }
 
@@ -37,18 +43,55 @@ func (w *IndexWriter) AddSong(songName, songValue string) {
 	w.songs[songName] = songValue
 }
 
+// CheckSongText returns an error if s can't be written to an index as a song
+// name, ID or alias. The songs and aliases sections hold one "|" separated
+// pair per line, so s can't be empty or contain "|" or a line break.
+func CheckSongText(s string) error {
+	switch {
+	case s == "":
+		return errors.New("song names, IDs and aliases can't be empty")
+	case strings.ContainsAny(s, "|\r\n"):
+		return fmt.Errorf("%q can't contain | or a line break", s)
+	case s == "[END]":
+		return fmt.Errorf("%q ends an index section", s)
+	}
+	return nil
+}
+
+// AddAlias adds an alias, such as an abbreviation, for the song with the given
+// short name. Aliases for songs that were never added are not written.
+func (w *IndexWriter) AddAlias(songValue, alias string) {
+	if w.aliases[songValue] == nil {
+		w.aliases[songValue] = make(map[string]bool)
+	}
+	w.aliases[songValue][alias] = true
+}
+
+// Write writes the index to a temporary file and then moves it to the index
+// location, so that readers never see a partially written index.
 func (w *IndexWriter) Write() error {
 	var err error
 	w.file, err = ioutil.TempFile("", "")
 	if err != nil {
 		return err
 	}
-	if _, err := w.file.WriteString(header); err != nil {
+	if _, err := w.WriteTo(w.file); err != nil {
+		w.file.Close()
+		os.Remove(w.file.Name())
 		return err
 	}
-	if _, err := w.file.WriteString("\n"); err != nil {
+	if err := w.file.Close(); err != nil {
+		os.Remove(w.file.Name())
 		return err
 	}
+	return os.Rename(w.file.Name(), w.indexLocation)
+}
+
+// WriteTo writes the serialized index to out.
+func (w *IndexWriter) WriteTo(out io.Writer) (int64, error) {
+	var b bytes.Buffer
+	b.WriteString(header)
+	b.WriteString("\n")
 
 	var songNames []string
 	for name := range w.songs {
@@ -60,14 +103,23 @@ func (w *IndexWriter) Write() error {
 	for _, name := range songNames {
 		songs = append(songs, fmt.Sprintf("%s|%s", name, w.songs[name]))
 	}
-	w.file.WriteString("[SONGS]\n")
-	if _, err := w.file.WriteString(strings.Join(songs, "\n")); err != nil {
-		return err
+	writeSection(&b, "[SONGS]", songs)
+
+	knownSongs := make(map[string]bool)
+	for _, value := range w.songs {
+		knownSongs[value] = true
 	}
-	if len(songs) > 0 {
-		w.file.WriteString("\n")
+	var aliases []string
+	for value, set := range w.aliases {
+		if !knownSongs[value] {
+			continue
+		}
+		for alias := range set {
+			aliases = append(aliases, fmt.Sprintf("%s|%s", value, alias))
+		}
 	}
-	w.file.WriteString("[END]\n")
+	sort.Strings(aliases)
+	writeSection(&b, "[ALIASES]", aliases)
 
 	var showIds []int
 	for key := range w.setlists {
@@ -79,16 +131,19 @@ func (w *IndexWriter) Write() error {
 	for _, id := range showIds {
 		setlists = append(setlists, w.setlists[id].String())
 	}
-	w.file.WriteString("[SETLISTS]\n")
-	if _, err := w.file.WriteString(strings.Join(setlists, "\n")); err != nil {
-		return err
-	}
-	if len(setlists) > 0 {
-		w.file.WriteString("\n")
+	writeSection(&b, "[SETLISTS]", setlists)
+	// The index doesn't end with a newline.
+	b.Truncate(b.Len() - 1)
+	return b.WriteTo(out)
+}
+
+// writeSection writes a section of the index with a line per entry.
+func writeSection(b *bytes.Buffer, name string, lines []string) {
+	b.WriteString(name + "\n")
+	for _, line := range lines {
+		b.WriteString(line + "\n")
 	}
-	w.file.WriteString("[END]")
-	w.file.Close()
-	return os.Rename(w.file.Name(), w.indexLocation)
+	b.WriteString("[END]\n")
 }
 
 func (i *Index) Write(indexLocation string) error {
@@ -99,5 +154,10 @@ func (i *Index) Write(indexLocation string) error {
 	for songName, songValue := range i.songs {
 		iw.AddSong(songName, songValue)
 	}
+	for _, song := range i.songTable.Songs() {
+		for _, alias := range song.Aliases {
+			iw.AddAlias(song.ID, alias)
+		}
+	}
 	return iw.Write()
 }
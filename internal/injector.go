@@ -2,11 +2,13 @@ package internal
 
 import (
 	"context"
+	"crypto/rand"
 	"fmt"
 	"log"
-	"math/rand"
 	"os"
+	"strings"
 	"sync"
+	"time"
 
 	"cloud.google.com/go/pubsub"
 	"cloud.google.com/go/storage"
@@ -18,13 +20,44 @@ import (
 const (
 	// InjectorContextKey is the key used to lookup the Index from the echo.Context.
 	InjectorContextKey = "index-injector-context-key"
+	// CacheContextKey is the key used to lookup the query Cache from the
+	// echo.Context. It's only set when the injector has a cache.
+	CacheContextKey = "index-injector-cache-context-key"
 )
 
 // IndexInjector stores a pointer to an index and injects it into the context.
 type IndexInjector struct {
-	sub *pubsub.Subscription
-	idx *index.Index
-	mu  sync.Mutex
+	client  *pubsub.Client
+	sub     *pubsub.Subscription
+	cancel  context.CancelFunc
+	done    chan struct{} // closed when start returns
+	idx     *index.Index
+	cache   *index.Cache
+	metrics *Metrics
+	loaded  time.Time
+	// receiving is whether the subscription is receiving notifications.
+	receiving bool
+	mu        sync.Mutex
+}
+
+// IndexStatus describes the injected index.
+type IndexStatus struct {
+	Index *index.Index
+	// Loaded is the time the index was loaded.
+	Loaded time.Time
+	// Remote is whether the index is reloaded from a remote source.
+	Remote bool
+	// Subscribed is whether the injector is receiving notifications that the
+	// remote index has changed. It's always false for a local index.
+	Subscribed bool
+}
+
+// UseCache makes the injector inject a query cache alongside the index. The
+// cache is purged whenever a new index is swapped in.
+func (s *IndexInjector) UseCache(cache *index.Cache) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cache = cache
 }
 
 func NewCloudInjector(ctx context.Context, bucketName, objectName, projectId, topicName string) (*IndexInjector, error) {
@@ -39,11 +72,14 @@ func NewCloudInjector(ctx context.Context, bucketName, objectName, projectId, to
 		return nil, errors.Wrap(err, "failed to create reader for remote index")
 	}
 	defer r.Close()
-	idx, err := index.Read(r)
+	idx, _, err := index.ReadWithOptions(r, index.ReadOptions{ModTime: r.Attrs.LastModified})
+	if err != nil {
+		return nil, err
+	}
+	subname, err := subscriptionName()
 	if err != nil {
 		return nil, err
 	}
-	subname := fmt.Sprintf("searchersub-%d", rand.Intn(1000))
 	log.Printf("Creating a new subscriber with name: %s", subname)
 	pubsubClient, err := pubsub.NewClient(ctx, projectId)
 	if err != nil {
@@ -53,63 +89,170 @@ func NewCloudInjector(ctx context.Context, bucketName, objectName, projectId, to
 	sub, err := pubsubClient.CreateSubscription(ctx, subname,
 		pubsub.SubscriptionConfig{Topic: topic})
 	if err != nil {
+		pubsubClient.Close()
 		return nil, errors.Wrap(err, "unable to create a new subscription")
 	}
-	ii := &IndexInjector{sub: sub, idx: idx}
+	ctx, cancel := context.WithCancel(ctx)
+	ii := &IndexInjector{
+		client:    pubsubClient,
+		sub:       sub,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		idx:       idx,
+		loaded:    time.Now(),
+		receiving: true,
+	}
 	go ii.start(ctx, bucketName, objectName)
 	return ii, nil
 }
 
+// subscriptionName returns a name for a new subscription that's unique to
+// this process. It includes the hostname, which is the pod name on
+// Kubernetes, so that leaked subscriptions can be traced back to their pod.
+func subscriptionName() (string, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		return "", errors.Wrap(err, "unable to get hostname")
+	}
+	// Subscription names may only contain letters, numbers and a few symbols.
+	host = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' {
+			return r
+		}
+		return '-'
+	}, host)
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "unable to generate a subscription name")
+	}
+	return fmt.Sprintf("searchersub-%s-%x", host, b), nil
+}
+
+// Close stops receiving notifications and deletes the subscription created
+// for the remote index. It does nothing for a local index.
+func (s *IndexInjector) Close(ctx context.Context) error {
+	if s.sub == nil {
+		return nil
+	}
+	s.cancel()
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer s.client.Close()
+	log.Printf("Deleting subscription %s", s.sub.ID())
+	if err := s.sub.Delete(ctx); err != nil {
+		return errors.Wrapf(err, "unable to delete subscription %s", s.sub.ID())
+	}
+	return nil
+}
+
 func (s *IndexInjector) start(ctx context.Context, bucketName, objectName string) {
+	defer close(s.done)
+	defer s.stopReceiving()
 	err := s.sub.Receive(ctx, func(ctx context.Context, m *pubsub.Message) {
-		if m.Attributes["eventType"] == "OBJECT_FINALIZE" && m.Attributes["bucketId"] == "setlist-searcher-index" && m.Attributes["objectId"] == "index.txt" {
-			client, err := storage.NewClient(ctx)
+		if m.Attributes["eventType"] == "OBJECT_FINALIZE" && m.Attributes["bucketId"] == bucketName && m.Attributes["objectId"] == objectName {
+			err := s.reload(ctx, bucketName, objectName)
+			s.mu.Lock()
+			metrics := s.metrics
+			s.mu.Unlock()
+			metrics.countReload(err)
 			if err != nil {
-				log.Printf("Failed to create client: %v\n", err)
-			}
-			defer client.Close()
-			object := client.Bucket(bucketName).Object(objectName)
-			r, err := object.NewReader(ctx)
-			if err != nil {
-				log.Printf("failed to create reader for remote index: %v\n", err)
-			}
-			defer r.Close()
-			idx, err := index.Read(r)
-			if err != nil {
-				log.Printf("Unable to read index: %v\n", err)
-			} else {
-				s.mu.Lock()
-				s.idx = idx
-				s.mu.Unlock()
+				log.Printf("Unable to reload index: %v\n", err)
 			}
 		}
 		m.Ack()
 	})
-	if err != context.Canceled {
+	if err != nil && err != context.Canceled {
 		log.Printf("Error handling pubsub notification: %v\n", err)
 	}
 }
 
-// NewInjector returns a new IndexInjector.
-func NewInjector(location string) (*IndexInjector, error) {
-	file, err := os.Open(location)
+func (s *IndexInjector) stopReceiving() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.receiving = false
+}
+
+// reload reads the remote index and swaps it in.
+func (s *IndexInjector) reload(ctx context.Context, bucketName, objectName string) error {
+	client, err := storage.NewClient(ctx)
 	if err != nil {
-		return nil, err
+		return errors.Wrap(err, "failed to create client")
+	}
+	defer client.Close()
+	object := client.Bucket(bucketName).Object(objectName)
+	r, err := object.NewReader(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to create reader for remote index")
+	}
+	defer r.Close()
+	idx, _, err := index.ReadWithOptions(r, index.ReadOptions{ModTime: r.Attrs.LastModified})
+	if err != nil {
+		return err
+	}
+	s.swap(idx)
+	return nil
+}
+
+// swap replaces the injected index, dropping the cached results of the old one.
+func (s *IndexInjector) swap(idx *index.Index) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.idx = idx
+	s.loaded = time.Now()
+	log.Printf("Swapped in index %s (generation %d)", idx.Hash(), idx.Generation())
+	if s.cache != nil {
+		s.cache.Purge()
 	}
-	idx, err := index.Read(file)
+}
+
+// Index returns the injected index.
+func (s *IndexInjector) Index() *index.Index {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.idx
+}
+
+// Loaded returns the time the injected index was loaded.
+func (s *IndexInjector) Loaded() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loaded
+}
+
+// Status returns the status of the injected index.
+func (s *IndexInjector) Status() IndexStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return IndexStatus{
+		Index:      s.idx,
+		Loaded:     s.loaded,
+		Remote:     s.sub != nil,
+		Subscribed: s.receiving,
+	}
+}
+
+// NewInjector returns a new IndexInjector.
+func NewInjector(location string) (*IndexInjector, error) {
+	idx, _, err := index.ReadFile(location, index.ReadOptions{})
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
-	return &IndexInjector{idx: idx}, nil
+	return &IndexInjector{idx: idx, loaded: time.Now()}, nil
 }
 
 // Middleware injects the index into the context.
 func (s *IndexInjector) Middleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		s.mu.Lock()
-		defer s.mu.Unlock()
-		c.Set(InjectorContextKey, s.idx)
+		idx, cache := s.idx, s.cache
+		s.mu.Unlock()
+		c.Set(InjectorContextKey, idx)
+		if cache != nil {
+			c.Set(CacheContextKey, cache)
+		}
 		return next(c)
 	}
 }
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/awbraunstein/setlist-search/index"
+)
+
+const testIndex = `setsearcher index 2
+[SONGS]
+[END]
+[ALIASES]
+[END]
+[SETLISTS]
+ID{1}DATE{1997-11-22}URL{a}SET1{fee}
+[END]`
+
+func TestInjectorSwapPurgesCache(t *testing.T) {
+	idx, err := index.Read(strings.NewReader(testIndex))
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	s := &IndexInjector{idx: idx}
+	cache := index.NewCache(1 << 20)
+	s.UseCache(cache)
+	if _, err := cache.Query(context.Background(), idx, "fee"); err != nil {
+		t.Fatalf("Query got unexpected error: %v", err)
+	}
+	if got := cache.Stats().Entries; got != 1 {
+		t.Fatalf("got %d cache entries, but expected 1", got)
+	}
+
+	next, err := index.Read(strings.NewReader(testIndex))
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	s.swap(next)
+	if s.idx != next {
+		t.Error("swap didn't replace the index")
+	}
+	if got := cache.Stats().Entries; got != 0 {
+		t.Errorf("got %d cache entries after swap, but expected 0", got)
+	}
+}
+
+func TestSubscriptionName(t *testing.T) {
+	valid := regexp.MustCompile(`^searchersub-[A-Za-z0-9-]+-[0-9a-f]{8}$`)
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		name, err := subscriptionName()
+		if err != nil {
+			t.Fatalf("subscriptionName got unexpected error: %v", err)
+		}
+		if !valid.MatchString(name) {
+			t.Errorf("got invalid subscription name %q", name)
+		}
+		if seen[name] {
+			t.Errorf("got duplicate subscription name %q", name)
+		}
+		seen[name] = true
+	}
+}
+
+func TestCloseLocalInjector(t *testing.T) {
+	idx, err := index.Read(strings.NewReader(testIndex))
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	s := &IndexInjector{idx: idx}
+	if err := s.Close(context.Background()); err != nil {
+		t.Errorf("Close got unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,218 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/awbraunstein/setlist-search/index/query"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// QueryLimitsContextKey is the key used to lookup the query.Limits from the
+// echo.Context. Queries aren't limited if it isn't set.
+const QueryLimitsContextKey = "query-limits-context-key"
+
+// QueryLimits returns middleware that injects the limits on the complexity
+// of search queries into the context.
+func QueryLimits(limits query.Limits) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(QueryLimitsContextKey, limits)
+			return next(c)
+		}
+	}
+}
+
+// RateLimiter limits the rate of requests from each client with a token
+// bucket per client IP. Clients are identified by the address of the
+// connection. X-Forwarded-For and X-Real-IP are only believed when the
+// connection comes from one of the proxies given to TrustProxies, since any
+// client can set them. RateLimiter is safe for concurrent use.
+type RateLimiter struct {
+	// Skipper selects requests that aren't limited.
+	Skipper middleware.Skipper
+
+	rate  float64 // tokens added per second
+	burst float64 // size of each bucket
+	// maxClients bounds the number of buckets. When it's reached, the least
+	// recently seen client is forgotten.
+	maxClients int
+	proxies    []*net.IPNet
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// defaultMaxClients is the number of clients that a RateLimiter remembers.
+const defaultMaxClients = 10000
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a RateLimiter that allows each client rate requests
+// per second on average, and bursts of up to burst requests. The burst is at
+// least one request.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		Skipper:    middleware.DefaultSkipper,
+		rate:       rate,
+		burst:      float64(burst),
+		maxClients: defaultMaxClients,
+		buckets:    make(map[string]*bucket),
+		now:        time.Now,
+	}
+}
+
+// TrustProxies sets the proxies whose X-Forwarded-For and X-Real-IP headers
+// identify the client. proxies is a comma separated list of IPs and CIDRs,
+// e.g. "10.0.0.0/8,192.168.1.1".
+func (l *RateLimiter) TrustProxies(proxies string) error {
+	var nets []*net.IPNet
+	for _, p := range strings.Split(proxies, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if !strings.Contains(p, "/") {
+			if ip := net.ParseIP(p); ip != nil && ip.To4() != nil {
+				p += "/32"
+			} else {
+				p += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q", p)
+		}
+		nets = append(nets, n)
+	}
+	l.proxies = nets
+	return nil
+}
+
+func (l *RateLimiter) trusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range l.proxies {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the IP of the client that made r. Forwarding headers are
+// only followed through trusted proxies, and X-Forwarded-For is read from the
+// right, since its leftmost entries are whatever the client sent.
+func (l *RateLimiter) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !l.trusted(ip) {
+		return ip
+	}
+	if xff := r.Header[echo.HeaderXForwardedFor]; len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if hop == "" {
+				continue
+			}
+			ip = hop
+			if !l.trusted(hop) {
+				break
+			}
+		}
+		return ip
+	}
+	if realIP := strings.TrimSpace(r.Header.Get(echo.HeaderXRealIP)); realIP != "" {
+		return realIP
+	}
+	return ip
+}
+
+// Allow takes a token from the client's bucket. If the bucket is empty, it
+// returns false and how long the client must wait for the next token.
+func (l *RateLimiter) Allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+	b, ok := l.buckets[client]
+	if !ok {
+		if len(l.buckets) >= l.maxClients {
+			l.evictOldest()
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep forgets the clients whose buckets have refilled, since they're the
+// same as new buckets. It only looks at the buckets once per refill period, so
+// its cost is spread over the requests in that period.
+func (l *RateLimiter) sweep(now time.Time) {
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.lastSweep) < refill {
+		return
+	}
+	l.lastSweep = now
+	for client, b := range l.buckets {
+		if now.Sub(b.last) >= refill {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// evictOldest forgets the client that was seen least recently.
+func (l *RateLimiter) evictOldest() {
+	var oldest string
+	var last *bucket
+	for client, b := range l.buckets {
+		if last == nil || b.last.Before(last.last) {
+			oldest, last = client, b
+		}
+	}
+	delete(l.buckets, oldest)
+}
+
+// Middleware rejects requests from clients that exceed their rate with a
+// 429 response.
+func (l *RateLimiter) Middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if l.Skipper(c) {
+			return next(c)
+		}
+		if ok, wait := l.Allow(l.clientIP(c.Request())); !ok {
+			seconds := int(math.Ceil(wait.Seconds()))
+			c.Response().Header().Set("Retry-After", strconv.Itoa(seconds))
+			return echo.NewHTTPError(http.StatusTooManyRequests, "Too many requests")
+		}
+		return next(c)
+	}
+}
@@ -0,0 +1,158 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/awbraunstein/setlist-search/index/query"
+	"github.com/labstack/echo/v4"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := NewRateLimiter(2, 3)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d of the burst wasn't allowed", i)
+		}
+	}
+	ok, wait := l.Allow("a")
+	if ok {
+		t.Fatal("request after the burst was allowed")
+	}
+	if wait != 500*time.Millisecond {
+		t.Errorf("got wait %v, but expected 500ms", wait)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("another client's request wasn't allowed")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("request after refilling a token wasn't allowed")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Error("second request after refilling a token was allowed")
+	}
+
+	// Buckets that have refilled are forgotten.
+	now = now.Add(time.Minute)
+	l.Allow("c")
+	if _, ok := l.buckets["a"]; ok {
+		t.Error("full bucket wasn't swept")
+	}
+	if got := len(l.buckets); got != 1 {
+		t.Errorf("got %d buckets after sweeping, but expected 1", got)
+	}
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	l := NewRateLimiter(1, 1)
+	l.Skipper = func(c echo.Context) bool { return c.Path() == "/healthz" }
+	e := echo.New()
+	e.Use(l.Middleware)
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	e.GET("/search", ok)
+	e.GET("/healthz", ok)
+
+	serve := func(target, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := serve("/search", "10.0.0.1"); rec.Code != http.StatusOK {
+		t.Fatalf("got status %d for the first request, but expected %d", rec.Code, http.StatusOK)
+	}
+	rec := serve("/search", "10.0.0.1")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("got status %d for the second request, but expected %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("got Retry-After %q, but expected %q", got, "1")
+	}
+	if rec := serve("/search", "10.0.0.2"); rec.Code != http.StatusOK {
+		t.Errorf("got status %d for another client, but expected %d", rec.Code, http.StatusOK)
+	}
+	if rec := serve("/healthz", "10.0.0.1"); rec.Code != http.StatusOK {
+		t.Errorf("got status %d for a skipped request, but expected %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestRateLimiterMaxClients(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := NewRateLimiter(1, 5)
+	l.now = func() time.Time { return now }
+	l.maxClients = 2
+	for _, client := range []string{"a", "b", "a", "c"} {
+		now = now.Add(time.Millisecond)
+		l.Allow(client)
+	}
+	if len(l.buckets) != 2 {
+		t.Errorf("got %d buckets, but expected at most 2", len(l.buckets))
+	}
+	if _, ok := l.buckets["b"]; ok {
+		t.Error("the least recently seen client wasn't forgotten")
+	}
+}
+
+func TestRateLimiterClientIP(t *testing.T) {
+	l := NewRateLimiter(1, 1)
+	if err := l.TrustProxies("10.0.0.0/8, 192.168.1.1"); err != nil {
+		t.Fatalf("TrustProxies got unexpected error: %v", err)
+	}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		realIP     string
+		want       string
+	}{
+		{name: "direct", remoteAddr: "203.0.113.1:1234", want: "203.0.113.1"},
+		{name: "spoofed from an untrusted client", remoteAddr: "203.0.113.1:1234", xff: "198.51.100.7", realIP: "198.51.100.8", want: "203.0.113.1"},
+		{name: "through a trusted proxy", remoteAddr: "10.1.2.3:1234", xff: "198.51.100.7", want: "198.51.100.7"},
+		{name: "spoofed through a trusted proxy", remoteAddr: "10.1.2.3:1234", xff: "1.2.3.4, 198.51.100.7", want: "198.51.100.7"},
+		{name: "through two trusted proxies", remoteAddr: "10.1.2.3:1234", xff: "198.51.100.7, 192.168.1.1", want: "198.51.100.7"},
+		{name: "real ip from a trusted proxy", remoteAddr: "192.168.1.1:1234", realIP: "198.51.100.8", want: "198.51.100.8"},
+		{name: "trusted proxy without headers", remoteAddr: "10.1.2.3:1234", want: "10.1.2.3"},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+			if tc.xff != "" {
+				req.Header.Set(echo.HeaderXForwardedFor, tc.xff)
+			}
+			if tc.realIP != "" {
+				req.Header.Set(echo.HeaderXRealIP, tc.realIP)
+			}
+			if got := l.clientIP(req); got != tc.want {
+				t.Errorf("clientIP got %q, but expected %q", got, tc.want)
+			}
+		})
+	}
+	if err := l.TrustProxies("10.0.0.0/33"); err == nil {
+		t.Error("TrustProxies with an invalid CIDR expected an error, but got nil")
+	}
+}
+
+func TestQueryLimits(t *testing.T) {
+	limits := query.Limits{MaxNodes: 5}
+	e := echo.New()
+	e.Use(QueryLimits(limits))
+	var got interface{}
+	e.GET("/", func(c echo.Context) error {
+		got = c.Get(QueryLimitsContextKey)
+		return nil
+	})
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if got != limits {
+		t.Errorf("got limits %v in the context, but expected %v", got, limits)
+	}
+}
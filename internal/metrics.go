@@ -0,0 +1,175 @@
+package internal
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/awbraunstein/setlist-search/index"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// MetricsContextKey is the key used to lookup the Metrics from the
+// echo.Context.
+const MetricsContextKey = "metrics-context-key"
+
+// Metrics collects Prometheus metrics about the server. Each Metrics has its
+// own registry, so it can be scraped in tests without global state.
+type Metrics struct {
+	reg       *prometheus.Registry
+	requests  *prometheus.CounterVec
+	latency   *prometheus.HistogramVec
+	queryTime prometheus.Histogram
+	reloads   *prometheus.CounterVec
+
+	routesOnce sync.Once
+	routes     map[string]bool
+}
+
+// NewMetrics returns a Metrics with the request, query and reload metrics,
+// and the Go runtime and process collectors.
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		reg: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "setlist_http_requests_total",
+			Help: "Number of HTTP requests by method, route and status code.",
+		}, []string{"method", "route", "code"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "setlist_http_request_duration_seconds",
+			Help:    "Latency of HTTP requests by method and route.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		queryTime: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "setlist_query_duration_seconds",
+			Help:    "Time spent parsing and evaluating search queries.",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 4, 8),
+		}),
+		reloads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "setlist_index_reloads_total",
+			Help: "Number of attempts to reload the index by result.",
+		}, []string{"result"}),
+	}
+	// Report both results from the start, so that rates work before the
+	// first failure.
+	m.reloads.WithLabelValues("success")
+	m.reloads.WithLabelValues("failure")
+	m.reg.MustRegister(
+		m.requests,
+		m.latency,
+		m.queryTime,
+		m.reloads,
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// RegisterCache adds metrics describing the use of a query cache.
+func (m *Metrics) RegisterCache(cache *index.Cache) {
+	counter := func(name, help string, value func(index.CacheStats) float64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{Name: name, Help: help},
+			func() float64 { return value(cache.Stats()) })
+	}
+	gauge := func(name, help string, value func(index.CacheStats) float64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help},
+			func() float64 { return value(cache.Stats()) })
+	}
+	m.reg.MustRegister(
+		counter("setlist_query_cache_hits_total", "Number of queries answered by the cache.",
+			func(s index.CacheStats) float64 { return float64(s.Hits) }),
+		counter("setlist_query_cache_misses_total", "Number of queries not found in the cache.",
+			func(s index.CacheStats) float64 { return float64(s.Misses) }),
+		counter("setlist_query_cache_evictions_total", "Number of results evicted from the cache.",
+			func(s index.CacheStats) float64 { return float64(s.Evictions) }),
+		gauge("setlist_query_cache_entries", "Number of results in the cache.",
+			func(s index.CacheStats) float64 { return float64(s.Entries) }),
+		gauge("setlist_query_cache_bytes", "Approximate size of the results in the cache.",
+			func(s index.CacheStats) float64 { return float64(s.Bytes) }),
+	)
+}
+
+// RegisterInjector adds metrics describing the index injected by s, and
+// makes s count its reloads.
+func (m *Metrics) RegisterInjector(s *IndexInjector) {
+	s.mu.Lock()
+	s.metrics = m
+	s.mu.Unlock()
+	gauge := func(name, help string, value func(*index.Index) float64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help},
+			func() float64 { return value(s.Index()) })
+	}
+	m.reg.MustRegister(
+		gauge("setlist_index_shows", "Number of shows in the index.",
+			func(idx *index.Index) float64 { return float64(idx.NumShows()) }),
+		gauge("setlist_index_songs", "Number of songs in the index.",
+			func(idx *index.Index) float64 { return float64(idx.NumSongs()) }),
+		gauge("setlist_index_generation", "Generation of the index.",
+			func(idx *index.Index) float64 { return float64(idx.Generation()) }),
+		gauge("setlist_index_age_seconds", "Time since the index was last modified.",
+			func(idx *index.Index) float64 { return time.Since(idx.ModTime()).Seconds() }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "setlist_index_loaded_timestamp_seconds",
+			Help: "Unix time at which the index was loaded.",
+		}, func() float64 { return float64(s.Loaded().UnixNano()) / 1e9 }),
+	)
+}
+
+// ObserveQuery records the time it took to evaluate a query.
+func (m *Metrics) ObserveQuery(d time.Duration) {
+	m.queryTime.Observe(d.Seconds())
+}
+
+// countReload records the result of reloading the index. It's safe to call on
+// a nil Metrics.
+func (m *Metrics) countReload(err error) {
+	if m == nil {
+		return
+	}
+	if err != nil {
+		m.reloads.WithLabelValues("failure").Inc()
+	} else {
+		m.reloads.WithLabelValues("success").Inc()
+	}
+}
+
+// Middleware counts requests and their latency by route, and injects the
+// Metrics into the context.
+func (m *Metrics) Middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Set(MetricsContextKey, m)
+		start := time.Now()
+		if err := next(c); err != nil {
+			// Handle the error here so that its status is recorded.
+			c.Error(err)
+		}
+		route := m.route(c)
+		method := c.Request().Method
+		code := strconv.Itoa(c.Response().Status)
+		m.requests.WithLabelValues(method, route, code).Inc()
+		m.latency.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+		return nil
+	}
+}
+
+// route returns the route that matched the request. Requests that didn't
+// match a route share a label, so that arbitrary paths can't create new series.
+func (m *Metrics) route(c echo.Context) string {
+	m.routesOnce.Do(func() {
+		m.routes = make(map[string]bool)
+		for _, r := range c.Echo().Routes() {
+			m.routes[r.Path] = true
+		}
+	})
+	if !m.routes[c.Path()] {
+		return "unmatched"
+	}
+	return c.Path()
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.HandlerFor(m.reg, promhttp.HandlerOpts{}))
+}
@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/awbraunstein/setlist-search/index"
+	"github.com/labstack/echo/v4"
+)
+
+// scrape returns the metrics served by m.
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	e := echo.New()
+	e.GET("/metrics", m.Handler())
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d scraping metrics", rec.Code)
+	}
+	body, err := ioutil.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatalf("unable to read metrics: %v", err)
+	}
+	return string(body)
+}
+
+func TestMetrics(t *testing.T) {
+	idx, _, err := index.ReadWithOptions(strings.NewReader(testIndex), index.ReadOptions{
+		ModTime: time.Now().Add(-time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("unable to read index; %v", err)
+	}
+	s := &IndexInjector{idx: idx, loaded: time.Now()}
+	cache := index.NewCache(1 << 20)
+	s.UseCache(cache)
+	m := NewMetrics()
+	m.RegisterInjector(s)
+	m.RegisterCache(cache)
+
+	e := echo.New()
+	e.Use(m.Middleware)
+	e.GET("/search", func(c echo.Context) error {
+		m.ObserveQuery(time.Millisecond)
+		return c.String(http.StatusOK, "ok")
+	})
+	e.GET("/broken/:id", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusBadRequest)
+	})
+	for _, target := range []string{"/search", "/search", "/broken/1", "/nope"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := cache.Query(context.Background(), idx, "fee"); err != nil {
+			t.Fatalf("Query got unexpected error: %v", err)
+		}
+	}
+	m.countReload(nil)
+	m.countReload(errors.New("boom"))
+	m.countReload(errors.New("boom"))
+
+	got := scrape(t, m)
+	for _, want := range []string{
+		`setlist_http_requests_total{code="200",method="GET",route="/search"} 2`,
+		`setlist_http_requests_total{code="400",method="GET",route="/broken/:id"} 1`,
+		`setlist_http_requests_total{code="404",method="GET",route="unmatched"} 1`,
+		`setlist_http_request_duration_seconds_count{method="GET",route="/search"} 2`,
+		`setlist_query_duration_seconds_count 2`,
+		`setlist_query_cache_hits_total 1`,
+		`setlist_query_cache_misses_total 1`,
+		`setlist_query_cache_entries 1`,
+		`setlist_index_shows 1`,
+		`setlist_index_songs 0`,
+		`setlist_index_reloads_total{result="success"} 1`,
+		`setlist_index_reloads_total{result="failure"} 2`,
+		`setlist_index_age_seconds 3`,
+		`go_goroutines `,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("metrics don't contain %q", want)
+		}
+	}
+}
@@ -4,28 +4,28 @@ import (
 	"context"
 	"flag"
 	"io"
+	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 	"text/template"
+	"time"
 
 	echotrace "github.com/awbraunstein/echo-trace"
+	"github.com/awbraunstein/setlist-search/config"
 	"github.com/awbraunstein/setlist-search/handlers"
+	"github.com/awbraunstein/setlist-search/index"
 	"github.com/awbraunstein/setlist-search/internal"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
-var (
-	httpAddr    = flag.String("http", ":8080", "Listen address")
-	remoteIndex = flag.Bool("remote_index", true, "Whether the index should be fetched from the remote source")
-)
-
-func getIndexLocation() string {
-	if indexLocation := os.Getenv("SETSEARCHERINDEX"); indexLocation != "" {
-		return indexLocation
-	}
-	return filepath.Clean(os.Getenv("HOME") + "/.setsearcherindex")
-}
+// subscriptionCleanupTimeout is how long the index subscription has to be
+// deleted on shutdown. It's separate from the time given to in-flight requests,
+// so that slow requests can't leak the subscription.
+const subscriptionCleanupTimeout = 10 * time.Second
 
 type Template struct {
 	templates map[string]*template.Template
@@ -35,7 +35,9 @@ func (t *Template) Render(w io.Writer, name string, data interface{}, c echo.Con
 	return t.templates[name].ExecuteTemplate(w, "base", data)
 }
 
-func parseTemplates() *Template {
+// parseTemplates parses each page with the library templates. The analytics
+// func reports whether pages should include analytics.
+func parseTemplates(analytics bool) *Template {
 	libs, err := filepath.Glob("templates/library/*.tmpl")
 	if err != nil {
 		panic(err.Error())
@@ -44,48 +46,124 @@ func parseTemplates() *Template {
 	if err != nil {
 		panic(err.Error())
 	}
+	funcs := template.FuncMap{
+		"analytics": func() bool { return analytics },
+	}
 	t := &Template{templates: make(map[string]*template.Template)}
 	for _, fname := range tmpls {
 		command := filepath.Base(fname)
-		t.templates[command] = template.Must(template.ParseFiles(append([]string{fname}, libs...)...))
+		t.templates[command] = template.Must(template.New(command).Funcs(funcs).ParseFiles(append([]string{fname}, libs...)...))
 	}
 	return t
 }
 
 // This is the entrypoint into the setlist server.
 func main() {
-	flag.Parse()
+	cfg := config.Default()
+	cfg.RegisterServerFlags(flag.CommandLine)
+	if err := config.Load(flag.CommandLine, os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Effective config:\n%s", config.Effective(flag.CommandLine))
+
 	e := echo.New()
-	e.Renderer = parseTemplates()
+	e.Renderer = parseTemplates(cfg.Analytics)
+	e.HTTPErrorHandler = handlers.HTTPErrorHandler
+	e.Server.ReadTimeout = cfg.ReadTimeout
+	e.Server.WriteTimeout = cfg.WriteTimeout
 
+	metrics := internal.NewMetrics()
+	// Count requests outside of Recover so that panics are counted as errors.
+	e.Use(metrics.Middleware)
 	e.Use(middleware.Recover())
 	e.Use(middleware.Logger())
 	e.Use(middleware.Gzip())
 	e.Use(echotrace.Middleware)
+	if cfg.RateLimit > 0 {
+		limiter := internal.NewRateLimiter(cfg.RateLimit, cfg.RateLimitBurst)
+		if err := limiter.TrustProxies(cfg.TrustedProxies); err != nil {
+			log.Fatal(err)
+		}
+		// Don't limit probes, scrapes and assets.
+		limiter.Skipper = func(c echo.Context) bool {
+			switch c.Path() {
+			case "/healthz", "/readyz", "/metrics", "/static/*":
+				return true
+			}
+			return false
+		}
+		e.Use(limiter.Middleware)
+	}
+	if cfg.RequestTimeout > 0 {
+		e.Use(internal.Timeout(cfg.RequestTimeout))
+	}
+	e.Use(internal.QueryLimits(cfg.QueryLimits))
 	var injector *internal.IndexInjector
 	var err error
-	if *remoteIndex {
-		injector, err = internal.NewCloudInjector(context.Background(), "setlist-searcher-index", "index.txt", "setlist-searcher", "indexer")
+	if cfg.Index.Remote {
+		injector, err = internal.NewCloudInjector(context.Background(), cfg.Index.Bucket, cfg.Index.Object, cfg.Index.Project, cfg.Index.Topic)
 	} else {
-		injector, err = internal.NewInjector(getIndexLocation())
+		injector, err = internal.NewInjector(cfg.Index.Path)
 	}
 	if err != nil {
 		e.Logger.Fatal(err)
 	}
+	metrics.RegisterInjector(injector)
+	if cfg.QueryCacheBytes > 0 {
+		cache := index.NewCache(cfg.QueryCacheBytes)
+		injector.UseCache(cache)
+		metrics.RegisterCache(cache)
+	}
 	e.Use(injector.Middleware)
 
 	e.GET("/", handlers.Home)
 	e.GET("/search", handlers.Search)
+	e.GET("/show/:id", handlers.Show)
 
 	// Accept /api/search on GET and POST.
 	e.GET("/api/search", handlers.SearchAPI)
 	e.POST("/api/search", handlers.SearchAPI)
+	e.GET("/api/v2/search", handlers.SearchAPIV2)
+	e.POST("/api/v2/search", handlers.SearchAPIV2)
 
 	// Accept /api/search on GET.
 	e.GET("/api/searchboxconfig", handlers.SearchBoxConfigAPI)
+	e.GET("/api/suggest", handlers.SuggestAPI)
+
+	e.GET("/api/shows/:id", handlers.ShowAPI)
+
+	e.GET("/api/songs/:song", handlers.SongStatsAPI)
+	e.GET("/api/songs/:song/neighbors", handlers.SongNeighborsAPI)
+	e.GET("/api/songs/:song/transitions", handlers.SongTransitionsAPI)
 
 	e.GET("/debug/requests", echotrace.Handler)
+	e.GET("/debug/querycache", handlers.QueryCacheStats)
+	e.GET("/metrics", metrics.Handler())
+	e.GET("/healthz", handlers.Healthz)
+	e.GET("/readyz", handlers.Readyz(injector.Status, cfg.MaxIndexAge))
 
 	e.Static("/static", "assets")
-	e.Logger.Fatal(e.Start(*httpAddr))
+
+	go func() {
+		if err := e.Start(cfg.Addr); err != nil && err != http.ErrServerClosed {
+			e.Logger.Fatal(err)
+		}
+	}()
+
+	// Wait for Kubernetes to ask us to stop, then drain in-flight requests
+	// and clean up the index subscription.
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGTERM, os.Interrupt)
+	<-quit
+	e.Logger.Print("Shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		e.Logger.Error(err)
+	}
+	closeCtx, closeCancel := context.WithTimeout(context.Background(), subscriptionCleanupTimeout)
+	defer closeCancel()
+	if err := injector.Close(closeCtx); err != nil {
+		e.Logger.Error(err)
+	}
 }
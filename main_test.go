@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/awbraunstein/setlist-search/handlers"
+)
+
+func TestShowTemplate(t *testing.T) {
+	sd := &handlers.ShowDetails{
+		Id:    1,
+		Date:  "1997-11-22",
+		Url:   `http://phish.net/1" onclick="alert(1)`,
+		Venue: "<script>alert(1)</script>",
+		Tour:  "Fall & Winter",
+		Sets: []handlers.ShowSet{{
+			Name:  "1",
+			Label: "Set 1",
+			Songs: []handlers.ShowSong{{Song: "fee", Name: "<b>Fee</b>", StatsUrl: "/api/songs/fee"}},
+		}},
+	}
+	var b bytes.Buffer
+	if err := parseTemplates(false).Render(&b, "show.tmpl", sd, nil); err != nil {
+		t.Fatalf("unable to render show.tmpl; %v", err)
+	}
+	got := b.String()
+	for _, want := range []string{
+		`<a href="/api/songs/fee" class="song-stats">stats</a>`,
+		`<a href="/search?query=%22fee%22" class="song">&lt;b&gt;Fee&lt;/b&gt;</a>`,
+		`&lt;script&gt;alert(1)&lt;/script&gt;`,
+		`Fall &amp; Winter`,
+		`<a href="http://phish.net/1&#34; onclick=&#34;alert(1)">`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("show.tmpl doesn't contain %s:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "<script>alert") {
+		t.Errorf("show.tmpl doesn't escape the venue:\n%s", got)
+	}
+}
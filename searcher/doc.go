@@ -23,19 +23,41 @@ Repetitions:
 Grouping:
  (?:x)          non-capturing group
 
+Connectors:
+ x,y            x followed by y with a full stop in between
+ x>y            x transitions directly into y
+ x->y           x segues into y
+
+Connectors constrain the edge between the song before and the song after them,
+and never match across the end of a set.
+
 Empty Songs:
  ^              at begining of show
  $              at end of show
- \S{SetNum}     at begining of set SetNum (SetNum = e for encore)
- \E{SetNum}     at end of set SetNum (SetNum = e for encore)
+ \S{SetNum}     at begining of set SetNum (SetNum = e or e2 for encores)
+ \E{SetNum}     at end of set SetNum (SetNum = e or e2 for encores)
+
+Soundchecks are not part of the show, so they are never matched.
 
 
 Setlists
 
 The searcher will analyze setlists that are stored in the following format and separated by newlines.
-Note that songs must not have , or {} characters in them.
  ID{showid}SET1{song1,song2,song3,song4}SET2{songa,songb,songc,songd}ENCORE{songx,songy,songz}
 
+A show may have several encores, written as ENCORE{...}ENCORE2{...}, and
+soundchecks, written as SOUNDCHECK{...}.
+
+Songs within a set are separated by their connector: "," for a full stop, ">"
+for a transition and "->" for a segue.
+ ID{showid}SET1{song1,song2->song3>song4}
+
+Any character in a value may be escaped with a backslash, and \n and \r stand
+for a newline and a carriage return. Setlists are written with {, }, \,
+newlines, carriage returns, the connectors and a song's trailing - escaped,
+so that any string round-trips.
+ ID{showid}SET1{song1,a song\, with a comma->song3}
+
 
 Examples
 
@@ -52,5 +74,11 @@ Matches a show where Mike's song is played in set1 and Weekapaug is played in se
 Matches a show that had Tweezer Reprise that wasn't played in the encore.
  (Tweezer Reprise)\S{e}[^(Tweezer Reprise)]*\E{e}
 
+Matches a show where Mike's Song segued directly into Simple.
+ (Mike's Song)->(Simple)
+
+Matches a show where Mike's Song came to a full stop before the next song.
+ (Mike's Song),
+
 */
 package searcher
@@ -0,0 +1,238 @@
+package searcher
+
+// instOp is the kind of an instruction in a compiled program.
+type instOp int
+
+const (
+	instSong      instOp = iota // consume a song equal to song
+	instAnySong                 // consume any song
+	instClass                   // consume a song in (or not in) class
+	instBeginShow               // assert at the beginning of the show
+	instEndShow                 // assert at the end of the show
+	instBeginSet                // assert at the beginning of set
+	instEndSet                  // assert at the end of set
+	instConnector               // assert the previous and next song are joined by conn
+	instSplit                   // try out, then arg
+	instJump                    // continue at out
+	instMatch                   // the program matched
+)
+
+// inst is a single instruction in a compiled program.
+type inst struct {
+	op     instOp
+	out    int
+	arg    int             // instSplit
+	song   string          // instSong
+	class  map[string]bool // instClass
+	negate bool            // instClass
+	set    string          // instBeginSet, instEndSet
+	conn   Connector       // instConnector
+}
+
+// prog is a compiled search expression. Songs are instructions that consume
+// a single song of the show, and connectors are instructions that constrain
+// the edge between the song before and the song after them.
+type prog struct {
+	inst []inst
+}
+
+// compile compiles a parsed search expression into a program.
+func compile(n *node) *prog {
+	p := &prog{}
+	p.compile(n)
+	p.emit(inst{op: instMatch})
+	return p
+}
+
+// emit appends an instruction whose out is the next instruction and returns
+// its pc.
+func (p *prog) emit(i inst) int {
+	pc := len(p.inst)
+	i.out = pc + 1
+	p.inst = append(p.inst, i)
+	return pc
+}
+
+func (p *prog) compile(n *node) {
+	switch n.op {
+	case opSong:
+		p.emit(inst{op: instSong, song: n.song})
+	case opAnySong:
+		p.emit(inst{op: instAnySong})
+	case opClass:
+		p.emit(inst{op: instClass, class: n.class, negate: n.negate})
+	case opBeginShow:
+		p.emit(inst{op: instBeginShow})
+	case opEndShow:
+		p.emit(inst{op: instEndShow})
+	case opBeginSet:
+		p.emit(inst{op: instBeginSet, set: n.set})
+	case opEndSet:
+		p.emit(inst{op: instEndSet, set: n.set})
+	case opConnector:
+		p.emit(inst{op: instConnector, conn: n.conn})
+	case opConcat:
+		for _, sub := range n.sub {
+			p.compile(sub)
+		}
+	case opAlternate:
+		// L0: split L1, L2; L1: x; jump end; L2: split ...; Ln: z; end:
+		var jumps []int
+		for i, sub := range n.sub {
+			if i == len(n.sub)-1 {
+				p.compile(sub)
+				break
+			}
+			split := p.emit(inst{op: instSplit})
+			p.compile(sub)
+			jumps = append(jumps, p.emit(inst{op: instJump}))
+			p.inst[split].arg = len(p.inst)
+		}
+		for _, pc := range jumps {
+			p.inst[pc].out = len(p.inst)
+		}
+	case opStar:
+		// L0: split L1, end; L1: x; jump L0; end:
+		split := p.emit(inst{op: instSplit})
+		p.compile(n.sub[0])
+		jump := p.emit(inst{op: instJump})
+		p.inst[jump].out = split
+		p.inst[split].arg = len(p.inst)
+	case opPlus:
+		// L0: x; split L0, end; end:
+		start := len(p.inst)
+		p.compile(n.sub[0])
+		split := p.emit(inst{op: instSplit})
+		p.inst[split].out = start
+		p.inst[split].arg = len(p.inst)
+	case opQuest:
+		// split L1, end; L1: x; end:
+		split := p.emit(inst{op: instSplit})
+		p.compile(n.sub[0])
+		p.inst[split].arg = len(p.inst)
+	case opEmpty:
+	}
+}
+
+// setBoundary marks an edge between two songs in different sets.
+const setBoundary Connector = -1
+
+// input is a setlist flattened into the sequence of songs a program runs
+// over. Positions are between songs: position i is just before songs[i].
+type input struct {
+	songs []string
+	// edges[i] is the connector between songs[i-1] and songs[i].
+	edges []Connector
+	// setStart and setEnd map a set number to its first and last position.
+	setStart map[string]int
+	setEnd   map[string]int
+}
+
+func newInput(sl *Setlist) *input {
+	in := &input{
+		setStart: make(map[string]int),
+		setEnd:   make(map[string]int),
+	}
+	for _, s := range sl.Sets {
+		if s.Kind == SoundcheckSet {
+			continue
+		}
+		start := len(in.songs)
+		for i, song := range s.Songs {
+			if i == 0 {
+				in.edges = append(in.edges, setBoundary)
+			} else {
+				in.edges = append(in.edges, s.ConnectorAfter(i-1))
+			}
+			in.songs = append(in.songs, song)
+		}
+		name := s.Name()
+		in.setStart[name], in.setEnd[name] = start, len(in.songs)
+		if name == "e" {
+			// The first encore may be called either e or e1.
+			in.setStart["e1"], in.setEnd["e1"] = start, len(in.songs)
+		}
+	}
+	in.edges = append(in.edges, setBoundary)
+	return in
+}
+
+// match reports whether the program matches anywhere in the input.
+func (p *prog) match(in *input) bool {
+	b := &backtracker{prog: p, in: in, visited: make([]bool, len(p.inst)*(len(in.songs)+1))}
+	for pos := 0; pos <= len(in.songs); pos++ {
+		if b.try(0, pos) {
+			return true
+		}
+	}
+	return false
+}
+
+// backtracker runs a program over an input. Since programs have no captures,
+// a (pc, pos) pair that has been tried before can never lead to a new match,
+// so each pair is visited at most once.
+type backtracker struct {
+	prog    *prog
+	in      *input
+	visited []bool
+}
+
+func (b *backtracker) try(pc, pos int) bool {
+	for {
+		key := pc*(len(b.in.songs)+1) + pos
+		if b.visited[key] {
+			return false
+		}
+		b.visited[key] = true
+
+		i := &b.prog.inst[pc]
+		switch i.op {
+		case instMatch:
+			return true
+		case instSong, instAnySong, instClass:
+			if pos >= len(b.in.songs) {
+				return false
+			}
+			song := b.in.songs[pos]
+			switch i.op {
+			case instSong:
+				if song != i.song {
+					return false
+				}
+			case instClass:
+				if i.class[song] == i.negate {
+					return false
+				}
+			}
+			pos++
+		case instBeginShow:
+			if pos != 0 {
+				return false
+			}
+		case instEndShow:
+			if pos != len(b.in.songs) {
+				return false
+			}
+		case instBeginSet:
+			if start, ok := b.in.setStart[i.set]; !ok || start != pos {
+				return false
+			}
+		case instEndSet:
+			if end, ok := b.in.setEnd[i.set]; !ok || end != pos {
+				return false
+			}
+		case instConnector:
+			if b.in.edges[pos] != i.conn {
+				return false
+			}
+		case instSplit:
+			if b.try(i.out, pos) {
+				return true
+			}
+			pc = i.arg
+			continue
+		case instJump:
+		}
+		pc = i.out
+	}
+}
@@ -2,19 +2,26 @@ package searcher
 
 import (
 	"strconv"
+	"strings"
 )
 
 // Searcher is the result of a compiled query. A Searcher is safe for concurrent
 // use by multiple goroutines.
 type Searcher struct {
 	expr string // as passed to Compile
+	prog *prog  // compiled program
 }
 
 // Compile parses a searcher query and returns, if successful, a Searcher that
 // can be used to match against setlists.
 func Compile(expr string) (*Searcher, error) {
+	n, err := parse(expr)
+	if err != nil {
+		return nil, err
+	}
 	searcher := &Searcher{
 		expr: expr,
+		prog: compile(n),
 	}
 	return searcher, nil
 }
@@ -37,7 +44,29 @@ func quote(s string) string {
 	return strconv.Quote(s)
 }
 
+// String returns the source text used to compile the searcher.
+func (s *Searcher) String() string {
+	return s.expr
+}
+
+// Match reports whether the setlist contains any match of the searcher.
+func (s *Searcher) Match(sl *Setlist) bool {
+	return s.prog.match(newInput(sl))
+}
+
 // FindShows looks through the list of shows and returns the matching show ids.
+// Shows are separated by newlines and stored in the setlist serialization
+// format. Shows that cannot be parsed are skipped.
 func (s *Searcher) FindShows(shows string) []string {
-	return nil
+	var ids []string
+	for _, line := range strings.Split(shows, "\n") {
+		sl, err := ParseSetlist(line)
+		if err != nil {
+			continue
+		}
+		if s.Match(sl) {
+			ids = append(ids, strconv.Itoa(sl.ShowId))
+		}
+	}
+	return ids
 }
@@ -0,0 +1,115 @@
+package searcher
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompileErrors(t *testing.T) {
+	for _, expr := range []string{
+		"(mikes-song",
+		"(?:(mikes-song)",
+		"[(mikes-song)",
+		"[]",
+		"[mikes-song]",
+		"*",
+		"(mikes-song)-",
+		`\S{1`,
+		`\X{1}`,
+		"()",
+		"(a))",
+	} {
+		if _, err := Compile(expr); err == nil {
+			t.Errorf("Compile(%q) expected an error, but got nil", expr)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	sl, err := ParseSetlist("ID{1}DATE{1998-07-10}URL{http://phish.net}SET1{down-with-disease,dogs-stole-things,divided-sky}SET2{halleys-comet>roggae,mikes-song->simple->weekapaug-groove,sample-in-a-jar}ENCORE{brian-and-robert,taste}")
+	if err != nil {
+		t.Fatalf("Unable to parse setlist; %v", err)
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{expr: "(mikes-song)", want: true},
+		{expr: "(Mike's Song)", want: true},
+		{expr: "(tweezer)", want: false},
+		{expr: "(mikes-song).(weekapaug-groove)", want: true},
+		{expr: "(mikes-song)(weekapaug-groove)", want: false},
+		{expr: "(mikes-song).*(taste)", want: true},
+		{expr: "(taste).*(mikes-song)", want: false},
+		{expr: "(tweezer)|(simple)", want: true},
+		{expr: "(mikes-song)(?:(simple)|(tweezer))", want: true},
+		{expr: "(mikes-song)[(simple)(tweezer)]", want: true},
+		{expr: "(mikes-song)[^(simple)(tweezer)]", want: false},
+		{expr: "(mikes-song)(tweezer)?(simple)", want: true},
+		{expr: "(mikes-song)(tweezer)+(simple)", want: false},
+		{expr: "^(down-with-disease)", want: true},
+		{expr: "^(divided-sky)", want: false},
+		{expr: "(taste)$", want: true},
+		{expr: `\S{1}.*(divided-sky)\E{1}\S{2}.*(sample-in-a-jar)\E{2}`, want: true},
+		{expr: `\S{e}(brian-and-robert)`, want: true},
+		{expr: `\S{3}`, want: false},
+		{expr: `\S{e1}(brian-and-robert)(taste)\E{e1}`, want: true},
+		{expr: `\S{e2}`, want: false},
+		{expr: `(mikes-song).*\S{e}[^(mikes-song)]*\E{e}`, want: true},
+		{expr: "(mikes-song)->(simple)", want: true},
+		{expr: "(mikes-song)>(simple)", want: false},
+		{expr: "(mikes-song),(simple)", want: false},
+		{expr: "(halleys-comet)>(roggae)", want: true},
+		{expr: "(roggae),(mikes-song)", want: true},
+		{expr: "(mikes-song)->.->(weekapaug-groove)", want: true},
+		{expr: "(?:.->)+(weekapaug-groove)", want: true},
+		{expr: "(divided-sky),", want: false},
+		{expr: "(divided-sky).", want: true},
+		{expr: "(?:^)*(down-with-disease)", want: true},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.expr, func(t *testing.T) {
+			s, err := Compile(tc.expr)
+			if err != nil {
+				t.Fatalf("Compile(%q) got unexpected error: %v", tc.expr, err)
+			}
+			if got := s.Match(sl); got != tc.want {
+				t.Errorf("Match(%q) = %v, but expected %v", tc.expr, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMatchMultipleEncores(t *testing.T) {
+	sl, err := ParseSetlist("ID{1}DATE{1998-07-10}URL{http://phish.net}SOUNDCHECK{tweezer}SET1{fee}ENCORE{tube}ENCORE2{possum}")
+	if err != nil {
+		t.Fatalf("Unable to parse setlist; %v", err)
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{expr: `\S{e}(tube)\E{e}\S{e2}(possum)\E{e2}$`, want: true},
+		{expr: `(tube)(possum)`, want: true},
+		{expr: `(tweezer)`, want: false},
+		{expr: `\S{s}`, want: false},
+		{expr: `^(fee)`, want: true},
+	}
+	for _, tc := range tests {
+		if got := MustCompile(tc.expr).Match(sl); got != tc.want {
+			t.Errorf("Match(%q) = %v, but expected %v", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestFindShows(t *testing.T) {
+	shows := "ID{1}DATE{1998-07-10}URL{a}SET1{mikes-song->simple->weekapaug-groove}\n" +
+		"ID{2}DATE{1998-07-11}URL{b}SET1{mikes-song,simple,weekapaug-groove}\n" +
+		"ID{3}DATE{1998-07-12}URL{c}SET1{simple->mikes-song}"
+	s := MustCompile("(mikes-song)->(simple)")
+	if got, want := s.FindShows(shows), []string{"1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v\nexpected: %v", got, want)
+	}
+}
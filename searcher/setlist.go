@@ -2,7 +2,6 @@ package searcher
 
 import (
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
 	"unicode"
@@ -16,62 +15,461 @@ import (
 type Setlist struct {
 	ShowId int
 	Date   string
-	Sets   []*Set
-	Encore *Set
-	Url    string
+	// Sets holds every set of the show, including encores and soundchecks, in
+	// the order that they were played.
+	Sets []*Set
+	Url  string
+	// Venue, Location and Tour describe where the show was played and the tour
+	// that it was a part of. Any of them may be empty.
+	Venue    string
+	Location string
+	Tour     string
+	// Origin is where the setlist came from: OriginPhishNet, OriginOverride,
+	// or several origins joined by "+" when an override patched a scraped
+	// setlist. It's empty if it isn't known.
+	Origin string
 }
 
+// Origins of setlists.
+const (
+	// OriginPhishNet is a setlist scraped from phish.net.
+	OriginPhishNet = "phish.net"
+	// OriginOverride is a setlist that was added or patched by hand.
+	OriginOverride = "override"
+)
+
+// Overridden reports whether the setlist was added or patched by hand.
+func (s *Setlist) Overridden() bool {
+	for _, origin := range strings.Split(s.Origin, "+") {
+		if origin == OriginOverride {
+			return true
+		}
+	}
+	return false
+}
+
+// SetKind is the kind of a set within a show.
+type SetKind int
+
+const (
+	// RegularSet is a numbered set of the show.
+	RegularSet SetKind = iota
+	// EncoreSet is an encore.
+	EncoreSet
+	// SoundcheckSet is a soundcheck played before the show.
+	SoundcheckSet
+)
+
 // Set holds a single set of a setlist.
 type Set struct {
-	Songs []string
+	Kind SetKind
+	// Ordinal is the 1-based position of the set among the sets of the same
+	// kind, e.g. 2 for both "Set 2" and "Encore 2".
+	Ordinal int
+	Songs   []string
+	// Connectors holds how each song led into the next one. Connectors[i]
+	// joins Songs[i] and Songs[i+1].
+	Connectors []Connector
 }
 
-var (
-	idRe     = regexp.MustCompile(`^ID\{(\d+?)\}`)
-	dateRe   = regexp.MustCompile(`DATE\{(.+?)\}`)
-	urlRe    = regexp.MustCompile(`URL\{(.+?)\}`)
-	setRe    = regexp.MustCompile(`(?:SET\d+\{(.*?)\})`)
-	encoreRe = regexp.MustCompile(`(?:ENCORE\{(.*?)\})`)
+// Connector describes how one song is connected to the song that follows it.
+type Connector int
+
+const (
+	// Break is a full stop between two songs, written as ",".
+	Break Connector = iota
+	// Transition is a song that leads directly into the next one without
+	// stopping, written as ">".
+	Transition
+	// Segue is a song that is jammed into the next one, written as "->".
+	Segue
 )
 
+func (c Connector) String() string {
+	switch c {
+	case Transition:
+		return ">"
+	case Segue:
+		return "->"
+	}
+	return ","
+}
+
+// ParseConnector returns the connector written as s: ",", ">" or "->".
+func ParseConnector(s string) (Connector, error) {
+	switch s {
+	case ",":
+		return Break, nil
+	case ">":
+		return Transition, nil
+	case "->":
+		return Segue, nil
+	}
+	return Break, fmt.Errorf("ParseConnector: unknown connector %q", s)
+}
+
+// Name returns the short name of the set that is used by the \S{SetNum} and
+// \E{SetNum} anchors: "1", "2", ... for regular sets, "e", "e2", ... for encores
+// and "s", "s2", ... for soundchecks.
+func (s *Set) Name() string {
+	var prefix string
+	switch s.Kind {
+	case EncoreSet:
+		prefix = "e"
+	case SoundcheckSet:
+		prefix = "s"
+	default:
+		return strconv.Itoa(s.Ordinal)
+	}
+	if s.Ordinal <= 1 {
+		return prefix
+	}
+	return prefix + strconv.Itoa(s.Ordinal)
+}
+
+// ParseSetName returns an empty set for a short set name returned by Name,
+// such as "2", "e" or "s2".
+func ParseSetName(name string) (*Set, error) {
+	s := &Set{Ordinal: 1}
+	num := name
+	switch {
+	case strings.HasPrefix(name, "e"):
+		s.Kind = EncoreSet
+		num = name[1:]
+	case strings.HasPrefix(name, "s"):
+		s.Kind = SoundcheckSet
+		num = name[1:]
+	}
+	if num == "" && s.Kind != RegularSet {
+		return s, nil
+	}
+	ordinal, err := strconv.Atoi(num)
+	if err != nil || ordinal < 1 || strings.TrimLeft(num, "0123456789") != "" {
+		return nil, fmt.Errorf("ParseSetName: unknown set %q", name)
+	}
+	s.Ordinal = ordinal
+	return s, nil
+}
+
+// ParseSet parses a set from its short name, such as "2" or "e", and its songs
+// in the setlist serialization format, such as "song1,song2->song3".
+func ParseSet(name, songs string) (*Set, error) {
+	s, err := ParseSetName(name)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := parseSet(songs)
+	if err != nil {
+		return nil, err
+	}
+	s.Songs, s.Connectors = parsed.Songs, parsed.Connectors
+	return s, nil
+}
+
+// Label returns the human readable name of the set, e.g. "Set 2" or
+// "Encore".
+func (s *Set) Label() string {
+	var label string
+	switch s.Kind {
+	case EncoreSet:
+		label = "Encore"
+	case SoundcheckSet:
+		label = "Soundcheck"
+	default:
+		return "Set " + strconv.Itoa(s.Ordinal)
+	}
+	if s.Ordinal > 1 {
+		label += " " + strconv.Itoa(s.Ordinal)
+	}
+	return label
+}
+
+// tag returns the tag used for the set in the setlist serialization format.
+func (s *Set) tag() string {
+	var tag string
+	switch s.Kind {
+	case EncoreSet:
+		tag = "ENCORE"
+	case SoundcheckSet:
+		tag = "SOUNDCHECK"
+	default:
+		return "SET" + strconv.Itoa(s.Ordinal)
+	}
+	if s.Ordinal <= 1 {
+		return tag
+	}
+	return tag + strconv.Itoa(s.Ordinal)
+}
+
+// ConnectorAfter returns the connector that follows the ith song in the set.
+func (s *Set) ConnectorAfter(i int) Connector {
+	if i < len(s.Connectors) {
+		return s.Connectors[i]
+	}
+	return Break
+}
+
+// parseSet parses the songs and connectors of a serialized set such as
+// "song1,song2->song3>song4". Special characters within songs are escaped with
+// a backslash.
+func parseSet(data string) (*Set, error) {
+	s := &Set{}
+	if data == "" {
+		return s, nil
+	}
+	var song strings.Builder
+	for i := 0; i < len(data); i++ {
+		var c Connector
+		switch {
+		case data[i] == '\\':
+			i++
+			if i == len(data) {
+				return nil, fmt.Errorf("parseSet: trailing backslash in set: %s", data)
+			}
+			song.WriteByte(unescapeByte(data[i]))
+			continue
+		case data[i] == ',':
+			c = Break
+		case data[i] == '>':
+			c = Transition
+		case data[i] == '-' && i+1 < len(data) && data[i+1] == '>':
+			c = Segue
+			i++
+		default:
+			song.WriteByte(data[i])
+			continue
+		}
+		s.Songs = append(s.Songs, song.String())
+		s.Connectors = append(s.Connectors, c)
+		song.Reset()
+	}
+	s.Songs = append(s.Songs, song.String())
+	return s, nil
+}
+
+func (s *Set) String() string {
+	var b strings.Builder
+	for i, song := range s.Songs {
+		if i > 0 {
+			b.WriteString(s.ConnectorAfter(i - 1).String())
+		}
+		b.WriteString(escapeSong(song))
+	}
+	return b.String()
+}
+
+// escape escapes the characters that would otherwise end a value in the
+// setlist serialization format, along with newlines so that setlists can be
+// stored one per line.
+func escape(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		writeEscapedByte(&b, value[i], "")
+	}
+	return b.String()
+}
+
+// escapeSong is like escape, but also escapes the connectors that separate
+// songs. A trailing "-" is escaped so that it can't be read as part of a
+// following "->".
+func escapeSong(song string) string {
+	var b strings.Builder
+	for i := 0; i < len(song); i++ {
+		if i == len(song)-1 && song[i] == '-' {
+			b.WriteString(`\-`)
+			continue
+		}
+		writeEscapedByte(&b, song[i], ",>")
+	}
+	return b.String()
+}
+
+func writeEscapedByte(b *strings.Builder, c byte, special string) {
+	switch {
+	case c == '\n':
+		b.WriteString(`\n`)
+	case c == '\r':
+		b.WriteString(`\r`)
+	case c == '\\' || c == '{' || c == '}' || strings.IndexByte(special, c) >= 0:
+		b.WriteByte('\\')
+		b.WriteByte(c)
+	default:
+		b.WriteByte(c)
+	}
+}
+
+// unescapeByte returns the byte represented by the escape sequence \c.
+func unescapeByte(c byte) byte {
+	switch c {
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	}
+	return c
+}
+
+// unescape reverses escape.
+func unescape(value string) (string, error) {
+	if strings.IndexByte(value, '\\') < 0 {
+		return value, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			b.WriteByte(value[i])
+			continue
+		}
+		i++
+		if i == len(value) {
+			return "", fmt.Errorf("unescape: trailing backslash in %s", value)
+		}
+		b.WriteByte(unescapeByte(value[i]))
+	}
+	return b.String(), nil
+}
+
+// readTag reads a single TAG{value} starting at pos and returns the tag, the
+// still escaped value and the position after the closing brace.
+func readTag(setlist string, pos int) (tag, value string, next int, err error) {
+	open := strings.IndexByte(setlist[pos:], '{')
+	if open < 0 {
+		return "", "", 0, fmt.Errorf("ParseSetlist: expected TAG{...} at position %d in setlist: %s", pos, setlist)
+	}
+	tag = setlist[pos : pos+open]
+	for i := pos + open + 1; i < len(setlist); i++ {
+		switch setlist[i] {
+		case '\\':
+			i++
+		case '}':
+			return tag, setlist[pos+open+1 : i], i + 1, nil
+		}
+	}
+	return "", "", 0, fmt.Errorf("ParseSetlist: missing closing } for tag %s in setlist: %s", tag, setlist)
+}
+
+// parseSetTag returns an empty set for a set tag such as SET2, ENCORE or
+// ENCORE2.
+func parseSetTag(tag string) (*Set, error) {
+	s := &Set{Ordinal: 1}
+	var num string
+	switch {
+	case strings.HasPrefix(tag, "SOUNDCHECK"):
+		s.Kind = SoundcheckSet
+		num = tag[len("SOUNDCHECK"):]
+	case strings.HasPrefix(tag, "ENCORE"):
+		s.Kind = EncoreSet
+		num = tag[len("ENCORE"):]
+	case strings.HasPrefix(tag, "SET"):
+		num = tag[len("SET"):]
+		if num == "" {
+			return nil, fmt.Errorf("ParseSetlist: set is missing its number: %s", tag)
+		}
+	default:
+		return nil, fmt.Errorf("ParseSetlist: unknown tag %q", tag)
+	}
+	if num == "" {
+		return s, nil
+	}
+	for _, r := range num {
+		if !unicode.IsDigit(r) {
+			return nil, fmt.Errorf("ParseSetlist: unknown tag %q", tag)
+		}
+	}
+	ordinal, err := strconv.Atoi(num)
+	if err != nil || ordinal < 1 {
+		return nil, fmt.Errorf("ParseSetlist: couldn't parse set number %s", num)
+	}
+	s.Ordinal = ordinal
+	return s, nil
+}
+
 // ParseSetlist parses setlists that are of the form:
 //  ID{showid}SET1{song1,song2,song3,song4}SET2{songa,songb,songc,songd}ENCORE{songx,songy,songz}
+//
+// Songs within a set may be separated by "," (a break), ">" (a transition) or
+// "->" (a segue). Additional encores and soundchecks are written as
+// ENCORE2{...} and SOUNDCHECK{...}. The optional VENUE{...}, LOCATION{...}
+// and TOUR{...} tags describe the show, and ORIGIN{...} says where the setlist
+// came from. Any character may be escaped with a
+// backslash, and "\n" and "\r" stand for a newline and a carriage return.
 func ParseSetlist(setlist string) (*Setlist, error) {
-	idMatches := idRe.FindStringSubmatch(setlist)
-	if len(idMatches) != 2 {
-		return nil, fmt.Errorf("ParseSetlist: couldn't find ID tag at start of setlist: %s", setlist)
+	sl := &Setlist{}
+	var haveID, haveDate, haveURL bool
+	seen := make(map[string]bool)
+	for pos := 0; pos < len(setlist); {
+		tag, value, next, err := readTag(setlist, pos)
+		if err != nil {
+			return nil, err
+		}
+		pos = next
+		switch tag {
+		case "ID", "DATE", "URL", "VENUE", "LOCATION", "TOUR", "ORIGIN":
+			v, err := unescape(value)
+			if err != nil {
+				return nil, fmt.Errorf("ParseSetlist: %v", err)
+			}
+			switch tag {
+			case "ID":
+				if haveID {
+					return nil, fmt.Errorf("ParseSetlist: duplicate ID tag in setlist: %s", setlist)
+				}
+				if sl.ShowId, err = strconv.Atoi(v); err != nil {
+					return nil, fmt.Errorf("ParseSetlist: couldn't parse id into an int %s", v)
+				}
+				haveID = true
+			case "DATE":
+				if haveDate {
+					return nil, fmt.Errorf("ParseSetlist: duplicate DATE tag in setlist: %s", setlist)
+				}
+				sl.Date, haveDate = v, true
+			case "URL":
+				if haveURL {
+					return nil, fmt.Errorf("ParseSetlist: duplicate URL tag in setlist: %s", setlist)
+				}
+				sl.Url, haveURL = v, true
+			default:
+				// VENUE, LOCATION, TOUR and ORIGIN are optional.
+				if seen[tag] {
+					return nil, fmt.Errorf("ParseSetlist: duplicate %s tag in setlist: %s", tag, setlist)
+				}
+				switch tag {
+				case "VENUE":
+					sl.Venue = v
+				case "LOCATION":
+					sl.Location = v
+				case "TOUR":
+					sl.Tour = v
+				case "ORIGIN":
+					sl.Origin = v
+				}
+			}
+			seen[tag] = true
+		default:
+			s, err := parseSetTag(tag)
+			if err != nil {
+				return nil, err
+			}
+			songs, err := parseSet(value)
+			if err != nil {
+				return nil, err
+			}
+			s.Songs, s.Connectors = songs.Songs, songs.Connectors
+			sl.Sets = append(sl.Sets, s)
+		}
 	}
-	id, err := strconv.Atoi(idMatches[1])
-	if err != nil {
-		return nil, fmt.Errorf("ParseSetlist: couldn't parse id into an int %s", idMatches[1])
+	if !haveID {
+		return nil, fmt.Errorf("ParseSetlist: couldn't find ID tag in setlist: %s", setlist)
 	}
-	dateMatches := dateRe.FindStringSubmatch(setlist)
-	if len(dateMatches) != 2 {
+	if !haveDate {
 		return nil, fmt.Errorf("ParseSetlist: couldn't find DATE tag in setlist: %s", setlist)
 	}
-	urlMatches := urlRe.FindStringSubmatch(setlist)
-	if len(urlMatches) != 2 {
+	if !haveURL {
 		return nil, fmt.Errorf("ParseSetlist: couldn't find URL tag in setlist: %s", setlist)
 	}
-	sl := &Setlist{
-		ShowId: id,
-		Date:   dateMatches[1],
-		Url:    urlMatches[1],
-	}
-	setMatches := setRe.FindAllStringSubmatch(setlist, -1)
-	if len(setMatches) == 0 {
+	if len(sl.Sets) == 0 {
 		return nil, fmt.Errorf("ParseSetList: couldn't find any sets in the setlist: %s", setlist)
 	}
-	for _, match := range setMatches {
-		s := &Set{
-			Songs: strings.Split(match[1], ","),
-		}
-		sl.Sets = append(sl.Sets, s)
-	}
-	encoreMatches := encoreRe.FindStringSubmatch(setlist)
-	if len(encoreMatches) == 2 {
-		sl.Encore = &Set{Songs: strings.Split(encoreMatches[1], ",")}
-	}
 	return sl, nil
 }
 
@@ -83,7 +481,7 @@ func normalizeName(name string) string {
 			return unicode.ToLower(r)
 		}
 		switch r {
-		case '.', ',', ';', ':', '\'':
+		case '.', ',', ';', ':', '\'', '‘', '’':
 			return -1
 		case ' ':
 			return '-'
@@ -92,12 +490,39 @@ func normalizeName(name string) string {
 	}, name)
 }
 
+// htmlText returns the text content of an html fragment, such as the venue
+// link returned by phish.net.
+func htmlText(fragment string) (string, error) {
+	root, err := html.Parse(strings.NewReader(fragment))
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	return strings.Join(strings.Fields(b.String()), " "), nil
+}
+
 // Returns a setlist and the songset or an error if there were any.
 func ParseSetlistFromPhishNet(setlist *gophish.Setlist) (*Setlist, map[string]string, error) {
+	venue, err := htmlText(setlist.Venue)
+	if err != nil {
+		return nil, nil, err
+	}
 	sl := &Setlist{
-		ShowId: setlist.ShowId,
-		Date:   setlist.ShowDate,
-		Url:    setlist.Url,
+		ShowId:   setlist.ShowId,
+		Date:     setlist.ShowDate,
+		Url:      setlist.Url,
+		Venue:    venue,
+		Location: strings.TrimSpace(setlist.Location),
 	}
 	root, err := html.Parse(strings.NewReader(setlist.SetlistData))
 	if err != nil {
@@ -108,8 +533,19 @@ func ParseSetlistFromPhishNet(setlist *gophish.Setlist) (*Setlist, map[string]st
 
 	var getSongsErr error
 
+	// Songs are separated by text nodes containing ",", ">" or "->".
 	getSongs := func(n *html.Node, set *Set) {
+		next := Break
 		for current := n; current != nil; current = current.NextSibling {
+			if current.Type == html.TextNode {
+				switch {
+				case strings.Contains(current.Data, "->"):
+					next = Segue
+				case strings.Contains(current.Data, ">"):
+					next = Transition
+				}
+				continue
+			}
 			isSong := false
 			if current.DataAtom == atom.A {
 				for _, attr := range current.Attr {
@@ -141,6 +577,10 @@ func ParseSetlistFromPhishNet(setlist *gophish.Setlist) (*Setlist, map[string]st
 					getSongsErr = fmt.Errorf("Expected node %v to be a song node", current)
 					return
 				}
+				if len(set.Songs) > 0 {
+					set.Connectors = append(set.Connectors, next)
+				}
+				next = Break
 				set.Songs = append(set.Songs, name)
 				songSet[humanName] = name
 			}
@@ -162,16 +602,9 @@ func ParseSetlistFromPhishNet(setlist *gophish.Setlist) (*Setlist, map[string]st
 			}
 		}
 		if foundSetInfo {
-			if strings.Contains(n.FirstChild.Data, "Encore") {
-				if sl.Encore == nil {
-					sl.Encore = &Set{}
-				}
-				getSongs(n, sl.Encore)
-			} else {
-				s := &Set{}
-				sl.Sets = append(sl.Sets, s)
-				getSongs(n, s)
-			}
+			s := parseSetLabel(n.FirstChild.Data, sl.Sets)
+			sl.Sets = append(sl.Sets, s)
+			getSongs(n, s)
 		}
 		for c := n.FirstChild; c != nil; c = c.NextSibling {
 			findSets(c)
@@ -187,15 +620,46 @@ func ParseSetlistFromPhishNet(setlist *gophish.Setlist) (*Setlist, map[string]st
 	return sl, songSet, nil
 }
 
+// parseSetLabel returns an empty set for a phish.net set label such as
+// "Set 2", "Encore" or "Encore 2". Labels without a number are numbered after
+// the existing sets of the same kind.
+func parseSetLabel(label string, existing []*Set) *Set {
+	s := &Set{}
+	lower := strings.ToLower(label)
+	switch {
+	case strings.Contains(lower, "encore"):
+		s.Kind = EncoreSet
+	case strings.Contains(lower, "soundcheck"):
+		s.Kind = SoundcheckSet
+	}
+	digits := strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, label)
+	if ordinal, err := strconv.Atoi(digits); err == nil {
+		s.Ordinal = ordinal
+		return s
+	}
+	s.Ordinal = 1
+	for _, other := range existing {
+		if other.Kind == s.Kind {
+			s.Ordinal++
+		}
+	}
+	return s
+}
+
+// Songs returns the songs played in the show's sets and encores. Soundchecks
+// are not included.
 func (s *Setlist) Songs() []string {
 	var songs []string
 	for _, set := range s.Sets {
-		for _, song := range set.Songs {
-			songs = append(songs, song)
+		if set.Kind == SoundcheckSet {
+			continue
 		}
-	}
-	if s.Encore != nil {
-		for _, song := range s.Encore.Songs {
+		for _, song := range set.Songs {
 			songs = append(songs, song)
 		}
 	}
@@ -203,12 +667,19 @@ func (s *Setlist) Songs() []string {
 }
 
 func (s *Setlist) String() string {
-	str := fmt.Sprintf("ID{%d}DATE{%s}URL{%s}", s.ShowId, s.Date, s.Url)
-	for i, set := range s.Sets {
-		str += fmt.Sprintf("SET%d{%s}", i+1, strings.Join(set.Songs, ","))
+	str := fmt.Sprintf("ID{%d}DATE{%s}URL{%s}", s.ShowId, escape(s.Date), escape(s.Url))
+	for _, f := range []struct{ tag, value string }{
+		{"VENUE", s.Venue},
+		{"LOCATION", s.Location},
+		{"TOUR", s.Tour},
+		{"ORIGIN", s.Origin},
+	} {
+		if f.value != "" {
+			str += fmt.Sprintf("%s{%s}", f.tag, escape(f.value))
+		}
 	}
-	if s.Encore != nil {
-		str += fmt.Sprintf("ENCORE{%s}", strings.Join(s.Encore.Songs, ","))
+	for _, set := range s.Sets {
+		str += fmt.Sprintf("%s{%s}", set.tag(), set)
 	}
 	return str
 }
@@ -22,13 +22,69 @@ func TestParseSetlist(t *testing.T) {
 				Date:   "2000-07-20",
 				Url:    "http://phish.net.com/setlists/blah",
 				Sets: []*Set{
-					&Set{Songs: []string{"a", "b", "c", "d"}},
-					&Set{Songs: []string{"x", "y", "z"}},
+					&Set{Kind: RegularSet, Ordinal: 1, Songs: []string{"a", "b", "c", "d"}, Connectors: []Connector{Break, Break, Break}},
+					&Set{Kind: RegularSet, Ordinal: 2, Songs: []string{"x", "y", "z"}, Connectors: []Connector{Break, Break}},
+					&Set{Kind: EncoreSet, Ordinal: 1, Songs: []string{"aa", "bb"}, Connectors: []Connector{Break}},
 				},
-				Encore: &Set{Songs: []string{"aa", "bb"}},
 			},
 			err: false,
 		},
+		{
+			name:    "venue, location and tour",
+			setlist: "ID{1}DATE{2000-07-20}URL{u}TOUR{Summer Tour 2000}VENUE{Deer Creek Music Center}LOCATION{Noblesville, IN, USA}SET1{a}",
+			expected: &Setlist{
+				ShowId:   1,
+				Date:     "2000-07-20",
+				Url:      "u",
+				Venue:    "Deer Creek Music Center",
+				Location: "Noblesville, IN, USA",
+				Tour:     "Summer Tour 2000",
+				Sets: []*Set{
+					&Set{Kind: RegularSet, Ordinal: 1, Songs: []string{"a"}},
+				},
+			},
+		},
+		{
+			name:    "duplicate venue",
+			setlist: "ID{1}DATE{2000-07-20}URL{u}VENUE{a}VENUE{b}SET1{a}",
+			err:     true,
+		},
+		{
+			name:    "segues",
+			setlist: "ID{1}DATE{2000-07-20}URL{http://phish.net.com/setlists/blah}SET1{a->b>c,d}ENCORE{aa->bb}",
+			expected: &Setlist{
+				ShowId: 1,
+				Date:   "2000-07-20",
+				Url:    "http://phish.net.com/setlists/blah",
+				Sets: []*Set{
+					&Set{Kind: RegularSet, Ordinal: 1, Songs: []string{"a", "b", "c", "d"}, Connectors: []Connector{Segue, Transition, Break}},
+					&Set{Kind: EncoreSet, Ordinal: 1, Songs: []string{"aa", "bb"}, Connectors: []Connector{Segue}},
+				},
+			},
+			err: false,
+		},
+		{
+			name:    "multiple encores and soundcheck",
+			setlist: "ID{1}DATE{2000-07-20}URL{http://phish.net.com/setlists/blah}SOUNDCHECK{s}SET1{a}ENCORE{b}ENCORE2{c}",
+			expected: &Setlist{
+				ShowId: 1,
+				Date:   "2000-07-20",
+				Url:    "http://phish.net.com/setlists/blah",
+				Sets: []*Set{
+					&Set{Kind: SoundcheckSet, Ordinal: 1, Songs: []string{"s"}},
+					&Set{Kind: RegularSet, Ordinal: 1, Songs: []string{"a"}},
+					&Set{Kind: EncoreSet, Ordinal: 1, Songs: []string{"b"}},
+					&Set{Kind: EncoreSet, Ordinal: 2, Songs: []string{"c"}},
+				},
+			},
+			err: false,
+		},
+		{
+			name:     "set without a number",
+			setlist:  "ID{1}DATE{2000-07-20}URL{http://phish.net.com/setlists/blah}SET{a}",
+			expected: nil,
+			err:      true,
+		},
 		{
 			name:     "missing ID",
 			setlist:  "SET1{a,b,c,d}SET2{x,y,z}ENCORE{aa,bb}",
@@ -69,28 +125,177 @@ func TestParseSetlist(t *testing.T) {
 }
 
 func TestSetlistString(t *testing.T) {
-	setlistString := "ID{1}DATE{2000-04-21}URL{http://google.com}SET1{a,b,c,d}SET2{x,y,z}ENCORE{aa,bb}"
-	setlistStruct, err := ParseSetlist(setlistString)
+	for _, setlistString := range []string{
+		"ID{1}DATE{2000-04-21}URL{http://google.com}SET1{a,b,c,d}SET2{x,y,z}ENCORE{aa,bb}",
+		"ID{1}DATE{2000-04-21}URL{http://google.com}SET1{a->b>c,d}SET2{x>y->z}ENCORE{aa,bb}",
+		"ID{1}DATE{2000-04-21}URL{http://google.com}SOUNDCHECK{s}SET1{a}SET2{b}SET3{c}ENCORE{d}ENCORE2{e}",
+		`ID{1}DATE{2000-04-21}URL{http://google.com/\}}SET1{a\,b->c\>d,e\-,f\\\n}`,
+		`ID{1}DATE{2000-04-21}URL{u}VENUE{The Gorge \{WA\}}LOCATION{George, WA, USA}TOUR{Summer}SET1{a}`,
+		"ID{1}DATE{2000-04-21}URL{u}ORIGIN{phish.net+override}SET1{a}",
+	} {
+		setlistStruct, err := ParseSetlist(setlistString)
+		if err != nil {
+			t.Fatalf("Unable to parse setlist; %v", err)
+		}
+		if got := setlistStruct.String(); got != setlistString {
+			t.Errorf("got: %s\nexpected: %s", got, setlistString)
+		}
+	}
+}
+
+func TestParseSetName(t *testing.T) {
+	for _, name := range []string{"1", "2", "12", "e", "e2", "s", "s3"} {
+		s, err := ParseSetName(name)
+		if err != nil {
+			t.Errorf("ParseSetName(%q) got unexpected error: %v", name, err)
+			continue
+		}
+		if got := s.Name(); got != name {
+			t.Errorf("ParseSetName(%q).Name() got %q", name, got)
+		}
+	}
+	for _, name := range []string{"", "0", "x", "e0", "s-1", "1e", "+1"} {
+		if s, err := ParseSetName(name); err == nil {
+			t.Errorf("ParseSetName(%q) got %+v, but expected an error", name, s)
+		}
+	}
+}
+
+func TestParseSet(t *testing.T) {
+	s, err := ParseSet("e", "a->b,c")
+	if err != nil {
+		t.Fatalf("ParseSet got unexpected error: %v", err)
+	}
+	want := &Set{Kind: EncoreSet, Ordinal: 1, Songs: []string{"a", "b", "c"}, Connectors: []Connector{Segue, Break}}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("ParseSet got %+v, but expected %+v", s, want)
+	}
+	if s, err := ParseSet("x", "a"); err == nil {
+		t.Errorf("ParseSet with a bad set name got %+v, but expected an error", s)
+	}
+}
+
+func TestOverridden(t *testing.T) {
+	for _, tc := range []struct {
+		origin string
+		want   bool
+	}{
+		{"", false},
+		{OriginPhishNet, false},
+		{OriginOverride, true},
+		{OriginPhishNet + "+" + OriginOverride, true},
+	} {
+		sl := &Setlist{Origin: tc.origin}
+		if got := sl.Overridden(); got != tc.want {
+			t.Errorf("Overridden() with origin %q got %v, but expected %v", tc.origin, got, tc.want)
+		}
+	}
+}
+
+func TestParseConnector(t *testing.T) {
+	for _, c := range []Connector{Break, Transition, Segue} {
+		got, err := ParseConnector(c.String())
+		if err != nil || got != c {
+			t.Errorf("ParseConnector(%q) got %v, %v; expected %v", c.String(), got, err, c)
+		}
+	}
+	if _, err := ParseConnector("-"); err == nil {
+		t.Errorf("ParseConnector(%q) expected an error, but got nil", "-")
+	}
+}
+
+func TestSetlistEscaping(t *testing.T) {
+	sl := &Setlist{
+		ShowId: 1,
+		Date:   "2000-04-21",
+		Url:    "http://phish.net/{x}",
+		Sets: []*Set{
+			&Set{Kind: RegularSet, Ordinal: 1, Songs: []string{"a,b", "c}", "d->e", "f-", "g\\", "h\nSET2{i}"}, Connectors: []Connector{Segue, Transition, Break, Transition, Segue}},
+		},
+	}
+	want := `ID{1}DATE{2000-04-21}URL{http://phish.net/\{x\}}SET1{a\,b->c\}>d-\>e,f\->g\\->h\nSET2\{i\}}`
+	if got := sl.String(); got != want {
+		t.Errorf("got: %s\nexpected: %s", got, want)
+	}
+	got, err := ParseSetlist(want)
 	if err != nil {
 		t.Fatalf("Unable to parse setlist; %v", err)
 	}
-	if got := setlistStruct.String(); got != setlistString {
-		t.Errorf("got: %s\nexpected: %s", got, setlistString)
+	if !reflect.DeepEqual(got, sl) {
+		t.Errorf("got: %#v\nexpected: %#v", got.Sets[0], sl.Sets[0])
 	}
 }
 
+func FuzzSetlistRoundTrip(f *testing.F) {
+	f.Add(1, "2000-04-21", "http://phish.net", "mikes-song", "simple", "tweezer", uint8(0))
+	f.Add(-7, "", "}{", "a,b", "c->", "-", uint8(2))
+	f.Add(0, "\\", "\n", "x>", "\\}", "\r", uint8(1))
+	f.Fuzz(func(t *testing.T, id int, date, url, song1, song2, encore string, conn uint8) {
+		sl := &Setlist{
+			ShowId: id,
+			Date:   date,
+			Url:    url,
+			Sets: []*Set{
+				&Set{Kind: RegularSet, Ordinal: 1, Songs: []string{song1, song2}, Connectors: []Connector{Connector(conn % 3)}},
+			},
+		}
+		// A set holding a single empty song is indistinguishable from an
+		// empty set.
+		if encore != "" {
+			sl.Sets = append(sl.Sets, &Set{Kind: EncoreSet, Ordinal: 1, Songs: []string{encore}})
+		}
+		got, err := ParseSetlist(sl.String())
+		if err != nil {
+			t.Fatalf("ParseSetlist(%q) got unexpected error: %v", sl.String(), err)
+		}
+		if !reflect.DeepEqual(got, sl) {
+			t.Fatalf("ParseSetlist(%q)\ngot: %#v\nexpected: %#v", sl.String(), got, sl)
+		}
+	})
+}
+
+func FuzzParseSetlist(f *testing.F) {
+	f.Add("ID{1}DATE{2000-04-21}URL{http://google.com}SET1{a->b>c,d}SET2{x>y->z}ENCORE{aa,bb}")
+	f.Add(`ID{1}DATE{2000-04-21}URL{\}}SOUNDCHECK{s\,}SET1{a\-}ENCORE2{e}`)
+	f.Fuzz(func(t *testing.T, setlist string) {
+		sl, err := ParseSetlist(setlist)
+		if err != nil {
+			return
+		}
+		got, err := ParseSetlist(sl.String())
+		if err != nil {
+			t.Fatalf("ParseSetlist(%q) got unexpected error: %v", sl.String(), err)
+		}
+		if !reflect.DeepEqual(got, sl) {
+			t.Fatalf("ParseSetlist(%q)\ngot: %#v\nexpected: %#v", sl.String(), got, sl)
+		}
+	})
+}
+
 func TestParseSetlistFromPhishNet(t *testing.T) {
 	setlistData := "<p><span class='set-label'>Set 1</span>: <a href='http://phish.net/song/nicu' class='setlist-song' title='NICU'>NICU</a> > <a href='http://phish.net/song/golgi-apparatus' class='setlist-song' title='Golgi Apparatus'>Golgi Apparatus</a> > <a href='http://phish.net/song/crossroads' class='setlist-song' title='Crossroads'>Crossroads</a>, <a href='http://phish.net/song/cars-trucks-buses' class='setlist-song' title='Cars Trucks Buses'>Cars Trucks Buses</a>, <a href='http://phish.net/song/train-song' class='setlist-song' title='Train Song'>Train Song</a>, <a title=\"Blistering, high octane version with nice concluding transition space and a &gt; to &quot;Fluffhead.&quot;\" href='http://phish.net/song/theme-from-the-bottom' class='setlist-song' title='Blistering, high octane version with nice concluding transition space and a &gt; to &quot;Fluffhead.&quot;'>Theme From the Bottom</a> > <a href='http://phish.net/song/fluffhead' class='setlist-song' title='Fluffhead'>Fluffhead</a>, <a href='http://phish.net/song/dirt' class='setlist-song' title='Dirt'>Dirt</a>, <a title=\"Straightforward but well played jam, followed by some downright filthy funk jamming in the &quot;Rocco&quot; section.\" href='http://phish.net/song/run-like-an-antelope' class='setlist-song' title='Straightforward but well played jam, followed by some downright filthy funk jamming in the &quot;Rocco&quot; section.'>Run Like an Antelope</a></p><p><span class='set-label'>Set 2</span>:<a title=\"Fearsome but exploratory jam. Moments of quiet settle are repeatedly upended by intense funk rocking. This legitimate monster &quot;Disease&quot; finally gives up a little belligerence only to -> into a very strong &quot;David Bowie.&quot;\" href='http://phish.net/song/down-with-disease' class='setlist-song' title='Fearsome but exploratory jam. Moments of quiet settle are repeatedly upended by intense funk rocking. This legitimate monster &quot;Disease&quot; finally gives up a little belligerence only to -> into a very strong &quot;David Bowie.&quot;'>Down with Disease</a><sup title=\"Unfinished.\">[\"2]</sup> -> <a title=\"Excellent and thrilling version with strong musicianship. Mode shift out of typical (but very well played) &quot;Bowie&quot; at 13:55 into a great groove which peaks and returns to &quot;Bowie&quot; by 17:00.\" href='http://phish.net/song/david-bowie' class='setlist-song' title='Excellent and thrilling version with strong musicianship. Mode shift out of typical (but very well played) &quot;Bowie&quot; at 13:55 into a great groove which peaks and returns to &quot;Bowie&quot; by 17:00.'>David Bowie</a><sup title=\"Antelope-esque jamming. James Bond Theme tease from Mike.\">[\"3]</sup> > <a title=\"> in from a strong &quot;Bowie.&quot; There are two &quot;I Can't Turn You Loose&quot; (Blues Brothers) jams in this solid &quot;Possum.&quot;\" href='http://phish.net/song/possum' class='setlist-song' title='> in from a strong &quot;Bowie.&quot; There are two &quot;I Can't Turn You Loose&quot; (Blues Brothers) jams in this solid &quot;Possum.&quot;'>Possum</a>, <a title=\"Simply the slowest, funkiest, and thickest &quot;Tube&quot; ever played, featuring a  seamless full-band groove and breakdown solos by Trey, Page, and Mike.  This jam is a great example of the band playing as one and is among the best versions ever.  &quot;I Feel the Earth Move&quot; tease.\" href='http://phish.net/song/tube' class='setlist-song' title='Simply the slowest, funkiest, and thickest &quot;Tube&quot; ever played, featuring a  seamless full-band groove and breakdown solos by Trey, Page, and Mike.  This jam is a great example of the band playing as one and is among the best versions ever.  &quot;I Feel the Earth Move&quot; tease.'>Tube</a>, <a href='http://phish.net/song/you-enjoy-myself' class='setlist-song' title='You Enjoy Myself'>You Enjoy Myself</a></p><p><span class='set-label'>Encore</span>:<a href='http://phish.net/song/good-times-bad-times' class='setlist-song' title='Good Times Bad Times'>Good Times Bad Times</a><p class='setlist-footer'>[2] Unfinished.<br>[3] Antelope-esque jamming. James Bond Theme tease from Mike.<br></p>"
 
 	want := &Setlist{
-		ShowId: 1,
-		Date:   "2000-04-20",
-		Url:    "http://phish.net/setlists/phish-december-29-1997-madison-square-garden-new-york-ny-usa.html",
+		ShowId:   1,
+		Date:     "2000-04-20",
+		Url:      "http://phish.net/setlists/phish-december-29-1997-madison-square-garden-new-york-ny-usa.html",
+		Venue:    "Madison Square Garden",
+		Location: "New York, NY, USA",
 		Sets: []*Set{
-			&Set{Songs: []string{"nicu", "golgi-apparatus", "crossroads", "cars-trucks-buses", "train-song", "theme-from-the-bottom", "fluffhead", "dirt", "run-like-an-antelope"}},
-			&Set{Songs: []string{"down-with-disease", "david-bowie", "possum", "tube", "you-enjoy-myself"}},
+			&Set{
+				Kind:       RegularSet,
+				Ordinal:    1,
+				Songs:      []string{"nicu", "golgi-apparatus", "crossroads", "cars-trucks-buses", "train-song", "theme-from-the-bottom", "fluffhead", "dirt", "run-like-an-antelope"},
+				Connectors: []Connector{Transition, Transition, Break, Break, Break, Transition, Break, Break},
+			},
+			&Set{
+				Kind:       RegularSet,
+				Ordinal:    2,
+				Songs:      []string{"down-with-disease", "david-bowie", "possum", "tube", "you-enjoy-myself"},
+				Connectors: []Connector{Segue, Transition, Break, Break},
+			},
+			&Set{Kind: EncoreSet, Ordinal: 1, Songs: []string{"good-times-bad-times"}},
 		},
-		Encore: &Set{Songs: []string{"good-times-bad-times"}},
 	}
 
 	wantSongSet := map[string]string{"Cars Trucks Buses": "cars-trucks-buses", "Crossroads": "crossroads", "David Bowie": "david-bowie", "Dirt": "dirt", "Down with Disease": "down-with-disease", "Fluffhead": "fluffhead", "Golgi Apparatus": "golgi-apparatus", "Good Times Bad Times": "good-times-bad-times", "NICU": "nicu", "Possum": "possum", "Run Like an Antelope": "run-like-an-antelope", "Theme From the Bottom": "theme-from-the-bottom", "Train Song": "train-song", "Tube": "tube", "You Enjoy Myself": "you-enjoy-myself"}
@@ -99,6 +304,8 @@ func TestParseSetlistFromPhishNet(t *testing.T) {
 		ShowId:      1,
 		ShowDate:    "2000-04-20",
 		Url:         "http://phish.net/setlists/phish-december-29-1997-madison-square-garden-new-york-ny-usa.html",
+		Venue:       "<a href=\"http://phish.net/venue/157/Madison_Square_Garden\">Madison Square Garden</a>",
+		Location:    "New York, NY, USA",
 		SetlistData: setlistData})
 	if err != nil {
 		t.Fatalf("Unable to parse setlist; %v", err)
@@ -112,6 +319,30 @@ func TestParseSetlistFromPhishNet(t *testing.T) {
 
 }
 
+func TestParseSetlistFromPhishNetEncores(t *testing.T) {
+	setlistData := "<p><span class='set-label'>Soundcheck</span>: <a href='http://phish.net/song/fee' class='setlist-song'>Fee</a></p>" +
+		"<p><span class='set-label'>Set 1</span>: <a href='http://phish.net/song/nicu' class='setlist-song'>NICU</a></p>" +
+		"<p><span class='set-label'>Encore</span>: <a href='http://phish.net/song/tube' class='setlist-song'>Tube</a></p>" +
+		"<p><span class='set-label'>Encore 2</span>: <a href='http://phish.net/song/possum' class='setlist-song'>Possum</a></p>"
+
+	got, _, err := ParseSetlistFromPhishNet(&gophish.Setlist{ShowId: 1, SetlistData: setlistData})
+	if err != nil {
+		t.Fatalf("Unable to parse setlist; %v", err)
+	}
+	want := []*Set{
+		&Set{Kind: SoundcheckSet, Ordinal: 1, Songs: []string{"fee"}},
+		&Set{Kind: RegularSet, Ordinal: 1, Songs: []string{"nicu"}},
+		&Set{Kind: EncoreSet, Ordinal: 1, Songs: []string{"tube"}},
+		&Set{Kind: EncoreSet, Ordinal: 2, Songs: []string{"possum"}},
+	}
+	if !reflect.DeepEqual(got.Sets, want) {
+		t.Errorf("got: %v\nexpected: %v", got.Sets, want)
+	}
+	if got, want := got.Songs(), []string{"nicu", "tube", "possum"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Songs() got: %v\nexpected: %v", got, want)
+	}
+}
+
 func TestNormalizeName(t *testing.T) {
 	tests := []struct {
 		name string
@@ -132,6 +363,9 @@ func TestNormalizeName(t *testing.T) {
 		}, {
 			name: "Mike's Song",
 			want: "mikes-song",
+		}, {
+			name: "Mike’s Song",
+			want: "mikes-song",
 		},
 	}
 	for _, tc := range tests {
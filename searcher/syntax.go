@@ -0,0 +1,265 @@
+package searcher
+
+import (
+	"fmt"
+	"strings"
+)
+
+// op is the kind of a node in a parsed search expression.
+type op int
+
+const (
+	opSong      op = iota // a single song matching song
+	opAnySong             // any song
+	opClass               // any song in class (or not in class if negate)
+	opBeginShow           // empty song at the beginning of the show
+	opEndShow             // empty song at the end of the show
+	opBeginSet            // empty song at the beginning of set
+	opEndSet              // empty song at the end of set
+	opConnector           // the two surrounding songs are joined by conn
+	opConcat              // sub[0] followed by sub[1] ...
+	opAlternate           // sub[0] or sub[1] ...
+	opStar                // zero or more sub[0]
+	opPlus                // one or more sub[0]
+	opQuest               // zero or one sub[0]
+	opEmpty               // matches the empty sequence
+)
+
+// node is a node in a parsed search expression.
+type node struct {
+	op     op
+	song   string          // opSong
+	class  map[string]bool // opClass
+	negate bool            // opClass
+	set    string          // opBeginSet, opEndSet
+	conn   Connector       // opConnector
+	sub    []*node
+}
+
+// parser holds the state of a search expression being parsed.
+type parser struct {
+	expr string
+	pos  int
+}
+
+// parse parses a search expression into a tree of nodes.
+func parse(expr string) (*node, error) {
+	p := &parser{expr: expr}
+	n, err := p.alternate()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.expr) {
+		return nil, p.errorf("unexpected %q", p.expr[p.pos])
+	}
+	return n, nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("searcher: %s at position %d in %s", fmt.Sprintf(format, args...), p.pos, quote(p.expr))
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.expr) && (p.expr[p.pos] == ' ' || p.expr[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// peek returns the next non-space byte, or 0 at the end of the expression.
+func (p *parser) peek() byte {
+	p.skipSpace()
+	if p.pos < len(p.expr) {
+		return p.expr[p.pos]
+	}
+	return 0
+}
+
+func (p *parser) hasPrefix(prefix string) bool {
+	return strings.HasPrefix(p.expr[p.pos:], prefix)
+}
+
+// alternate parses x|y|z.
+func (p *parser) alternate() (*node, error) {
+	var subs []*node
+	for {
+		n, err := p.concat()
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, n)
+		if p.peek() != '|' {
+			break
+		}
+		p.pos++
+	}
+	if len(subs) == 1 {
+		return subs[0], nil
+	}
+	return &node{op: opAlternate, sub: subs}, nil
+}
+
+// concat parses xyz.
+func (p *parser) concat() (*node, error) {
+	var subs []*node
+	for {
+		switch c := p.peek(); c {
+		case 0, '|', ')':
+			switch len(subs) {
+			case 0:
+				return &node{op: opEmpty}, nil
+			case 1:
+				return subs[0], nil
+			}
+			return &node{op: opConcat, sub: subs}, nil
+		}
+		n, err := p.repeat()
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, n)
+	}
+}
+
+// repeat parses an atom followed by any number of *, + or ?.
+func (p *parser) repeat() (*node, error) {
+	n, err := p.atom()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var o op
+		switch p.peek() {
+		case '*':
+			o = opStar
+		case '+':
+			o = opPlus
+		case '?':
+			o = opQuest
+		default:
+			return n, nil
+		}
+		p.pos++
+		n = &node{op: o, sub: []*node{n}}
+	}
+}
+
+// atom parses a single song, an empty song, a connector or a group.
+func (p *parser) atom() (*node, error) {
+	switch c := p.peek(); c {
+	case '.':
+		p.pos++
+		return &node{op: opAnySong}, nil
+	case '^':
+		p.pos++
+		return &node{op: opBeginShow}, nil
+	case '$':
+		p.pos++
+		return &node{op: opEndShow}, nil
+	case ',':
+		p.pos++
+		return &node{op: opConnector, conn: Break}, nil
+	case '>':
+		p.pos++
+		return &node{op: opConnector, conn: Transition}, nil
+	case '-':
+		if !p.hasPrefix("->") {
+			return nil, p.errorf("expected -> but found %q", c)
+		}
+		p.pos += 2
+		return &node{op: opConnector, conn: Segue}, nil
+	case '\\':
+		return p.setAnchor()
+	case '[':
+		return p.class()
+	case '(':
+		if strings.HasPrefix(p.expr[p.pos+1:], "?:") {
+			p.pos += 3
+			n, err := p.alternate()
+			if err != nil {
+				return nil, err
+			}
+			if p.peek() != ')' {
+				return nil, p.errorf("missing closing )")
+			}
+			p.pos++
+			return n, nil
+		}
+		song, err := p.song()
+		if err != nil {
+			return nil, err
+		}
+		return &node{op: opSong, song: song}, nil
+	case '*', '+', '?':
+		return nil, p.errorf("missing argument to repetition operator %q", c)
+	}
+	return nil, p.errorf("unexpected %q", p.expr[p.pos])
+}
+
+// song parses (songname) and returns the normalized song name.
+func (p *parser) song() (string, error) {
+	end := strings.IndexByte(p.expr[p.pos:], ')')
+	if end < 0 {
+		return "", p.errorf("missing closing ) for song name")
+	}
+	name := strings.TrimSpace(p.expr[p.pos+1 : p.pos+end])
+	if name == "" {
+		return "", p.errorf("empty song name")
+	}
+	p.pos += end + 1
+	return normalizeName(name), nil
+}
+
+// class parses [(song1)(song2)] or [^(song1)(song2)].
+func (p *parser) class() (*node, error) {
+	p.pos++
+	n := &node{op: opClass, class: make(map[string]bool)}
+	if p.peek() == '^' {
+		n.negate = true
+		p.pos++
+	}
+	for {
+		switch p.peek() {
+		case ']':
+			p.pos++
+			if len(n.class) == 0 {
+				return nil, p.errorf("empty song class")
+			}
+			return n, nil
+		case '(':
+			song, err := p.song()
+			if err != nil {
+				return nil, err
+			}
+			n.class[song] = true
+		case 0:
+			return nil, p.errorf("missing closing ]")
+		default:
+			return nil, p.errorf("expected (songname) in song class but found %q", p.expr[p.pos])
+		}
+	}
+}
+
+// setAnchor parses \S{SetNum} or \E{SetNum}.
+func (p *parser) setAnchor() (*node, error) {
+	var o op
+	switch {
+	case p.hasPrefix(`\S{`):
+		o = opBeginSet
+	case p.hasPrefix(`\E{`):
+		o = opEndSet
+	default:
+		return nil, p.errorf(`expected \S{SetNum} or \E{SetNum}`)
+	}
+	p.pos += 3
+	end := strings.IndexByte(p.expr[p.pos:], '}')
+	if end < 0 {
+		return nil, p.errorf("missing closing } for set anchor")
+	}
+	set := strings.ToLower(strings.TrimSpace(p.expr[p.pos : p.pos+end]))
+	if set == "" {
+		return nil, p.errorf("empty set number")
+	}
+	p.pos += end + 1
+	return &node{op: o, set: set}, nil
+}